@@ -1,9 +1,9 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/chafid/payroll-project/config"
 	"github.com/chafid/payroll-project/db"
@@ -12,6 +12,8 @@ import (
 
 	"github.com/chafid/payroll-project/internal/handlers"
 	"github.com/chafid/payroll-project/internal/middlewares"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/storage"
 	"github.com/chafid/payroll-project/internal/utils"
 )
 
@@ -19,6 +21,20 @@ func main() {
 	//Load env variables if present
 	config.LoadConfig()
 
+	//Load JWT signing keys, a development key is generated when the directory is empty
+	keyStore, err := utils.LoadKeyStore(config.JwtKeyDir, config.JwtActiveKID)
+	if err != nil && config.AppEnv == "development" {
+		log.Printf("No usable signing key (%v), generating a development key in %s\n", err, config.JwtKeyDir)
+		if err := utils.WriteEd25519KeyFile(config.JwtKeyDir, time.Now().Format("2006-01-02")); err != nil {
+			log.Fatalf("Failed to generate signing key: %v\n", err)
+		}
+		keyStore, err = utils.LoadKeyStore(config.JwtKeyDir, config.JwtActiveKID)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v\n", err)
+	}
+	utils.SetKeyStore(keyStore)
+
 	//Connect to db
 	db, err := db.ConnectDB()
 	if err != nil {
@@ -26,30 +42,129 @@ func main() {
 	}
 	defer db.Close()
 
+	//Receipts of reimbursements are kept on the local filesystem
+	receiptStore, err := storage.NewLocalStore(config.ReceiptDir)
+	if err != nil {
+		log.Fatalf("Failed to open receipt storage: %v\n", err)
+	}
+
 	r := gin.Default()
 
+	//The client IP drives login throttling and audit logs, only trust X-Forwarded-For from known proxies
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v\n", err)
+	}
+
 	//Public routes
 	r.POST("/login", handlers.LoginHandler(db))
+	r.GET("/.well-known/jwks.json", handlers.JWKSHandler())
+
+	authGroup := r.Group("/auth")
+	{
+		authGroup.POST("/refresh", handlers.RefreshTokenHandler(db))
+		authGroup.POST("/logout", middlewares.AuthMiddleware(db), middlewares.RejectAPIKeys(), handlers.LogoutHandler(db))
+		authGroup.POST("/reset-password", handlers.ResetPassword(db))
+		authGroup.POST("/2fa/login", handlers.TwoFactorLogin(db))
+	}
 
 	//Routes that needs authentications
 	api := r.Group("/api")
-	api.Use(middlewares.AuthMiddleware())
+	api.Use(middlewares.AuthMiddleware(db))
+
+	//Account routes, reachable with a restricted token so users can resolve the restriction
+	accountGroup := api.Group("/auth")
+	accountGroup.Use(middlewares.RejectAPIKeys())
+	{
+		accountGroup.POST("/change-password", handlers.ChangePassword(db))
+		accountGroup.POST("/2fa/enroll", handlers.EnrollTwoFactor(db))
+		accountGroup.POST("/2fa/verify", handlers.VerifyTwoFactor(db))
+		accountGroup.GET("/sessions", handlers.ListMySessions(db))
+		accountGroup.DELETE("/sessions/:session_id", handlers.TerminateMySession(db))
+	}
 
 	//Admin routes
 	adminGroup := api.Group("/admin")
+	adminGroup.Use(middlewares.RequireFullAccess())
 	{
-		adminGroup.POST("/attendance-periods", handlers.CreateAttendancePeriod(db))
-		adminGroup.POST("/run-payroll", handlers.RunPayroll(db))
-		adminGroup.GET("/payroll-summary/:period_id", handlers.GetPayslipSummaryForAdmin(db))
+		adminGroup.POST("/attendance-periods", middlewares.Authorize(db, rbac.PermManageAttendancePeriods), handlers.CreateAttendancePeriod(db))
+		adminGroup.POST("/attendance-periods/:period_id/close", middlewares.Authorize(db, rbac.PermManageAttendancePeriods), handlers.CloseAttendancePeriod(db))
+		adminGroup.GET("/attendance-periods/:period_id/overrides", middlewares.Authorize(db, rbac.PermOverridePeriodLock), handlers.ListPeriodOverrides(db))
+		adminGroup.POST("/attendance-periods/:period_id/overrides", middlewares.Authorize(db, rbac.PermOverridePeriodLock), handlers.CreatePeriodOverride(db))
+		adminGroup.DELETE("/attendance-periods/:period_id/overrides/:override_id", middlewares.Authorize(db, rbac.PermOverridePeriodLock), handlers.RevokePeriodOverride(db))
+		adminGroup.POST("/attendance/import", middlewares.Authorize(db, rbac.PermImportAttendance), handlers.ImportAttendance(db))
+		adminGroup.POST("/run-payroll", middlewares.Authorize(db, rbac.PermRunPayroll), handlers.RunPayroll(db))
+		adminGroup.GET("/payroll-runs", middlewares.Authorize(db, rbac.PermViewPayrollSummary), handlers.ListPayrollRuns(db))
+		adminGroup.POST("/payroll-runs/:run_id/finalize", middlewares.Authorize(db, rbac.PermFinalizePayroll), handlers.FinalizePayrollRun(db))
+		adminGroup.GET("/payroll-summary/:period_id", middlewares.Authorize(db, rbac.PermViewPayrollSummary), handlers.GetPayslipSummaryForAdmin(db))
+		adminGroup.GET("/users", middlewares.Authorize(db, rbac.PermManageUsers), handlers.ListUsers(db))
+		adminGroup.POST("/users", middlewares.Authorize(db, rbac.PermManageUsers), handlers.CreateUser(db))
+		adminGroup.PATCH("/users/:user_id", middlewares.Authorize(db, rbac.PermManageUsers), handlers.UpdateUser(db))
+		adminGroup.POST("/users/:user_id/deactivate", middlewares.Authorize(db, rbac.PermManageUsers), handlers.DeactivateUser(db))
+		adminGroup.POST("/users/:user_id/reactivate", middlewares.Authorize(db, rbac.PermManageUsers), handlers.ReactivateUser(db))
+		adminGroup.GET("/users/:user_id/tax-profile", middlewares.Authorize(db, rbac.PermManageUsers), handlers.GetTaxProfile(db))
+		adminGroup.PUT("/users/:user_id/tax-profile", middlewares.Authorize(db, rbac.PermManageUsers), handlers.UpdateTaxProfile(db))
+		adminGroup.GET("/levels", middlewares.Authorize(db, rbac.PermManageLevels), handlers.ListEmployeeLevels(db))
+		adminGroup.POST("/levels", middlewares.Authorize(db, rbac.PermManageLevels), handlers.CreateEmployeeLevel(db))
+		adminGroup.GET("/levels/:level_id/salaries", middlewares.Authorize(db, rbac.PermManageLevels), handlers.ListLevelSalaries(db))
+		adminGroup.POST("/levels/:level_id/salaries", middlewares.Authorize(db, rbac.PermManageLevels), handlers.AddLevelSalary(db))
+		adminGroup.GET("/levels/:level_id/overtime-policy", middlewares.Authorize(db, rbac.PermManageLevels), handlers.GetOvertimePolicy(db))
+		adminGroup.PUT("/levels/:level_id/overtime-policy", middlewares.Authorize(db, rbac.PermManageLevels), handlers.SetOvertimePolicy(db))
+		adminGroup.DELETE("/levels/:level_id/overtime-policy", middlewares.Authorize(db, rbac.PermManageLevels), handlers.DeleteOvertimePolicy(db))
+		adminGroup.GET("/allowances", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.ListAllowances(db))
+		adminGroup.POST("/allowances", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.CreateAllowance(db))
+		adminGroup.POST("/allowances/:allowance_id/end", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.EndAllowance(db))
+		adminGroup.GET("/attendance-periods/:period_id/bonuses", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.ListBonuses(db))
+		adminGroup.POST("/attendance-periods/:period_id/bonuses", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.CreateBonus(db))
+		adminGroup.DELETE("/bonuses/:bonus_id", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.DeleteBonus(db))
+		adminGroup.GET("/overtimes", middlewares.Authorize(db, rbac.PermApproveOvertime), handlers.ListOvertimes(db))
+		adminGroup.POST("/overtimes/:overtime_id/review", middlewares.Authorize(db, rbac.PermApproveOvertime), handlers.ReviewOvertime(db))
+		adminGroup.GET("/reimbursements", middlewares.Authorize(db, rbac.PermApproveReimbursements), handlers.ListReimbursements(db))
+		adminGroup.POST("/reimbursements/:reimbursement_id/review", middlewares.Authorize(db, rbac.PermApproveReimbursements), handlers.ReviewReimbursement(db))
+		adminGroup.GET("/reimbursement-categories", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.ListReimbursementCategories(db))
+		adminGroup.POST("/reimbursement-categories", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.CreateReimbursementCategory(db))
+		adminGroup.PUT("/reimbursement-categories/:code", middlewares.Authorize(db, rbac.PermManageCompensation), handlers.UpdateReimbursementCategory(db))
+		adminGroup.GET("/loans", middlewares.Authorize(db, rbac.PermManageLoans), handlers.ListLoans(db))
+		adminGroup.POST("/loans", middlewares.Authorize(db, rbac.PermManageLoans), handlers.CreateLoan(db))
+		adminGroup.GET("/loans/:loan_id", middlewares.Authorize(db, rbac.PermManageLoans), handlers.GetLoan(db))
+		adminGroup.POST("/loans/:loan_id/payoff", middlewares.Authorize(db, rbac.PermManageLoans), handlers.PayOffLoan(db))
+		adminGroup.POST("/loans/:loan_id/skips", middlewares.Authorize(db, rbac.PermManageLoans), handlers.SkipLoanInstallment(db))
+		adminGroup.GET("/holidays", middlewares.Authorize(db, rbac.PermManageHolidays), handlers.ListHolidays(db))
+		adminGroup.POST("/holidays", middlewares.Authorize(db, rbac.PermManageHolidays), handlers.CreateHoliday(db))
+		adminGroup.POST("/holidays/import", middlewares.Authorize(db, rbac.PermManageHolidays), handlers.ImportHolidays(db))
+		adminGroup.DELETE("/holidays/:date", middlewares.Authorize(db, rbac.PermManageHolidays), handlers.DeleteHoliday(db))
+		adminGroup.GET("/service-accounts", middlewares.Authorize(db, rbac.PermManageServiceAccounts), handlers.ListServiceAccounts(db))
+		adminGroup.POST("/service-accounts", middlewares.Authorize(db, rbac.PermManageServiceAccounts), handlers.CreateServiceAccount(db))
+		adminGroup.GET("/service-accounts/:account_id/keys", middlewares.Authorize(db, rbac.PermManageServiceAccounts), handlers.ListAPIKeys(db))
+		adminGroup.POST("/service-accounts/:account_id/keys", middlewares.Authorize(db, rbac.PermManageServiceAccounts), handlers.CreateAPIKey(db))
+		adminGroup.DELETE("/service-accounts/:account_id/keys/:key_id", middlewares.Authorize(db, rbac.PermManageServiceAccounts), handlers.RevokeAPIKey(db))
+		adminGroup.GET("/users/:user_id/sessions", middlewares.Authorize(db, rbac.PermManageSessions), handlers.ListUserSessions(db))
+		adminGroup.DELETE("/users/:user_id/sessions/:session_id", middlewares.Authorize(db, rbac.PermManageSessions), handlers.TerminateUserSession(db))
+		adminGroup.POST("/users/:user_id/revoke-sessions", middlewares.Authorize(db, rbac.PermManageSessions), handlers.RevokeUserSessions(db))
+		adminGroup.POST("/users/:user_id/unlock", middlewares.Authorize(db, rbac.PermManageUsers), handlers.UnlockUser(db))
+		adminGroup.POST("/users/:user_id/reset-password", middlewares.Authorize(db, rbac.PermManageUsers), handlers.CreatePasswordReset(db))
 	}
 
 	//employee routes
 	employeeGroup := api.Group("/employee")
+	employeeGroup.Use(middlewares.RequireFullAccess())
+	{
+		employeeGroup.POST("/attendance", middlewares.Authorize(db, rbac.PermSubmitAttendance), handlers.SubmitAttendance(db))
+		employeeGroup.POST("/overtime", middlewares.Authorize(db, rbac.PermSubmitOvertime), handlers.SubmitOvertime(db))
+		employeeGroup.GET("/overtime", middlewares.Authorize(db, rbac.PermViewOwnOvertime), handlers.ListMyOvertime(db))
+		employeeGroup.POST("/reimbursement", middlewares.Authorize(db, rbac.PermSubmitReimbursement), handlers.SubmitReimbursement(db))
+		employeeGroup.GET("/reimbursement", middlewares.Authorize(db, rbac.PermViewOwnReimbursement), handlers.ListMyReimbursements(db))
+		employeeGroup.POST("/reimbursement/:reimbursement_id/receipts", middlewares.Authorize(db, rbac.PermSubmitReimbursement), handlers.UploadReceipts(db, receiptStore))
+		employeeGroup.GET("/reimbursement-categories", middlewares.Authorize(db, rbac.PermSubmitReimbursement), handlers.ListActiveReimbursementCategories(db))
+		employeeGroup.GET("/payslip/:period_id", middlewares.Authorize(db, rbac.PermViewOwnPayslip), handlers.GetEmployeePayslip(db))
+		employeeGroup.GET("/loans", middlewares.Authorize(db, rbac.PermViewOwnLoans), handlers.ListMyLoans(db))
+	}
+
+	//receipt routes, open to the owner of the reimbursement and the approvers, which the handlers check
+	receiptGroup := api.Group("/reimbursements/:reimbursement_id/receipts")
+	receiptGroup.Use(middlewares.RequireFullAccess())
 	{
-		employeeGroup.POST("/attendance", handlers.SubmitAttendance(db))
-		employeeGroup.POST("/overtime", handlers.SubmitOvertime(db))
-		employeeGroup.POST("/reimbursement", handlers.SubmitReimbursement(db))
-		employeeGroup.GET("/payslip/:period_id", handlers.GetEmployeePayslip(db))
+		receiptGroup.GET("", middlewares.Authorize(db, rbac.PermViewOwnReimbursement), handlers.ListReceipts(db))
+		receiptGroup.GET("/:receipt_id", middlewares.Authorize(db, rbac.PermViewOwnReimbursement), handlers.DownloadReceipt(db, receiptStore))
 	}
 
 	port := config.Port
@@ -3,13 +3,17 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
 	"github.com/joho/godotenv"
 )
 
 var (
 	AppEnv     string
-	JwtSecret  string
 	DBUser     string
 	DBPassword string
 	DBName     string
@@ -17,6 +21,44 @@ var (
 	DBPort     string
 	DBSSLMode  string
 	Port       string
+
+	TrustedProxies []string // addresses or CIDRs allowed to set the client IP in X-Forwarded-For, none by default
+
+	JwtKeyDir    string
+	JwtActiveKID string
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	LoginBackoffThreshold  int
+	LoginBackoffBase       time.Duration
+	LoginMaxFailedAttempts int
+	LoginLockoutDuration   time.Duration
+	LoginMaxIPFailures     int
+	LoginIPWindow          time.Duration
+
+	PasswordMinLength int
+	PasswordHistory   int
+	PasswordResetTTL  time.Duration
+
+	TOTPIssuer      string
+	RequireAdminMFA bool
+	MFATokenTTL     time.Duration
+
+	APIKeySignatureWindow time.Duration
+
+	PeriodOverrideTTL time.Duration
+
+	MoneyRounding money.Rounding
+
+	TaxRules *payroll.TaxRules // nil disables income tax withholding
+
+	Contributions []payroll.Contribution // empty disables social security contributions
+
+	OvertimePolicy = payroll.DefaultOvertimePolicy() // applies to levels without a policy of their own
+
+	ReceiptDir     string
+	ReceiptMaxSize int64 = 5 << 20 // bytes, per file
 )
 
 // LoadConfig load environment variables into memory
@@ -27,7 +69,8 @@ func LoadConfig() {
 	}
 
 	AppEnv = getEnv("APP_ENV", "development")
-	JwtSecret = getEnv("JWT_SECRET", "")
+	JwtKeyDir = getEnv("JWT_KEY_DIR", "keys")
+	JwtActiveKID = getEnv("JWT_ACTIVE_KID", "")
 	DBUser = getEnv("DB_USER", "")
 	DBPassword = getEnv("DB_PASSWORD", "")
 	DBName = getEnv("DB_NAME", "")
@@ -35,11 +78,62 @@ func LoadConfig() {
 	DBPort = getEnv("DB_PORT", "5432")
 	Port = getEnv("PORT", "8000")
 	DBSSLMode = getEnv("DB_SSLMODE", "disable")
+	TrustedProxies = getEnvList("TRUSTED_PROXIES")
+	AccessTokenTTL = getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	RefreshTokenTTL = getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour)
+	LoginBackoffThreshold = getEnvInt("LOGIN_BACKOFF_THRESHOLD", 3)
+	LoginBackoffBase = getEnvDuration("LOGIN_BACKOFF_BASE", 2*time.Second)
+	LoginMaxFailedAttempts = getEnvInt("LOGIN_MAX_FAILED_ATTEMPTS", 5)
+	LoginLockoutDuration = getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	LoginMaxIPFailures = getEnvInt("LOGIN_MAX_IP_FAILURES", 20)
+	LoginIPWindow = getEnvDuration("LOGIN_IP_WINDOW", 15*time.Minute)
+	PasswordMinLength = getEnvInt("PASSWORD_MIN_LENGTH", 8)
+	PasswordHistory = getEnvInt("PASSWORD_HISTORY", 5)
+	PasswordResetTTL = getEnvDuration("PASSWORD_RESET_TTL", 24*time.Hour)
+	TOTPIssuer = getEnv("TOTP_ISSUER", "Payroll")
+	RequireAdminMFA = getEnvBool("REQUIRE_ADMIN_2FA", false)
+	MFATokenTTL = getEnvDuration("MFA_TOKEN_TTL", 5*time.Minute)
+	APIKeySignatureWindow = getEnvDuration("API_KEY_SIGNATURE_WINDOW", 5*time.Minute)
+	PeriodOverrideTTL = getEnvDuration("PERIOD_OVERRIDE_TTL", 24*time.Hour)
+	ReceiptDir = getEnv("RECEIPT_DIR", "receipts")
+	ReceiptMaxSize = int64(getEnvInt("RECEIPT_MAX_SIZE", int(ReceiptMaxSize)))
 
-	//Some validation
-	if JwtSecret == "" {
-		log.Fatal("Missing JWT_SECRET value in .env file")
+	rounding, err := money.NewRounding(getEnv("MONEY_ROUNDING_MODE", "half_up"), getEnv("MONEY_MINOR_UNIT", "0.01"))
+	if err != nil {
+		log.Fatalf("Invalid money rounding: %v", err)
+	}
+	// payslip columns keep two decimals, a finer minor unit would be cut off when stored
+	if cents := money.MustParse("0.01"); !(money.Rounding{Mode: money.Down, MinorUnit: cents}).Round(rounding.MinorUnit).Equal(rounding.MinorUnit) {
+		log.Fatalf("MONEY_MINOR_UNIT must be a multiple of 0.01, got %s", rounding.MinorUnit)
+	}
+	MoneyRounding = rounding
+
+	if getEnvBool("TAX_WITHHOLDING", true) {
+		rules := payroll.DefaultTaxRules()
+		if path := getEnv("TAX_RULES_FILE", ""); path != "" {
+			if rules, err = payroll.LoadTaxRules(path); err != nil {
+				log.Fatalf("Invalid tax rules in %s: %v", path, err)
+			}
+		}
+		TaxRules = &rules
+	}
+
+	if getEnvBool("CONTRIBUTIONS_ENABLED", true) {
+		Contributions = payroll.DefaultContributions()
+		if path := getEnv("CONTRIBUTIONS_FILE", ""); path != "" {
+			if Contributions, err = payroll.LoadContributions(path); err != nil {
+				log.Fatalf("Invalid contributions in %s: %v", path, err)
+			}
+		}
 	}
+
+	if path := getEnv("OVERTIME_POLICY_FILE", ""); path != "" {
+		if OvertimePolicy, err = payroll.LoadOvertimePolicy(path); err != nil {
+			log.Fatalf("Invalid overtime policy in %s: %v", path, err)
+		}
+	}
+
+	//Some validation
 	if DBUser == "" || DBPassword == "" || DBName == "" {
 		log.Fatal("Missing database details and credentials in .env file")
 	}
@@ -51,3 +145,50 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma separated variable, it is nil when the variable is unset
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid duration for %s: %v", key, err)
+	}
+	return d
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid integer for %s: %v", key, err)
+	}
+	return n
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid boolean for %s: %v", key, err)
+	}
+	return b
+}
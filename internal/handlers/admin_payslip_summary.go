@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/chafid/payroll-project/internal/money"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,13 +12,24 @@ func GetPayslipSummaryForAdmin(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		periodID := c.Param("period_id")
 
+		var runID, status string
+		err := db.QueryRow(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = $1`, periodID).Scan(&runID, &status)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payroll has not been run for this period"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payroll run"})
+			return
+		}
+
 		rows, err := db.Query(`
-			SELECT u.username, u.id, p.total_take_home
+			SELECT u.username, u.id, p.total_earnings, p.tax_amount, p.employee_contributions, p.employer_contributions, p.total_take_home
 			FROM payslips p
 			JOIN users u ON p.user_id = u.id
-			WHERE p.attendance_periods_id = $1
+			WHERE p.payroll_run_id = $1
 			ORDER BY u.username
-		`, periodID)
+		`, runID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payslip summary"})
 			return
@@ -25,27 +37,79 @@ func GetPayslipSummaryForAdmin(db *sql.DB) gin.HandlerFunc {
 		defer rows.Close()
 
 		type EmployeeSummary struct {
-			Username string  `json:"username"`
-			UserID   string  `json:"user_id"`
-			TotalPay float64 `json:"total_take_home"`
+			Username string        `json:"username"`
+			UserID   string        `json:"user_id"`
+			Earnings money.Decimal `json:"total_earnings"`
+			Tax      money.Decimal `json:"tax_amount"`
+			Employee money.Decimal `json:"employee_contributions"`
+			Employer money.Decimal `json:"employer_contributions"`
+			TotalPay money.Decimal `json:"total_take_home"`
 		}
 
 		var summary []EmployeeSummary
-		var grandTotal float64
+		grandTotal := money.Zero
+		totalEarnings := money.Zero
+		totalTax := money.Zero
+		totalEmployee := money.Zero
+		totalEmployer := money.Zero
 
 		for rows.Next() {
 			var emp EmployeeSummary
-			if err := rows.Scan(&emp.Username, &emp.UserID, &emp.TotalPay); err != nil {
+			if err := rows.Scan(&emp.Username, &emp.UserID, &emp.Earnings, &emp.Tax, &emp.Employee, &emp.Employer, &emp.TotalPay); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan result"})
 				return
 			}
-			grandTotal += emp.TotalPay
+			grandTotal = grandTotal.Add(emp.TotalPay)
+			totalEarnings = totalEarnings.Add(emp.Earnings)
+			totalTax = totalTax.Add(emp.Tax)
+			totalEmployee = totalEmployee.Add(emp.Employee)
+			totalEmployer = totalEmployer.Add(emp.Employer)
 			summary = append(summary, emp)
 		}
 
+		//per program totals, what the company owes each fund
+		programRows, err := db.Query(`
+			SELECT pc.code, pc.label, SUM(pc.employee_amount), SUM(pc.employer_amount)
+			FROM payslip_contributions pc
+			JOIN payslips p ON p.id = pc.payslip_id
+			WHERE p.payroll_run_id = $1
+			GROUP BY pc.code, pc.label
+			ORDER BY pc.code
+		`, runID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contribution summary"})
+			return
+		}
+		defer programRows.Close()
+
+		type ProgramSummary struct {
+			Code     string        `json:"code"`
+			Label    string        `json:"label"`
+			Employee money.Decimal `json:"employee_amount"`
+			Employer money.Decimal `json:"employer_amount"`
+		}
+		programs := []ProgramSummary{}
+		for programRows.Next() {
+			var p ProgramSummary
+			if err := programRows.Scan(&p.Code, &p.Label, &p.Employee, &p.Employer); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan result"})
+				return
+			}
+			programs = append(programs, p)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
+			"run_id":      runID,
+			"status":      status,
 			"employees":   summary,
 			"grand_total": grandTotal,
+			"total_tax":   totalTax,
+
+			"total_employee_contributions": totalEmployee,
+			"total_employer_contributions": totalEmployer,
+			"contributions":                programs,
+			//gross pay plus what the company pays on top of it; deductions such as loan installments don't lower it
+			"total_employer_cost": totalEarnings.Add(totalEmployer),
 		})
 	}
 }
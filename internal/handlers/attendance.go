@@ -34,7 +34,7 @@ func SubmitAttendance(db *sql.DB) gin.HandlerFunc {
 		}
 
 		//check for weekend
-		if attendanceDate.Weekday() == time.Saturday || attendanceDate.Weekday() == time.Sunday {
+		if utils.IsWeekend(attendanceDate) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot submit attendance on weekends"})
 			return
 		}
@@ -63,6 +63,18 @@ func SubmitAttendance(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Attendance date is not within the attendance period"})
 			return
 		}
+		holidays, err := loadHolidays(db, attendanceDate, attendanceDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holidays"})
+			return
+		}
+		if name, ok := holidays.Name(attendanceDate); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot submit attendance on a holiday (" + name + ")"})
+			return
+		}
+		if rejectLockedPeriod(c, db, userID, attendanceDate) {
+			return
+		}
 
 		ip := c.ClientIP()
 		attendanceID := uuid.New()
@@ -93,3 +105,131 @@ func SubmitAttendance(db *sql.DB) gin.HandlerFunc {
 
 	}
 }
+
+type AttendanceImportRecord struct {
+	UserID string `json:"user_id" binding:"required"`
+	Date   string `json:"date" binding:"required"` //format YYYY-MM-DD
+}
+
+type AttendanceImportRequest struct {
+	PeriodID string                   `json:"period_id" binding:"required"`
+	Records  []AttendanceImportRecord `json:"records" binding:"required,min=1,dive"`
+}
+
+// rejectedRecord explains why an imported record was not stored
+type rejectedRecord struct {
+	Index  int    `json:"index"`
+	UserID string `json:"user_id"`
+	Date   string `json:"date"`
+	Error  string `json:"error"`
+}
+
+// ImportAttendance stores attendance for many employees at once, e.g. pushed by a timeclock system.
+// Records that are invalid or already recorded are skipped and reported, the rest are stored.
+func ImportAttendance(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AttendanceImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		actor, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		var startDate, endDate time.Time
+		err := db.QueryRow(`SELECT start_date, end_date from attendance_periods WHERE id = $1`, req.PeriodID).Scan(&startDate, &endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period_id"})
+			return
+		}
+		holidays, err := loadHolidays(db, startDate, endDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holidays"})
+			return
+		}
+
+		ip := c.ClientIP()
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		imported := 0
+		rejected := []rejectedRecord{}
+		reject := func(i int, rec AttendanceImportRecord, msg string) {
+			rejected = append(rejected, rejectedRecord{Index: i, UserID: rec.UserID, Date: rec.Date, Error: msg})
+		}
+
+		for i, rec := range req.Records {
+			userID, err := uuid.Parse(rec.UserID)
+			if err != nil {
+				reject(i, rec, "Invalid user_id")
+				continue
+			}
+			attendanceDate, err := time.Parse("2006-01-02", rec.Date)
+			if err != nil {
+				reject(i, rec, "Invalid date format")
+				continue
+			}
+			if utils.IsWeekend(attendanceDate) {
+				reject(i, rec, "Cannot submit attendance on weekends")
+				continue
+			}
+			if name, ok := holidays.Name(attendanceDate); ok {
+				reject(i, rec, "Cannot submit attendance on a holiday ("+name+")")
+				continue
+			}
+			if attendanceDate.Before(startDate) || attendanceDate.After(endDate) {
+				reject(i, rec, "Attendance date is not within the attendance period")
+				continue
+			}
+			msg, err := periodLockError(db, userID, attendanceDate)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import attendance"})
+				return
+			}
+			if msg != "" {
+				reject(i, rec, msg)
+				continue
+			}
+
+			//only active employees get attendance, an existing row for the day is left untouched
+			res, err := tx.Exec(`
+				INSERT INTO attendances (id, user_id, date, period_id, created_by, updated_by, created_ip, updated_ip)
+				SELECT $1, u.id, $3, $4, $5, $5, $6, $6
+				FROM users u
+				WHERE u.id = $2 AND u.is_active AND u.role <> 'service'
+				ON CONFLICT (user_id, date) DO NOTHING
+			`, uuid.New(), userID, attendanceDate, req.PeriodID, actor, ip)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import attendance"})
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				reject(i, rec, "Unknown user or attendance already submitted for this date")
+				continue
+			}
+			imported++
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import attendance"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"period_id": req.PeriodID,
+			"received":  len(req.Records),
+			"imported":  imported,
+			"rejected":  len(rejected),
+		})
+		utils.LogAudit(db, "IMPORT", "attendance", req.PeriodID, actor, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"imported": imported, "rejected": rejected})
+	}
+}
@@ -2,10 +2,17 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/chafid/payroll-project/config"
 	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,33 +28,209 @@ func LoginHandler(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login input"})
 			return
 		}
+
+		ip := c.ClientIP()
+		if addressThrottled(c, db, ip) {
+			return
+		}
+
 		var id string
 		var hashedPassword string
 		var role string
+		var mustChangePassword, totpEnabled, isActive bool
+		var failedCount int
+		var lastFailedAt, lockedUntil sql.NullTime
 
 		err := db.QueryRow(`
-			SELECT id, password, role
+			SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active
 			FROM users
 			WHERE username = $1
-		`, req.Username).Scan(&id, &hashedPassword, &role)
+		`, req.Username).Scan(&id, &hashedPassword, &role, &mustChangePassword, &totpEnabled, &failedCount, &lastFailedAt, &lockedUntil, &isActive)
 
 		if err != nil {
+			recordLoginAttempt(db, req.Username, ip, false)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 			return
 		}
 
+		if loginBlocked(c, "Invalid username or password", failedCount, lastFailedAt, lockedUntil) {
+			recordLoginAttempt(db, req.Username, ip, false)
+			return
+		}
+
 		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+			recordLoginAttempt(db, req.Username, ip, false)
+			registerFailedLogin(db, id, req.Username, ip)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 			return
 		}
 
-		token, err := utils.GenerateJWT(id, role)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		//only tell a deactivated user so after the password proved who they are
+		if !isActive {
+			recordLoginAttempt(db, req.Username, ip, false)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"token": token})
+		//the failure counter is only reset once every step has passed, so it also guards the code step
+		if totpEnabled {
+			mfaToken, err := utils.GenerateMFAToken(id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": mfaToken})
+			return
+		}
+
+		completeLogin(c, db, id, req.Username, role, tokenRestriction(role, mustChangePassword, totpEnabled), failedCount > 0 || lockedUntil.Valid)
+	}
+
+}
+
+// addressThrottled responds with 429 when the address has been guessing across many usernames
+func addressThrottled(c *gin.Context, db *sql.DB, ip string) bool {
+	var ipFailures int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM login_attempts
+		WHERE ip_address = $1::inet AND NOT succeeded AND created_at > $2
+	`, ip, time.Now().Add(-config.LoginIPWindow)).Scan(&ipFailures)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if ipFailures >= config.LoginMaxIPFailures {
+		c.Header("Retry-After", strconv.Itoa(int(config.LoginIPWindow.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return true
+	}
+	return false
+}
+
+// loginBlocked keeps the credential from being checked while the account is locked or the progressive
+// backoff is running. A locked account gets the same 401 and failureMessage as a wrong credential, so
+// the response doesn't tell that the username exists; the backoff responds with 429.
+func loginBlocked(c *gin.Context, failureMessage string, failedCount int, lastFailedAt, lockedUntil sql.NullTime) bool {
+	now := time.Now()
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": failureMessage})
+		return true
+	}
+
+	wait := utils.LoginBackoff(failedCount, config.LoginBackoffThreshold, config.LoginBackoffBase, config.LoginLockoutDuration)
+	if wait > 0 && lastFailedAt.Valid && now.Before(lastFailedAt.Time.Add(wait)) {
+		c.Header("Retry-After", strconv.Itoa(int(lastFailedAt.Time.Add(wait).Sub(now).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return true
+	}
+	return false
+}
+
+// completeLogin records the successful login, clears the failure counter and responds with a token pair
+func completeLogin(c *gin.Context, db *sql.DB, userID, username, role, restriction string, resetCounter bool) {
+	ip := c.ClientIP()
+	recordLoginAttempt(db, username, ip, true)
+	if resetCounter {
+		if _, err := db.Exec(`
+			UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+			WHERE id = $1
+		`, userID); err != nil {
+			log.Printf("[Login] Failed to reset failed login counter: %v\n", err)
+		}
+	}
+
+	tokens, err := startSessionWithTokens(db, c, userID, role, restriction)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// recordLoginAttempt keeps a per-username and per-address trail of login attempts
+func recordLoginAttempt(db *sql.DB, username, ip string, succeeded bool) {
+	_, err := db.Exec(`
+		INSERT INTO login_attempts (username, ip_address, succeeded) VALUES ($1, $2::inet, $3)
+	`, username, ip, succeeded)
+	if err != nil {
+		log.Printf("[Login] Failed to record login attempt: %v\n", err)
+	}
+}
+
+// registerFailedLogin bumps the user's failure counter, locks the account once the limit is reached
+// and writes both events to the audit log. The counter restarts after an expired lockout, so the
+// account gets the full number of attempts again instead of being locked by the next failure.
+func registerFailedLogin(db *sql.DB, userID, username, ip string) {
+	var failedCount int
+	var lockedUntil sql.NullTime
+	err := db.QueryRow(`
+		UPDATE users SET
+			failed_login_count = CASE WHEN locked_until <= now() THEN 0 ELSE failed_login_count END + 1,
+			last_failed_login_at = now(),
+			locked_until = CASE WHEN CASE WHEN locked_until <= now() THEN 0 ELSE failed_login_count END + 1 >= $2
+				THEN now() + $3 * interval '1 second' ELSE NULL END
+		WHERE id = $1
+		RETURNING failed_login_count, locked_until
+	`, userID, config.LoginMaxFailedAttempts, config.LoginLockoutDuration.Seconds()).Scan(&failedCount, &lockedUntil)
+	if err != nil {
+		log.Printf("[Login] Failed to update failed login counter: %v\n", err)
+		return
+	}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return
 	}
+	changeData, _ := json.Marshal(map[string]interface{}{
+		"username":           username,
+		"failed_login_count": failedCount,
+	})
+	utils.LogAudit(db, "LOGIN_FAILED", "users", userID, uid, net.ParseIP(ip), changeData)
+
+	if lockedUntil.Valid {
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"username":     username,
+			"locked_until": lockedUntil.Time,
+		})
+		utils.LogAudit(db, "LOCKOUT", "users", userID, uid, net.ParseIP(ip), changeData)
+	}
+}
+
+// UnlockUser clears a lockout and the failed login counter of a user
+func UnlockUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
 
+		adminID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+			return
+		}
+		if !canManageUser(c, db, targetID) {
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL,
+				updated_at = now(), updated_by = $2
+			WHERE id = $1
+		`, targetID, adminID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		utils.LogAudit(db, "UNLOCK", "users", targetID.String(), adminID, net.ParseIP(c.ClientIP()), []byte(`{}`))
+
+		c.JSON(http.StatusOK, gin.H{"message": "User has been unlocked"})
+	}
 }
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var allowanceCodePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+type AllowanceRequest struct {
+	Code      string        `json:"code" binding:"required"` //e.g. MEAL, TRANSPORT
+	Label     string        `json:"label" binding:"required"`
+	Amount    money.Decimal `json:"amount"`
+	Taxable   *bool         `json:"taxable"`  //defaults to true
+	LevelID   *string       `json:"level_id"` //either level_id or user_id
+	UserID    *string       `json:"user_id"`
+	StartDate string        `json:"start_date" binding:"required"` //format YYYY-MM-DD
+	EndDate   *string       `json:"end_date"`                      //format YYYY-MM-DD, open ended when omitted
+}
+
+type EndAllowanceRequest struct {
+	EndDate string `json:"end_date" binding:"required"` //format YYYY-MM-DD
+}
+
+type BonusRequest struct {
+	UserID  string        `json:"user_id" binding:"required"`
+	Label   string        `json:"label" binding:"required"`
+	Amount  money.Decimal `json:"amount"`
+	Taxable *bool         `json:"taxable"` //defaults to true
+}
+
+// parseOptionalUUID parses an optional id, nil stays nil
+func parseOptionalUUID(s *string) (*uuid.UUID, error) {
+	if s == nil {
+		return nil, nil
+	}
+	id, err := uuid.Parse(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// ListAllowances returns allowances, optionally only those of a level or of an employee
+func ListAllowances(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := `
+			SELECT id, code, label, amount, taxable, level_id, user_id, start_date, end_date, created_at
+			FROM allowances
+		`
+		var conditions []string
+		var args []interface{}
+		for _, filter := range []string{"level_id", "user_id"} {
+			value := c.Query(filter)
+			if value == "" {
+				continue
+			}
+			if _, err := uuid.Parse(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + filter})
+				return
+			}
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", filter, len(args)))
+		}
+		if len(conditions) > 0 {
+			query += ` WHERE ` + strings.Join(conditions, " AND ")
+		}
+		query += ` ORDER BY code, start_date DESC`
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch allowances"})
+			return
+		}
+		defer rows.Close()
+
+		allowances := []models.Allowance{}
+		for rows.Next() {
+			var a models.Allowance
+			var startDate time.Time
+			var endDate sql.NullTime
+			err := rows.Scan(&a.ID, &a.Code, &a.Label, &a.Amount, &a.Taxable, &a.LevelID, &a.UserID, &startDate, &endDate, &a.CreatedAt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan allowance"})
+				return
+			}
+			a.StartDate = startDate.Format("2006-01-02")
+			if endDate.Valid {
+				date := endDate.Time.Format("2006-01-02")
+				a.EndDate = &date
+			}
+			allowances = append(allowances, a)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"allowances": allowances})
+	}
+}
+
+// CreateAllowance assigns a recurring monthly allowance to a level or to one employee
+func CreateAllowance(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AllowanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		req.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+		if !allowanceCodePattern.MatchString(req.Code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code must be letters, digits and underscores, e.g. MEAL"})
+			return
+		}
+		if !req.Amount.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+			return
+		}
+		if (req.LevelID == nil) == (req.UserID == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Either level_id or user_id is required"})
+			return
+		}
+		levelID, err := parseOptionalUUID(req.LevelID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid level_id"})
+			return
+		}
+		userID, err := parseOptionalUUID(req.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		startDate, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+			return
+		}
+		var endDate *time.Time
+		if req.EndDate != nil {
+			d, err := time.Parse("2006-01-02", *req.EndDate)
+			if err != nil || d.Before(startDate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be a date on or after start_date"})
+				return
+			}
+			endDate = &d
+		}
+		taxable := req.Taxable == nil || *req.Taxable
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		//the target must exist and allowances are not paid to service accounts
+		var exists bool
+		if levelID != nil {
+			err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM employee_levels WHERE id = $1)`, levelID).Scan(&exists)
+		} else {
+			err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role <> 'service')`, userID).Scan(&exists)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Level or user not found"})
+			return
+		}
+
+		ip := c.ClientIP()
+		allowanceID := uuid.New()
+		_, err = db.Exec(`
+			INSERT INTO allowances (id, code, label, amount, taxable, level_id, user_id, start_date, end_date,
+				created_by, updated_by, created_ip, updated_ip)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $11, $11)
+		`, allowanceID, req.Code, req.Label, req.Amount, taxable, levelID, userID, startDate, endDate, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create allowance"})
+			return
+		}
+
+		req.Taxable = &taxable
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "INSERT", "allowances", allowanceID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": allowanceID, "message": "Allowance created successfully"})
+	}
+}
+
+// EndAllowance stops an allowance after a date. Amounts are never edited: a new amount is a new allowance,
+// so payslips of earlier periods keep matching the allowances that applied then.
+func EndAllowance(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowanceID, err := uuid.Parse(c.Param("allowance_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid allowance_id"})
+			return
+		}
+
+		var req EndAllowanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date is required"})
+			return
+		}
+		endDate, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		ip := c.ClientIP()
+		res, err := db.Exec(`
+			UPDATE allowances
+			SET end_date = $2, updated_at = now(), updated_by = $3, updated_ip = $4
+			WHERE id = $1 AND start_date <= $2
+		`, allowanceID, endDate, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end allowance"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Allowance not found or end_date before its start_date"})
+			return
+		}
+
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "UPDATE", "allowances", allowanceID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Allowance ended"})
+	}
+}
+
+// rejectFinalizedPeriod responds when the period does not exist (404) or its payroll run is finalized (409)
+// and reports whether it did
+func rejectFinalizedPeriod(c *gin.Context, db *sql.DB, periodID string) bool {
+	var runStatus sql.NullString
+	err := db.QueryRow(`
+		SELECT r.status
+		FROM attendance_periods ap
+		LEFT JOIN payroll_runs r ON r.attendance_periods_id = ap.id
+		WHERE ap.id = $1
+	`, periodID).Scan(&runStatus)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attendance period not found"})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if runStatus.String == models.PayrollRunFinalized {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payroll for this period has been finalized and can no longer be changed"})
+		return true
+	}
+	return false
+}
+
+// ListBonuses returns the bonuses paid with a period
+func ListBonuses(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Query(`
+			SELECT id, user_id, attendance_periods_id, label, amount, taxable, created_at
+			FROM bonuses
+			WHERE attendance_periods_id = $1
+			ORDER BY created_at
+		`, c.Param("period_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bonuses"})
+			return
+		}
+		defer rows.Close()
+
+		bonuses := []models.Bonus{}
+		for rows.Next() {
+			var b models.Bonus
+			if err := rows.Scan(&b.ID, &b.UserID, &b.PeriodID, &b.Label, &b.Amount, &b.Taxable, &b.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan bonus"})
+				return
+			}
+			bonuses = append(bonuses, b)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"bonuses": bonuses})
+	}
+}
+
+// CreateBonus grants a one-off bonus paid with the payslip of a period. A draft run picks it up when re-run.
+func CreateBonus(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		periodID := c.Param("period_id")
+
+		var req BonusRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		userID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		if !req.Amount.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+			return
+		}
+		taxable := req.Taxable == nil || *req.Taxable
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		if rejectFinalizedPeriod(c, db, periodID) {
+			return
+		}
+
+		ip := c.ClientIP()
+		bonusID := uuid.New()
+		res, err := db.Exec(`
+			INSERT INTO bonuses (id, user_id, attendance_periods_id, label, amount, taxable, created_by, created_ip)
+			SELECT $1, u.id, $3, $4, $5, $6, $7, $8 FROM users u WHERE u.id = $2 AND u.role <> 'service'
+		`, bonusID, userID, periodID, req.Label, req.Amount, taxable, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bonus"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"period_id": periodID,
+			"user_id":   userID,
+			"label":     req.Label,
+			"amount":    req.Amount,
+			"taxable":   taxable,
+		})
+		utils.LogAudit(db, "INSERT", "bonuses", bonusID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": bonusID, "message": "Bonus created successfully"})
+	}
+}
+
+// DeleteBonus removes a bonus that hasn't been paid with a finalized run
+func DeleteBonus(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bonusID, err := uuid.Parse(c.Param("bonus_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bonus_id"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		var periodID string
+		err = db.QueryRow(`SELECT attendance_periods_id FROM bonuses WHERE id = $1`, bonusID).Scan(&periodID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bonus not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if rejectFinalizedPeriod(c, db, periodID) {
+			return
+		}
+
+		if _, err := db.Exec(`DELETE FROM bonuses WHERE id = $1`, bonusID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bonus"})
+			return
+		}
+
+		ip := c.ClientIP()
+		changeData, _ := json.Marshal(map[string]string{"period_id": periodID})
+		utils.LogAudit(db, "DELETE", "bonuses", bonusID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Bonus deleted"})
+	}
+}
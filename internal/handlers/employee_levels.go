@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CreateLevelRequest struct {
+	Name          string        `json:"name" binding:"required"`
+	BaseSalary    money.Decimal `json:"base_salary"`
+	EffectiveFrom string        `json:"effective_from" binding:"required"` //format YYYY-MM-DD
+}
+
+type LevelSalaryRequest struct {
+	BaseSalary    money.Decimal `json:"base_salary"`
+	EffectiveFrom string        `json:"effective_from" binding:"required"` //format YYYY-MM-DD
+}
+
+// ListEmployeeLevels returns every level with the salary in force today
+func ListEmployeeLevels(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Query(`
+			SELECT l.id, l.name, s.base_salary, s.effective_from
+			FROM employee_levels l
+			LEFT JOIN LATERAL (
+				SELECT base_salary, effective_from
+				FROM employee_level_salaries
+				WHERE level_id = l.id AND effective_from <= CURRENT_DATE
+				ORDER BY effective_from DESC
+				LIMIT 1
+			) s ON true
+			ORDER BY l.name
+		`)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch levels"})
+			return
+		}
+		defer rows.Close()
+
+		levels := []models.EmployeeLevel{}
+		for rows.Next() {
+			var level models.EmployeeLevel
+			var effectiveFrom sql.NullTime
+			if err := rows.Scan(&level.ID, &level.Name, &level.CurrentSalary, &effectiveFrom); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan level"})
+				return
+			}
+			if effectiveFrom.Valid {
+				date := effectiveFrom.Time.Format("2006-01-02")
+				level.CurrentSalaryEffective = &date
+			}
+			levels = append(levels, level)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"levels": levels})
+	}
+}
+
+// CreateEmployeeLevel creates a level together with its first salary row
+func CreateEmployeeLevel(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if !req.BaseSalary.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base_salary must be greater than 0"})
+			return
+		}
+
+		effectiveFrom, err := time.Parse("2006-01-02", req.EffectiveFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective_from date format"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		ip := c.ClientIP()
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		levelID := uuid.New()
+		_, err = tx.Exec(`
+			INSERT INTO employee_levels (id, name, created_by) VALUES ($1, $2, $3)
+		`, levelID, req.Name, adminID)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Level name already exists"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create level"})
+			}
+			return
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO employee_level_salaries (level_id, base_salary, effective_from, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5)
+		`, levelID, req.BaseSalary, effectiveFrom, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create level salary"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create level"})
+			return
+		}
+
+		changeData, err := json.Marshal(req)
+		if err != nil {
+			changeData = []byte(`{}`)
+		}
+		utils.LogAudit(db, "INSERT", "employee_levels", levelID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": levelID, "message": "Level created successfully"})
+	}
+}
+
+// ListLevelSalaries returns the salary history of a level, newest first
+func ListLevelSalaries(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		levelID, err := uuid.Parse(c.Param("level_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid level_id"})
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, level_id, base_salary, effective_from, created_at
+			FROM employee_level_salaries
+			WHERE level_id = $1
+			ORDER BY effective_from DESC
+		`, levelID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch salaries"})
+			return
+		}
+		defer rows.Close()
+
+		salaries := []models.LevelSalary{}
+		for rows.Next() {
+			var s models.LevelSalary
+			var effectiveFrom time.Time
+			if err := rows.Scan(&s.ID, &s.LevelID, &s.BaseSalary, &effectiveFrom, &s.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan salary"})
+				return
+			}
+			s.EffectiveFrom = effectiveFrom.Format("2006-01-02")
+			salaries = append(salaries, s)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"salaries": salaries})
+	}
+}
+
+// AddLevelSalary records a new salary for a level from a given date. Earlier rows are kept
+// so payroll for past periods keeps using the salary that applied then.
+func AddLevelSalary(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		levelID, err := uuid.Parse(c.Param("level_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid level_id"})
+			return
+		}
+
+		var req LevelSalaryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if !req.BaseSalary.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base_salary must be greater than 0"})
+			return
+		}
+
+		effectiveFrom, err := time.Parse("2006-01-02", req.EffectiveFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective_from date format"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		ip := c.ClientIP()
+
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM employee_levels WHERE id = $1)`, levelID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Level not found"})
+			return
+		}
+
+		salaryID := uuid.New()
+		_, err = db.Exec(`
+			INSERT INTO employee_level_salaries (id, level_id, base_salary, effective_from, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, salaryID, levelID, req.BaseSalary, effectiveFrom, adminID, ip)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "A salary is already effective from this date for the level"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add salary"})
+			}
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"level_id":       levelID,
+			"base_salary":    req.BaseSalary,
+			"effective_from": req.EffectiveFrom,
+		})
+		utils.LogAudit(db, "INSERT", "employee_level_salaries", salaryID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": salaryID, "message": "Salary added successfully"})
+	}
+}
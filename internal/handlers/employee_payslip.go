@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/payroll"
 	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -16,19 +17,23 @@ func GetEmployeePayslip(db *sql.DB) gin.HandlerFunc {
 		periodID := c.Param("period_id")
 
 		var payslip models.Payslip
+		var workingDays int
 
 		err := db.QueryRow(`
 			SELECT p.id, p.user_id, u.username, p.attendance_periods_id, p.base_salary, p.attendance_amount,
-				p.attendance_days, p.overtime_hours, p.overtime_amount, p.reimbursement_amount, p.total_take_home,
-				p.created_at
+				p.attendance_days, p.working_days, p.overtime_hours, p.overtime_amount, p.reimbursement_amount, p.tax_amount, p.tax_status,
+				p.employee_contributions, p.employer_contributions, p.total_earnings, p.total_deductions, p.total_take_home, p.created_at
 			FROM payslips p
 			JOIN users u ON p.user_id = u.id
+			JOIN payroll_runs r ON r.id = p.payroll_run_id AND r.status = 'finalized'
 			WHERE p.user_id = $1 AND p.attendance_periods_id = $2
 		`, userID, periodID).Scan(
 			&payslip.ID, &payslip.UserID, &payslip.Username, &payslip.AttendancePeriodID,
-			&payslip.BaseSalary, &payslip.AttendanceAmount, &payslip.AttendanceDays,
+			&payslip.BaseSalary, &payslip.AttendanceAmount, &payslip.AttendanceDays, &workingDays,
 			&payslip.OvertimeHours, &payslip.OvertimeAmount, &payslip.ReimbursementAmount,
-			&payslip.TotalTakeHome, &payslip.CreatedAt,
+			&payslip.TaxAmount, &payslip.TaxStatus,
+			&payslip.EmployeeContributions, &payslip.EmployerContributions,
+			&payslip.TotalEarnings, &payslip.TotalDeductions, &payslip.TotalTakeHome, &payslip.CreatedAt,
 		)
 
 		if err != nil {
@@ -40,17 +45,7 @@ func GetEmployeePayslip(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		var baseSalary float64
-		err = db.QueryRow(`
-			SELECT l.base_salary FROM employee_levels l
-			JOIN users u ON u.level_id = l.id WHERE u.id = $1
-		`, userID).Scan(&baseSalary)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch level salary"})
-			return
-		}
-
-		// Step 2.1: Fetch attendance period date range
+		// Fetch attendance period date range
 		var periodStart, periodEnd time.Time
 		err = db.QueryRow(`
 			SELECT start_date, end_date FROM attendance_periods WHERE id = $1
@@ -60,16 +55,36 @@ func GetEmployeePayslip(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		workingDays := utils.CountWorkingDays(periodStart, periodEnd)
+		holidays, err := loadHolidays(db, periodStart, periodEnd)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holidays"})
+			return
+		}
+		periodWorkingDays := utils.CountWorkingDays(periodStart, periodEnd, holidays)
 
-		hourlyRate := baseSalary / (float64(workingDays) * 8)
-		overtimeRate := hourlyRate * 2
+		//explain the payslip with the same calculator the payroll run used, fed with the stored inputs.
+		//Tax, contributions and overtime are read from the payslip as paid, the rules and the overtime policy
+		//may have changed since the run.
+		calc := newCalculator()
+		calc.Tax = nil
+		calc.Contributions = nil
+		result, err := calc.Calculate(payroll.Input{
+			BaseSalary:        payslip.BaseSalary,
+			WorkingDays:       workingDays,
+			PeriodWorkingDays: periodWorkingDays,
+			AttendanceDays:    payslip.AttendanceDays,
+			Reimbursements:    payslip.ReimbursementAmount,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate payslip breakdown"})
+			return
+		}
 
 		reimbursements := []models.Reimbursement{}
 		rows, err := db.Query(`
-			SELECT id, date, description, amount, created_at
+			SELECT id, category_code, date, description, amount, created_at
 			FROM reimbursements
-			WHERE user_id = $1 AND date BETWEEN $2 AND $3
+			WHERE user_id = $1 AND status = 'approved' AND date BETWEEN $2 AND $3
 		`, userID, periodStart, periodEnd)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reimbursements - " + err.Error()})
@@ -79,7 +94,7 @@ func GetEmployeePayslip(db *sql.DB) gin.HandlerFunc {
 
 		for rows.Next() {
 			var r models.Reimbursement
-			err := rows.Scan(&r.ID, &r.Date, &r.Description, &r.Amount, &r.SubmittedAt)
+			err := rows.Scan(&r.ID, &r.Category, &r.Date, &r.Description, &r.Amount, &r.SubmittedAt)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan reimbursement"})
 				return
@@ -87,29 +102,78 @@ func GetEmployeePayslip(db *sql.DB) gin.HandlerFunc {
 			reimbursements = append(reimbursements, r)
 		}
 
+		items := []models.PayslipItem{}
+		itemRows, err := db.Query(`
+			SELECT code, label, kind, quantity, rate, amount, taxable
+			FROM payslip_items
+			WHERE payslip_id = $1
+			ORDER BY position
+		`, payslip.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payslip items"})
+			return
+		}
+		defer itemRows.Close()
+
+		for itemRows.Next() {
+			var item models.PayslipItem
+			if err := itemRows.Scan(&item.Code, &item.Label, &item.Kind, &item.Quantity, &item.Rate, &item.Amount, &item.Taxable); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan payslip item"})
+				return
+			}
+			items = append(items, item)
+		}
+
+		contributions := []models.Contribution{}
+		contributionRows, err := db.Query(`
+			SELECT code, label, base, employee_amount, employer_amount
+			FROM payslip_contributions
+			WHERE payslip_id = $1
+			ORDER BY code
+		`, payslip.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contributions"})
+			return
+		}
+		defer contributionRows.Close()
+
+		for contributionRows.Next() {
+			var ct models.Contribution
+			if err := contributionRows.Scan(&ct.Code, &ct.Label, &ct.Base, &ct.EmployeeAmount, &ct.EmployerAmount); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan contribution"})
+				return
+			}
+			contributions = append(contributions, ct)
+		}
+
 		response := models.PayslipDetailResponse{
 			Payslip: payslip,
+			Items:   items,
 			Attendance: models.AttendanceBreakdown{
-				WorkingDays:      workingDays,
-				AttendanceDays:   payslip.AttendanceDays,
-				AttendanceAmount: payslip.AttendanceAmount,
+				WorkingDays:       workingDays,
+				PeriodWorkingDays: periodWorkingDays,
+				AttendanceDays:    payslip.AttendanceDays,
+				AttendanceAmount:  result.AttendanceAmount,
 			},
 			Overtime: models.OvertimeBreakdown{
-				OvertimeHours:  nullToZero(payslip.OvertimeHours),
-				HourlyRate:     hourlyRate,
-				OvertimeRate:   overtimeRate,
-				OvertimeAmount: nullToZero(payslip.OvertimeAmount),
+				OvertimeHours:  payslip.OvertimeHours,
+				HourlyRate:     result.HourlyRate,
+				OvertimeRate:   result.OvertimeRate,
+				OvertimeAmount: payslip.OvertimeAmount,
 			},
 			Reimbursements: reimbursements,
+			Deductions:     []models.Deduction{},
+			Contributions:  contributions,
+		}
+		for _, item := range items {
+			if item.Code == payroll.CodeOvertime {
+				response.Overtime.OvertimeRate = item.Rate
+			}
+			if item.Kind == string(payroll.KindDeduction) {
+				response.Deductions = append(response.Deductions, models.Deduction{Code: item.Code, Label: item.Label, Amount: item.Amount})
+			}
 		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
-
-func nullToZero(n sql.NullFloat64) float64 {
-	if n.Valid {
-		return n.Float64
-	}
-	return 0
-}
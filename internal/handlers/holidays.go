@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCalendarSize is the largest .ics file accepted by ImportHolidays
+const maxCalendarSize = 1 << 20
+
+type HolidayRequest struct {
+	Date string `json:"date" binding:"required"` //format YYYY-MM-DD
+	Name string `json:"name" binding:"required"`
+}
+
+// skippedHoliday explains why an imported holiday was not stored
+type skippedHoliday struct {
+	Date   string `json:"date"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// loadHolidays returns the holidays between two dates inclusive
+func loadHolidays(db *sql.DB, start, end time.Time) (utils.Holidays, error) {
+	rows, err := db.Query(`SELECT date, name FROM holidays WHERE date BETWEEN $1 AND $2`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := utils.Holidays{}
+	for rows.Next() {
+		var date time.Time
+		var name string
+		if err := rows.Scan(&date, &name); err != nil {
+			return nil, err
+		}
+		holidays[date.Format("2006-01-02")] = name
+	}
+	return holidays, rows.Err()
+}
+
+// inFinalizedPeriod tells whether date falls in a period whose payroll is finalized. Its payslips were
+// computed with the working days of the time, so the holidays of the period can no longer change.
+func inFinalizedPeriod(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, date time.Time) (bool, error) {
+	var finalized bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM attendance_periods ap
+			JOIN payroll_runs r ON r.attendance_periods_id = ap.id AND r.status = 'finalized'
+			WHERE $1 BETWEEN ap.start_date AND ap.end_date
+		)
+	`, date).Scan(&finalized)
+	return finalized, err
+}
+
+// ListHolidays returns the holidays, optionally of one year
+func ListHolidays(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := `SELECT date, name, created_at FROM holidays`
+		var args []interface{}
+		if year := c.Query("year"); year != "" {
+			y, err := strconv.Atoi(year)
+			if err != nil || y < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+				return
+			}
+			query += ` WHERE date BETWEEN $1 AND $2`
+			args = append(args, time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(y, 12, 31, 0, 0, 0, 0, time.UTC))
+		}
+
+		rows, err := db.Query(query+` ORDER BY date`, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holidays"})
+			return
+		}
+		defer rows.Close()
+
+		holidays := []models.Holiday{}
+		for rows.Next() {
+			var h models.Holiday
+			var date time.Time
+			if err := rows.Scan(&date, &h.Name, &h.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan holiday"})
+				return
+			}
+			h.Date = date.Format("2006-01-02")
+			holidays = append(holidays, h)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"holidays": holidays})
+	}
+}
+
+// CreateHoliday adds a public holiday
+func CreateHoliday(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req HolidayRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+			return
+		}
+		date, err := time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		finalized, err := inFinalizedPeriod(db, date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if finalized {
+			c.JSON(http.StatusConflict, gin.H{"error": "Payroll for this period has been finalized and can no longer be changed"})
+			return
+		}
+
+		ip := c.ClientIP()
+		_, err = db.Exec(`
+			INSERT INTO holidays (date, name, created_by, created_ip)
+			VALUES ($1, $2, $3, $4)
+		`, date, req.Name, adminID, ip)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "A holiday already exists on this date"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create holiday"})
+			}
+			return
+		}
+
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "INSERT", "holidays", req.Date, adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"date": req.Date, "name": req.Name})
+	}
+}
+
+// DeleteHoliday makes a day a working day again
+func DeleteHoliday(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date, err := time.Parse("2006-01-02", c.Param("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		finalized, err := inFinalizedPeriod(db, date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if finalized {
+			c.JSON(http.StatusConflict, gin.H{"error": "Payroll for this period has been finalized and can no longer be changed"})
+			return
+		}
+
+		var name string
+		err = db.QueryRow(`DELETE FROM holidays WHERE date = $1 RETURNING name`, date).Scan(&name)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Holiday not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete holiday"})
+			return
+		}
+
+		ip := c.ClientIP()
+		changeData, _ := json.Marshal(map[string]string{"name": name})
+		utils.LogAudit(db, "DELETE", "holidays", c.Param("date"), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Holiday deleted"})
+	}
+}
+
+// ImportHolidays adds the holidays of an uploaded iCalendar (.ics) file, e.g. a national holiday calendar.
+// Days that are already holidays or fall in a finalized period are skipped and reported.
+func ImportHolidays(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An .ics file is required in the file field"})
+			return
+		}
+		if header.Size > maxCalendarSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Calendar file is too large"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read calendar file"})
+			return
+		}
+		defer file.Close()
+
+		holidays, err := utils.ParseHolidayCalendar(file)
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidCalendar) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read calendar file"})
+			}
+			return
+		}
+
+		ip := c.ClientIP()
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		imported := 0
+		skipped := []skippedHoliday{}
+		for _, h := range holidays {
+			date := h.Date.Format("2006-01-02")
+			finalized, err := inFinalizedPeriod(tx, h.Date)
+			if err != nil {
+				log.Printf("[ImportHolidays] Failed to check period of %s: %v\n", date, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import holidays"})
+				return
+			}
+			if finalized {
+				skipped = append(skipped, skippedHoliday{Date: date, Name: h.Name, Reason: "Payroll for this period has been finalized"})
+				continue
+			}
+
+			res, err := tx.Exec(`
+				INSERT INTO holidays (date, name, created_by, created_ip)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (date) DO NOTHING
+			`, h.Date, h.Name, adminID, ip)
+			if err != nil {
+				log.Printf("[ImportHolidays] Failed to store %s: %v\n", date, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import holidays"})
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				skipped = append(skipped, skippedHoliday{Date: date, Name: h.Name, Reason: "A holiday already exists on this date"})
+				continue
+			}
+			imported++
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import holidays"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"file":     header.Filename,
+			"received": len(holidays),
+			"imported": imported,
+			"skipped":  len(skipped),
+		})
+		utils.LogAudit(db, "IMPORT", "holidays", header.Filename, adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"imported": imported, "skipped": skipped})
+	}
+}
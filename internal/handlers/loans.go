@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CreateLoanRequest struct {
+	UserID            string        `json:"user_id" binding:"required"`
+	Description       string        `json:"description" binding:"required"` //e.g. Salary advance
+	Principal         money.Decimal `json:"principal"`
+	InstallmentAmount money.Decimal `json:"installment_amount"`
+	StartDate         string        `json:"start_date" binding:"required"` //format YYYY-MM-DD, first installment in the period containing it
+}
+
+type SkipInstallmentRequest struct {
+	PeriodID string `json:"period_id" binding:"required"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+// the balance counts installments of draft runs too; re-running a draft deletes them with its payslips
+const loanSelect = `
+	SELECT l.id, l.user_id, l.description, l.principal, l.installment_amount, l.start_date, l.created_at,
+		COALESCE((SELECT SUM(amount) FROM loan_repayments WHERE loan_id = l.id), 0) AS repaid
+	FROM loans l
+`
+
+func scanLoan(row interface{ Scan(...interface{}) error }) (models.Loan, error) {
+	var l models.Loan
+	var startDate time.Time
+	err := row.Scan(&l.ID, &l.UserID, &l.Description, &l.Principal, &l.InstallmentAmount, &startDate, &l.CreatedAt, &l.Repaid)
+	if err != nil {
+		return l, err
+	}
+	l.StartDate = startDate.Format("2006-01-02")
+	l.Balance = l.Principal.Sub(l.Repaid)
+	l.Status = models.LoanActive
+	l.NextInstallment = l.InstallmentAmount
+	if l.Balance.Cmp(l.NextInstallment) < 0 {
+		l.NextInstallment = l.Balance
+	}
+	if !l.Balance.IsPositive() {
+		l.Status = models.LoanPaidOff
+	}
+	return l, nil
+}
+
+// listLoans responds with the loans matching the condition, newest first
+func listLoans(c *gin.Context, db *sql.DB, where string, args ...interface{}) {
+	rows, err := db.Query(loanSelect+where+` ORDER BY l.created_at DESC`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loans"})
+		return
+	}
+	defer rows.Close()
+
+	loans := []models.Loan{}
+	for rows.Next() {
+		l, err := scanLoan(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan loan"})
+			return
+		}
+		loans = append(loans, l)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loans": loans})
+}
+
+// ListLoans returns every loan, optionally only those of one employee
+func ListLoans(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := c.Query("user_id"); userID != "" {
+			if _, err := uuid.Parse(userID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+				return
+			}
+			listLoans(c, db, ` WHERE l.user_id = $1`, userID)
+			return
+		}
+		listLoans(c, db, "")
+	}
+}
+
+// ListMyLoans returns the loans of the authenticated employee with their balance
+func ListMyLoans(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		listLoans(c, db, ` WHERE l.user_id = $1`, userID)
+	}
+}
+
+// CreateLoan lends an employee money, repaid by a fixed installment in each payroll run from start_date on
+func CreateLoan(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateLoanRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		userID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		if !req.Principal.IsPositive() || !req.InstallmentAmount.IsPositive() || req.InstallmentAmount.Cmp(req.Principal) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "principal and installment_amount must be greater than 0, the installment at most the principal"})
+			return
+		}
+		startDate, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		ip := c.ClientIP()
+		loanID := uuid.New()
+		res, err := db.Exec(`
+			INSERT INTO loans (id, user_id, description, principal, installment_amount, start_date, created_by, created_ip)
+			SELECT $1, u.id, $3, $4, $5, $6, $7, $8 FROM users u WHERE u.id = $2 AND u.role <> 'service'
+		`, loanID, userID, req.Description, req.Principal, req.InstallmentAmount, startDate, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "INSERT", "loans", loanID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": loanID, "message": "Loan created successfully"})
+	}
+}
+
+// GetLoan returns a loan with its repayments and skipped periods
+func GetLoan(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loanID, err := uuid.Parse(c.Param("loan_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan_id"})
+			return
+		}
+
+		loan, err := scanLoan(db.QueryRow(loanSelect+` WHERE l.id = $1`, loanID))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loan"})
+			return
+		}
+
+		response := models.LoanDetailResponse{Loan: loan, Repayments: []models.LoanRepayment{}, Skips: []models.LoanSkip{}}
+
+		rows, err := db.Query(`
+			SELECT id, kind, attendance_periods_id, amount, created_at
+			FROM loan_repayments
+			WHERE loan_id = $1
+			ORDER BY created_at
+		`, loanID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch repayments"})
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r models.LoanRepayment
+			if err := rows.Scan(&r.ID, &r.Kind, &r.PeriodID, &r.Amount, &r.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan repayment"})
+				return
+			}
+			response.Repayments = append(response.Repayments, r)
+		}
+
+		skipRows, err := db.Query(`
+			SELECT attendance_periods_id, reason, created_at FROM loan_skips WHERE loan_id = $1 ORDER BY created_at
+		`, loanID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch skipped installments"})
+			return
+		}
+		defer skipRows.Close()
+		for skipRows.Next() {
+			var s models.LoanSkip
+			if err := skipRows.Scan(&s.PeriodID, &s.Reason, &s.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan skipped installment"})
+				return
+			}
+			response.Skips = append(response.Skips, s)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// PayOffLoan records the repayment of the whole remaining balance outside payroll
+func PayOffLoan(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loanID, err := uuid.Parse(c.Param("loan_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan_id"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		//lock the loan so a concurrent payoff can't settle the balance twice
+		var principal, repaid money.Decimal
+		err = tx.QueryRow(`
+			SELECT l.principal, COALESCE((SELECT SUM(amount) FROM loan_repayments WHERE loan_id = l.id), 0)
+			FROM loans l WHERE l.id = $1 FOR UPDATE
+		`, loanID).Scan(&principal, &repaid)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loan"})
+			return
+		}
+		balance := principal.Sub(repaid)
+		if !balance.IsPositive() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Loan is already repaid"})
+			return
+		}
+
+		ip := c.ClientIP()
+		_, err = tx.Exec(`
+			INSERT INTO loan_repayments (loan_id, kind, amount, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5)
+		`, loanID, models.LoanRepaymentPayoff, balance, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pay off loan"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pay off loan"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{"amount": balance})
+		utils.LogAudit(db, "PAYOFF", "loans", loanID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Loan paid off", "amount": balance})
+	}
+}
+
+// SkipLoanInstallment leaves out the installment of a loan in one period, the loan runs a period longer
+func SkipLoanInstallment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loanID, err := uuid.Parse(c.Param("loan_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan_id"})
+			return
+		}
+
+		var req SkipInstallmentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "period_id and reason are required"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM loans WHERE id = $1)`, loanID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		}
+		if rejectFinalizedPeriod(c, db, req.PeriodID) {
+			return
+		}
+
+		ip := c.ClientIP()
+		_, err = db.Exec(`
+			INSERT INTO loan_skips (loan_id, attendance_periods_id, reason, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5)
+		`, loanID, req.PeriodID, req.Reason, adminID, ip)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Installment is already skipped for this period"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to skip installment"})
+			}
+			return
+		}
+
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "SKIP", "loans", loanID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Installment skipped"})
+	}
+}
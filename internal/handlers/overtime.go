@@ -5,16 +5,182 @@ import (
 	"encoding/json"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
 	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type OvertimeRequest struct {
-	Date  string  `json:"date" binding:"required"` //YYYY-MM-DD
-	Hours float64 `json:"hours" binding:"required"`
+	Date  string        `json:"date" binding:"required"` //YYYY-MM-DD
+	Hours money.Decimal `json:"hours"`
+}
+
+type ReviewOvertimeRequest struct {
+	Status  string `json:"status" binding:"required"` //approved or rejected
+	Comment string `json:"comment"`                   //required when rejecting
+}
+
+const overtimeSelect = `
+	SELECT o.id, o.user_id, u.username, o.date, o.hours, o.status, o.reviewed_by, o.reviewed_at, o.review_comment, o.created_at
+	FROM overtimes o
+	JOIN users u ON u.id = o.user_id
+`
+
+func scanOvertime(row interface{ Scan(...interface{}) error }) (models.Overtime, error) {
+	var o models.Overtime
+	var date time.Time
+	var reviewedBy, comment sql.NullString
+	var reviewedAt sql.NullTime
+	err := row.Scan(&o.ID, &o.UserID, &o.Username, &date, &o.Hours, &o.Status, &reviewedBy, &reviewedAt, &comment, &o.CreatedAt)
+	if err != nil {
+		return o, err
+	}
+	o.Date = date.Format("2006-01-02")
+	if reviewedBy.Valid {
+		o.ReviewedBy = &reviewedBy.String
+	}
+	if reviewedAt.Valid {
+		o.ReviewedAt = &reviewedAt.Time
+	}
+	if comment.Valid {
+		o.ReviewComment = &comment.String
+	}
+	return o, nil
+}
+
+// listOvertimes responds with the overtime requests matching the conditions, by date
+func listOvertimes(c *gin.Context, db *sql.DB, conditions []string, args ...interface{}) {
+	query := overtimeSelect
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	rows, err := db.Query(query+` ORDER BY o.date, u.username`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overtime"})
+		return
+	}
+	defer rows.Close()
+
+	overtimes := []models.Overtime{}
+	for rows.Next() {
+		o, err := scanOvertime(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan overtime"})
+			return
+		}
+		overtimes = append(overtimes, o)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"overtimes": overtimes})
+}
+
+// ListOvertimes returns the overtime requests to review, the pending ones unless another status is asked for.
+// They can be narrowed to a period with period_id.
+func ListOvertimes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conditions, args, ok := reviewFilters(c, db, "o", models.ReviewPending, nil, nil)
+		if !ok {
+			return
+		}
+		listOvertimes(c, db, conditions, args...)
+	}
+}
+
+// ListMyOvertime returns the overtime requests of the authenticated employee with their review
+func ListMyOvertime(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		conditions, args, ok := reviewFilters(c, db, "o", "", []string{`o.user_id = $1`}, []interface{}{userID})
+		if !ok {
+			return
+		}
+		listOvertimes(c, db, conditions, args...)
+	}
+}
+
+// ReviewOvertime approves or rejects a pending overtime request. Approvers can't review their own requests,
+// and requests in a period whose payroll is finalized can no longer change.
+func ReviewOvertime(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		overtimeID, err := uuid.Parse(c.Param("overtime_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid overtime_id"})
+			return
+		}
+
+		var req ReviewOvertimeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		req.Comment = strings.TrimSpace(req.Comment)
+		if !isDecision(req.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be approved or rejected"})
+			return
+		}
+		if req.Status == models.ReviewRejected && req.Comment == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A comment is required to reject overtime"})
+			return
+		}
+
+		approverID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		var ownerID uuid.UUID
+		var date time.Time
+		var status string
+		err = db.QueryRow(`SELECT user_id, date, status FROM overtimes WHERE id = $1`, overtimeID).Scan(&ownerID, &date, &status)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Overtime not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overtime"})
+			return
+		}
+		if rejectReview(c, db, "overtime", ownerID, approverID, status, date) {
+			return
+		}
+
+		//the status condition keeps a concurrent review or resubmission from being overwritten
+		var comment *string
+		if req.Comment != "" {
+			comment = &req.Comment
+		}
+		ip := c.ClientIP()
+		res, err := db.Exec(`
+			UPDATE overtimes
+			SET status = $2, reviewed_by = $3, reviewed_at = now(), review_comment = $4, updated_at = now(), updated_by = $3, updated_ip = $5
+			WHERE id = $1 AND status = 'pending'
+		`, overtimeID, req.Status, approverID, comment, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review overtime"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Overtime has already been reviewed"})
+			return
+		}
+
+		action := "APPROVE"
+		if req.Status == models.ReviewRejected {
+			action = "REJECT"
+		}
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, action, "overtimes", overtimeID.String(), approverID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"id": overtimeID, "status": req.Status})
+	}
 }
 
 func SubmitOvertime(db *sql.DB) gin.HandlerFunc {
@@ -25,9 +191,8 @@ func SubmitOvertime(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		//validate hours
-		if req.Hours <= 0 || req.Hours > 3 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Overtime must between 1 to 3 hours"})
+		if !req.Hours.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Overtime hours must be greater than 0"})
 			return
 		}
 
@@ -44,29 +209,87 @@ func SubmitOvertime(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		//the upsert below edits an existing entry, so it is checked the same way as a new one
+		if rejectLockedPeriod(c, db, userID, overtimeDate) {
+			return
+		}
+
+		//the caps and increment come from the policy of the employee's level
+		policy, err := userOvertimePolicy(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overtime policy"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		//overtime of the user is serialized, so concurrent requests for different days can't both fit in the caps
+		if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		//hours of the other days of the same Monday to Sunday week and calendar month, the day itself is replaced
+		//and rejected requests don't count
+		weekStart := overtimeDate.AddDate(0, 0, -(int(overtimeDate.Weekday())+6)%7)
+		monthStart := overtimeDate.AddDate(0, 0, 1-overtimeDate.Day())
+		var weekOther, monthOther money.Decimal
+		err = tx.QueryRow(`
+			SELECT
+				COALESCE(SUM(hours) FILTER (WHERE date BETWEEN $3 AND $4), 0),
+				COALESCE(SUM(hours) FILTER (WHERE date BETWEEN $5 AND $6), 0)
+			FROM overtimes
+			WHERE user_id = $1 AND date <> $2 AND status <> 'rejected'
+		`, userID, overtimeDate, weekStart, weekStart.AddDate(0, 0, 6), monthStart, monthStart.AddDate(0, 1, -1)).Scan(&weekOther, &monthOther)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recorded overtime"})
+			return
+		}
+		if err := policy.CheckHours(req.Hours, weekOther, monthOther); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		ip := c.ClientIP()
-		overtimeID := uuid.New()
 
-		_, err = db.Exec(`
+		//changing the hours of a reviewed request sends it back for approval
+		var overtimeID string
+		err = tx.QueryRow(`
 			INSERT INTO overtimes (id, user_id, date, hours, created_by, created_ip) 
 			VALUES ($1, $2, $3, $4, $5, $6)
 			ON CONFLICT (user_id, date) DO UPDATE 
 			SET hours = EXCLUDED.hours, 
+				status = 'pending',
+				reviewed_by = NULL,
+				reviewed_at = NULL,
+				review_comment = NULL,
 				updated_at = now(),
 				updated_by = $5,
 				updated_ip = $6
-			`, uuid.New(), userID, overtimeDate, req.Hours, userID, ip)
+			RETURNING id
+			`, uuid.New(), userID, overtimeDate, req.Hours, userID, ip).Scan(&overtimeID)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit overtime"})
+			return
+		}
 
 		//insert into audit logs
 		changeData, err := json.Marshal(req)
 		if err != nil {
 			changeData = []byte(`{}`)
 		}
-		utils.LogAudit(db, "INSERT/UPDATE", "overtimes", overtimeID.String(), userID, net.ParseIP(ip), changeData)
+		utils.LogAudit(db, "INSERT/UPDATE", "overtimes", overtimeID, userID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"id": overtimeID, "status": models.ReviewPending})
 	}
 }
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// overtimePolicyColumns are the columns of overtime_policies read by overtimePolicyFields, aliased op
+const overtimePolicyColumns = `op.daily_cap, op.weekly_cap, op.monthly_cap, op.weekday_multiplier, op.rest_day_multiplier, op.holiday_multiplier, op.increment`
+
+// overtimePolicyFields returns the scan destinations of overtimePolicyColumns
+func overtimePolicyFields(p *payroll.OvertimePolicy) []interface{} {
+	return []interface{}{&p.DailyCap, &p.WeeklyCap, &p.MonthlyCap, &p.WeekdayMultiplier, &p.RestDayMultiplier, &p.HolidayMultiplier, &p.Increment}
+}
+
+// levelOvertimePolicy returns the overtime policy of a level, the company policy when it has none of its own
+func levelOvertimePolicy(db *sql.DB, levelID uuid.UUID) (policy payroll.OvertimePolicy, own bool, err error) {
+	err = db.QueryRow(`SELECT `+overtimePolicyColumns+` FROM overtime_policies op WHERE op.level_id = $1`, levelID).
+		Scan(overtimePolicyFields(&policy)...)
+	if err == sql.ErrNoRows {
+		return config.OvertimePolicy, false, nil
+	}
+	return policy, err == nil, err
+}
+
+// userOvertimePolicy returns the overtime policy of an employee's level, the company policy when it has none
+func userOvertimePolicy(db *sql.DB, userID uuid.UUID) (policy payroll.OvertimePolicy, err error) {
+	err = db.QueryRow(`
+		SELECT `+overtimePolicyColumns+`
+		FROM overtime_policies op
+		JOIN users u ON u.level_id = op.level_id
+		WHERE u.id = $1
+	`, userID).Scan(overtimePolicyFields(&policy)...)
+	if err == sql.ErrNoRows {
+		return config.OvertimePolicy, nil
+	}
+	return policy, err
+}
+
+// parseLevelID reads the level_id parameter and checks that the level exists, answering the request when it doesn't
+func parseLevelID(c *gin.Context, db *sql.DB) (uuid.UUID, bool) {
+	levelID, err := uuid.Parse(c.Param("level_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid level_id"})
+		return uuid.Nil, false
+	}
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM employee_levels WHERE id = $1)`, levelID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return uuid.Nil, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Level not found"})
+		return uuid.Nil, false
+	}
+	return levelID, true
+}
+
+// GetOvertimePolicy returns the overtime policy of a level. default is true when the level uses the company policy.
+func GetOvertimePolicy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		levelID, ok := parseLevelID(c, db)
+		if !ok {
+			return
+		}
+
+		policy, own, err := levelOvertimePolicy(db, levelID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overtime policy"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"level_id": levelID, "policy": policy, "default": !own})
+	}
+}
+
+// SetOvertimePolicy gives a level its own overtime policy. It applies to overtime submitted from now on and
+// to payroll runs from now on, finalized payslips keep the multipliers they were paid with.
+func SetOvertimePolicy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy payroll.OvertimePolicy
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			if errors.Is(err, payroll.ErrInvalidOvertimePolicy) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate overtime policy"})
+			}
+			return
+		}
+
+		levelID, ok := parseLevelID(c, db)
+		if !ok {
+			return
+		}
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		ip := c.ClientIP()
+
+		_, err := db.Exec(`
+			INSERT INTO overtime_policies (
+				level_id, daily_cap, weekly_cap, monthly_cap, weekday_multiplier, rest_day_multiplier, holiday_multiplier, increment,
+				updated_by, updated_ip
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (level_id) DO UPDATE
+			SET daily_cap = EXCLUDED.daily_cap,
+				weekly_cap = EXCLUDED.weekly_cap,
+				monthly_cap = EXCLUDED.monthly_cap,
+				weekday_multiplier = EXCLUDED.weekday_multiplier,
+				rest_day_multiplier = EXCLUDED.rest_day_multiplier,
+				holiday_multiplier = EXCLUDED.holiday_multiplier,
+				increment = EXCLUDED.increment,
+				updated_at = now(),
+				updated_by = EXCLUDED.updated_by,
+				updated_ip = EXCLUDED.updated_ip
+		`, levelID, policy.DailyCap, policy.WeeklyCap, policy.MonthlyCap, policy.WeekdayMultiplier, policy.RestDayMultiplier,
+			policy.HolidayMultiplier, policy.Increment, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save overtime policy"})
+			return
+		}
+
+		changeData, _ := json.Marshal(policy)
+		utils.LogAudit(db, "UPSERT", "overtime_policies", levelID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"level_id": levelID, "policy": policy, "default": false})
+	}
+}
+
+// DeleteOvertimePolicy makes a level use the company overtime policy again
+func DeleteOvertimePolicy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		levelID, err := uuid.Parse(c.Param("level_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid level_id"})
+			return
+		}
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`DELETE FROM overtime_policies WHERE level_id = $1`, levelID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete overtime policy"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Level has no overtime policy of its own"})
+			return
+		}
+
+		ip := c.ClientIP()
+		utils.LogAudit(db, "DELETE", "overtime_policies", levelID.String(), adminID, net.ParseIP(ip), []byte(`{}`))
+
+		c.JSON(http.StatusOK, gin.H{"message": "Level uses the default overtime policy"})
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// passwordReused reports whether plain matches the current password or one of the last PasswordHistory ones
+func passwordReused(db *sql.DB, userID, plain string) (bool, error) {
+	rows, err := db.Query(`
+		SELECT password FROM users WHERE id = $1
+		UNION ALL
+		(SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2)
+	`, userID, config.PasswordHistory)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// setPassword stores a new password hash for the user and appends it to the password history
+func setPassword(tx *sql.Tx, userID, hash string, mustChange bool, actorID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE users SET password = $2, must_change_password = $3, password_changed_at = now(),
+			updated_at = now(), updated_by = $4
+		WHERE id = $1
+	`, userID, hash, mustChange, actorID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)
+	`, userID, hash)
+	return err
+}
+
+// validateNewPassword applies the password policy and reuse history, returning a client facing message
+func validateNewPassword(db *sql.DB, userID, plain string) (string, error) {
+	if err := utils.ValidatePassword(plain); err != nil {
+		return err.Error(), nil
+	}
+	reused, err := passwordReused(db, userID, plain)
+	if err != nil {
+		return "", err
+	}
+	if reused {
+		return "Password has been used recently, choose a different one", nil
+	}
+	return "", nil
+}
+
+func ChangePassword(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ChangePasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		userID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+			return
+		}
+
+		var currentHash string
+		var totpEnabled bool
+		err = db.QueryRow(`SELECT password, totp_enabled FROM users WHERE id = $1`, userID).Scan(&currentHash, &totpEnabled)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(currentHash), []byte(req.CurrentPassword)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+
+		msg, err := validateNewPassword(db, userID.String(), req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password history"})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		hash, err := utils.HashPassword(req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := setPassword(tx, userID.String(), hash, false, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			return
+		}
+
+		ip := c.ClientIP()
+		utils.LogAudit(db, "PASSWORD_CHANGE", "users", userID.String(), userID, net.ParseIP(ip), []byte(`{}`))
+
+		//sign out everywhere else and hand back a fresh, unrestricted token pair
+		if err := revokeAllUserTokens(db, userID.String()); err != nil {
+			log.Printf("[ChangePassword] Failed to revoke tokens: %v\n", err)
+		}
+		role := c.GetString("role")
+		tokens, err := startSessionWithTokens(db, c, userID.String(), role, tokenRestriction(role, false, totpEnabled))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		tokens["message"] = "Password changed successfully"
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// CreatePasswordReset issues a single-use, expiring reset token for a user. The admin hands it to the user out of band.
+func CreatePasswordReset(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		adminID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+			return
+		}
+
+		var targetRole string
+		err = db.QueryRow(`SELECT role FROM users WHERE id = $1`, targetID).Scan(&targetRole)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		//a reset token takes over the account, so only admins can reset an admin's password
+		if !canAssignRole(c.GetString("role"), targetRole) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can reset the password of an admin"})
+			return
+		}
+
+		token, tokenHash, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+			return
+		}
+		expiresAt := time.Now().Add(config.PasswordResetTTL)
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		//only the latest reset token is usable
+		_, err = tx.Exec(`
+			UPDATE password_reset_tokens SET used_at = now() WHERE user_id = $1 AND used_at IS NULL
+		`, targetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		resetID := uuid.New()
+		_, err = tx.Exec(`
+			INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, resetID, targetID, tokenHash, expiresAt, adminID, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{"user_id": targetID, "expires_at": expiresAt})
+		utils.LogAudit(db, "PASSWORD_RESET_REQUEST", "password_reset_tokens", resetID.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"reset_token": token, "expires_at": expiresAt})
+	}
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out everywhere
+func ResetPassword(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ResetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var resetID, userID string
+		var expiresAt time.Time
+		var usedAt sql.NullTime
+		err := db.QueryRow(`
+			SELECT id, user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = $1
+		`, utils.HashToken(req.Token)).Scan(&resetID, &userID, &expiresAt, &usedAt)
+		if err != nil || usedAt.Valid || time.Now().After(expiresAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		msg, err := validateNewPassword(db, userID, req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password history"})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		hash, err := utils.HashPassword(req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		res, err := tx.Exec(`
+			UPDATE password_reset_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL
+		`, resetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if err := setPassword(tx, userID, hash, false, uid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+
+		if err := revokeAllUserTokens(db, userID); err != nil {
+			log.Printf("[ResetPassword] Failed to revoke tokens: %v\n", err)
+		}
+		utils.LogAudit(db, "PASSWORD_RESET", "users", userID, uid, net.ParseIP(c.ClientIP()), []byte(`{}`))
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+	}
+}
@@ -2,14 +2,31 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
 	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// newCalculator returns the payroll calculator with the configured rounding
+func newCalculator() payroll.Calculator {
+	calc := payroll.NewCalculator()
+	calc.Rounding = config.MoneyRounding
+	calc.Tax = config.TaxRules
+	calc.Contributions = config.Contributions
+	calc.Overtime = config.OvertimePolicy
+	return calc
+}
+
 func RunPayroll(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
@@ -31,101 +48,499 @@ func RunPayroll(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Calculate working days
-		workingDays := utils.CountWorkingDays(startDate, endDate)
+		// Calculate working days, employees who joined or left during the period have fewer
+		holidays, err := loadHolidays(db, startDate, endDate)
+		if err != nil {
+			log.Printf("[RunPayroll] Failed to fetch holidays: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+		workingDays := utils.CountWorkingDays(startDate, endDate, holidays)
 		ip := c.ClientIP()
-		userID, exist := c.Get("user_id")
-		if !exist {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		actor, ok := actorID(c)
+		if !ok {
 			return
 		}
 
-		query := `
-			INSERT INTO payslips (
-				user_id, attendance_periods_id, base_salary, attendance_amount, attendance_days,
-				overtime_amount, overtime_hours, reimbursement_amount, total_take_home, created_at, created_by, created_ip
-			)
-				SELECT 
-					u.id AS user_id,
-					ap.id AS period_id,
-					l.base_salary AS base_salary,
-					COALESCE(a.attendance_amount, 0) AS attendance_amount,
-					COALESCE(a.attendance_days, 0) AS attendance_days,
-					COALESCE(o.overtime_amount, 0) AS overtime_amount,
-					COALESCE(o.overtime_hours, 0) AS overtime_hours,
-					COALESCE(r.reimbursement_amount, 0) AS reimbursement_amount,
-					COALESCE(a.attendance_amount, 0) +
-					COALESCE(o.overtime_amount, 0) +
-					COALESCE(r.reimbursement_amount, 0) AS total_take_home,
-					NOW() AS created_at,
-					$3 AS created_by,
-					$4 AS created_ip
-				FROM users u
-				JOIN employee_levels l ON u.level_id = l.id
-				JOIN attendance_periods ap ON ap.id = $1
-
-				-- Pre-aggregated attendance
-				LEFT JOIN (
-					SELECT 
-						user_id,
-						COUNT(*) AS attendance_days,
-						(COUNT(*) * 8) * (l.base_salary / ($2 * 8)) AS attendance_amount
-					FROM attendances a
-					JOIN employee_levels l ON l.id = (
-						SELECT level_id FROM users WHERE id = a.user_id
-					)
-					WHERE period_id = $1
-					GROUP BY user_id, l.base_salary
-				) a ON u.id = a.user_id
-
-				-- Pre-aggregated overtime
-				LEFT JOIN (
-					SELECT 
-						user_id,
-						SUM(hours) AS overtime_hours,
-						SUM(hours) * (l.base_salary / ($2 * 8)) * 2 AS overtime_amount
-					FROM overtimes o
-					JOIN employee_levels l ON l.id = (
-						SELECT level_id FROM users WHERE id = o.user_id
-					)
-					WHERE date BETWEEN (
-						SELECT start_date FROM attendance_periods WHERE id = $1
-					) AND (
-						SELECT end_date FROM attendance_periods WHERE id = $1
-					)
-					GROUP BY user_id, l.base_salary
-				) o ON u.id = o.user_id
-
-				-- Pre-aggregated reimbursements
-				LEFT JOIN (
-					SELECT 
-						user_id,
-						SUM(amount) AS reimbursement_amount
-					FROM reimbursements
-					WHERE date BETWEEN (
-						SELECT start_date FROM attendance_periods WHERE id = $1
-					) AND (
-						SELECT end_date FROM attendance_periods WHERE id = $1
-					)
-					GROUP BY user_id
-				) r ON u.id = r.user_id
-
-				-- Filter only employees with data
-				WHERE 
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		//a period has a single run; a draft run is replaced, a finalized one never changes
+		runID, status, err := lockPayrollRun(tx, req.PeriodID)
+		if err != nil {
+			log.Printf("[RunPayroll] Failed to fetch payroll run: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+		rerun := runID != ""
+		switch {
+		case status == models.PayrollRunFinalized:
+			c.JSON(http.StatusConflict, gin.H{"error": "Payroll for this period has been finalized and can no longer be changed"})
+			return
+		case rerun:
+			if _, err := tx.Exec(`DELETE FROM payslips WHERE payroll_run_id = $1`, runID); err != nil {
+				log.Printf("[RunPayroll] Failed to clear draft payslips: %v\n", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+				return
+			}
+			_, err = tx.Exec(`
+				UPDATE payroll_runs SET run_count = run_count + 1, updated_at = now(), updated_by = $2, updated_ip = $3
+				WHERE id = $1
+			`, runID, actor, ip)
+			if err != nil {
+				log.Printf("[RunPayroll] Failed to update payroll run: %v\n", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+				return
+			}
+		default:
+			runID = uuid.New().String()
+			_, err = tx.Exec(`
+				INSERT INTO payroll_runs (id, attendance_periods_id, status, created_by, updated_by, created_ip, updated_ip)
+				VALUES ($1, $2, $3, $4, $4, $5, $5)
+			`, runID, req.PeriodID, models.PayrollRunDraft, actor, ip)
+			if err != nil {
+				if utils.IsUniqueViolation(err) {
+					c.JSON(http.StatusConflict, gin.H{"error": "Payroll for this period is already being processed"})
+				} else {
+					log.Printf("[RunPayroll] Failed to create payroll run: %v\n", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+				}
+				return
+			}
+		}
+
+		//gather each employee's inputs, the amounts are computed by the payroll calculator
+		rows, err := tx.Query(`
+			SELECT
+				u.id,
+				s.base_salary,
+				COALESCE(a.attendance_days, 0) AS attendance_days,
+				COALESCE(o.overtime_hours, 0) AS overtime_hours,
+				COALESCE(o.rest_day_overtime_hours, 0) AS rest_day_overtime_hours,
+				COALESCE(o.holiday_overtime_hours, 0) AS holiday_overtime_hours,
+				COALESCE(r.reimbursement_amount, 0) AS reimbursement_amount,
+				COALESCE(tp.married, false) AS married,
+				COALESCE(tp.dependents, 0) AS dependents,
+				u.hired_on,
+				u.terminated_on
+			FROM users u
+			LEFT JOIN tax_profiles tp ON tp.user_id = u.id
+
+			-- Salary of the level in force at the start of the period
+			JOIN LATERAL (
+				SELECT base_salary
+				FROM employee_level_salaries
+				WHERE level_id = u.level_id AND effective_from <= $2
+				ORDER BY effective_from DESC
+				LIMIT 1
+			) s ON true
+
+			-- Pre-aggregated attendance, only working days of employment count: attendance recorded on a day
+			-- that was made a holiday afterwards is not paid, so it never exceeds the working days
+			LEFT JOIN (
+				SELECT at.user_id, COUNT(*) AS attendance_days
+				FROM attendances at
+				JOIN users e ON e.id = at.user_id
+				WHERE at.period_id = $1 AND at.date BETWEEN GREATEST($2, e.hired_on) AND LEAST($3, e.terminated_on)
+					AND EXTRACT(ISODOW FROM at.date) < 6
+					AND NOT EXISTS (SELECT 1 FROM holidays h WHERE h.date = at.date)
+				GROUP BY at.user_id
+			) a ON u.id = a.user_id
+
+			-- Pre-aggregated approved overtime by kind of day, only days of employment count
+			LEFT JOIN (
+				SELECT ot.user_id,
+					SUM(ot.hours) FILTER (WHERE h.date IS NULL AND EXTRACT(ISODOW FROM ot.date) < 6) AS overtime_hours,
+					SUM(ot.hours) FILTER (WHERE h.date IS NULL AND EXTRACT(ISODOW FROM ot.date) >= 6) AS rest_day_overtime_hours,
+					SUM(ot.hours) FILTER (WHERE h.date IS NOT NULL) AS holiday_overtime_hours
+				FROM overtimes ot
+				JOIN users e ON e.id = ot.user_id
+				LEFT JOIN holidays h ON h.date = ot.date
+				WHERE ot.status = 'approved' AND ot.date BETWEEN GREATEST($2, e.hired_on) AND LEAST($3, e.terminated_on)
+				GROUP BY ot.user_id
+			) o ON u.id = o.user_id
+
+			-- Pre-aggregated approved reimbursements
+			LEFT JOIN (
+				SELECT user_id, SUM(amount) AS reimbursement_amount
+				FROM reimbursements
+				WHERE status = 'approved' AND date BETWEEN $2 AND $3
+				GROUP BY user_id
+			) r ON u.id = r.user_id
+
+			-- Filter only employees employed during the period with data
+			WHERE
+				(u.hired_on IS NULL OR u.hired_on <= $3) AND
+				(u.terminated_on IS NULL OR u.terminated_on >= $2) AND (
 					COALESCE(a.attendance_days, 0) > 0 OR
-					COALESCE(o.overtime_hours, 0) > 0 OR
-					COALESCE(r.reimbursement_amount, 0) > 0
+					o.user_id IS NOT NULL OR
+					COALESCE(r.reimbursement_amount, 0) > 0 OR
+					EXISTS (SELECT 1 FROM bonuses b WHERE b.user_id = u.id AND b.attendance_periods_id = $1)
+				)
+
+			ORDER BY u.id
+		`, req.PeriodID, startDate, endDate)
+		if err != nil {
+			log.Printf("[RunPayroll] Failed to fetch payroll inputs: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+		defer rows.Close()
+
+		type employeeInput struct {
+			userID string
+			input  payroll.Input
+		}
+		var inputs []employeeInput
+		for rows.Next() {
+			e := employeeInput{input: payroll.Input{WorkingDays: workingDays}}
+			var hiredOn, terminatedOn *time.Time
+			err := rows.Scan(&e.userID, &e.input.BaseSalary, &e.input.AttendanceDays, &e.input.OvertimeHours, &e.input.RestDayOvertime,
+				&e.input.HolidayOvertime, &e.input.Reimbursements, &e.input.TaxProfile.Married, &e.input.TaxProfile.Dependents, &hiredOn, &terminatedOn)
+			if err != nil {
+				log.Printf("[RunPayroll] Failed to scan payroll input: %v\n", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+				return
+			}
+			if from, to, _ := utils.EmploymentWindow(startDate, endDate, hiredOn, terminatedOn); !from.Equal(startDate) || !to.Equal(endDate) {
+				e.input.WorkingDays = utils.CountWorkingDays(from, to, holidays)
+				e.input.PeriodWorkingDays = workingDays
+			}
+			inputs = append(inputs, e)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("[RunPayroll] Failed to read payroll inputs: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+		rows.Close()
 
-				ORDER BY u.id;
+		byUser := make(map[string]*payroll.Input, len(inputs))
+		for i := range inputs {
+			byUser[inputs[i].userID] = &inputs[i].input
+		}
+		if err := loadEarnings(tx, req.PeriodID, startDate, endDate, byUser); err != nil {
+			log.Printf("[RunPayroll] Failed to fetch allowances and bonuses: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+		if err := loadLoanInstallments(tx, req.PeriodID, endDate, byUser); err != nil {
+			log.Printf("[RunPayroll] Failed to fetch loan installments: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+		if err := loadOvertimePolicies(tx, byUser); err != nil {
+			log.Printf("[RunPayroll] Failed to fetch overtime policies: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+
+		calc := newCalculator()
+		for _, e := range inputs {
+			res, err := calc.Calculate(e.input)
+			if err != nil {
+				log.Printf("[RunPayroll] Failed to calculate payslip for %s: %v\n", e.userID, err)
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":   "Failed to calculate payroll for employee " + e.userID + ": " + err.Error(),
+					"user_id": e.userID,
+				})
+				return
+			}
+
+			var taxStatus *string
+			if res.Tax != nil {
+				taxStatus = &res.Tax.Status
+			}
+			//the amount columns are derived from the items, the items are the payslip
+			payslipID := uuid.New().String()
+			_, err = tx.Exec(`
+				INSERT INTO payslips (
+					id, payroll_run_id, user_id, attendance_periods_id, base_salary, attendance_amount, attendance_days, working_days,
+					overtime_amount, overtime_hours, reimbursement_amount, tax_amount, tax_status,
+					employee_contributions, employer_contributions, total_earnings, total_deductions, total_take_home,
+					created_by, created_ip
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+			`, payslipID, runID, e.userID, req.PeriodID, e.input.BaseSalary,
+				payroll.SumByCode(res.Items, payroll.CodeAttendance), e.input.AttendanceDays, e.input.WorkingDays,
+				res.OvertimeAmount, money.Sum(e.input.OvertimeHours, e.input.RestDayOvertime, e.input.HolidayOvertime),
+				payroll.SumByCode(res.Items, payroll.CodeReimbursement),
+				payroll.SumByCode(res.Items, payroll.CodeIncomeTax), taxStatus,
+				res.EmployeeContributions, res.EmployerContributions, res.TotalEarnings, res.TotalDeductions, res.TotalTakeHome,
+				actor, ip)
+			if err != nil {
+				log.Printf("[RunPayroll] Failed: %v\n", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+				return
+			}
+
+			for i, item := range res.Items {
+				_, err = tx.Exec(`
+					INSERT INTO payslip_items (payslip_id, position, code, label, kind, quantity, rate, amount, taxable)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				`, payslipID, i+1, item.Code, item.Label, string(item.Kind), item.Quantity, item.Rate, item.Amount, item.Taxable)
+				if err != nil {
+					log.Printf("[RunPayroll] Failed to store payslip item %s: %v\n", item.Code, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+					return
+				}
+			}
+
+			for _, loan := range res.Loans {
+				_, err = tx.Exec(`
+					INSERT INTO loan_repayments (loan_id, kind, payslip_id, attendance_periods_id, amount, created_by, created_ip)
+					VALUES ($1, $2, $3, $4, $5, $6, $7)
+				`, loan.LoanID, models.LoanRepaymentInstallment, payslipID, req.PeriodID, loan.Amount, actor, ip)
+				if err != nil {
+					log.Printf("[RunPayroll] Failed to store loan repayment %s: %v\n", loan.LoanID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+					return
+				}
+			}
+
+			for _, contribution := range res.Contributions {
+				_, err = tx.Exec(`
+					INSERT INTO payslip_contributions (payslip_id, code, label, base, employee_amount, employer_amount)
+					VALUES ($1, $2, $3, $4, $5, $6)
+				`, payslipID, contribution.Code, contribution.Label, contribution.Base, contribution.EmployeeAmount, contribution.EmployerAmount)
+				if err != nil {
+					log.Printf("[RunPayroll] Failed to store contribution %s: %v\n", contribution.Code, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+					return
+				}
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Printf("[RunPayroll] Failed to commit: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"period_id": req.PeriodID,
+			"payslips":  len(inputs),
+			"rerun":     rerun,
+		})
+		utils.LogAudit(db, "RUN", "payroll_runs", runID, actor, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Payroll processed successfully",
+			"run_id":   runID,
+			"status":   models.PayrollRunDraft,
+			"payslips": len(inputs),
+		})
+	}
+}
+
+// loadEarnings adds the allowances in force while the employee was employed during the period and the bonuses
+// of the period to the inputs. An employee allowance replaces the allowance of their level with the same code.
+func loadEarnings(tx *sql.Tx, periodID string, startDate, endDate time.Time, inputs map[string]*payroll.Input) error {
+	rows, err := tx.Query(`
+		SELECT DISTINCT ON (u.id, a.code) u.id, a.code, a.label, a.amount, a.taxable
+		FROM allowances a
+		JOIN users u ON u.id = a.user_id OR (a.user_id IS NULL AND a.level_id = u.level_id)
+		WHERE a.start_date <= LEAST($2, u.terminated_on) AND (a.end_date IS NULL OR a.end_date >= GREATEST($1, u.hired_on))
+		ORDER BY u.id, a.code, a.user_id NULLS LAST, a.start_date DESC
+	`, startDate, endDate)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var e payroll.Earning
+		if err := rows.Scan(&userID, &e.Code, &e.Label, &e.Amount, &e.Taxable); err != nil {
+			return err
+		}
+		if in, ok := inputs[userID]; ok {
+			in.Allowances = append(in.Allowances, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	bonusRows, err := tx.Query(`
+		SELECT user_id, label, amount, taxable FROM bonuses WHERE attendance_periods_id = $1 ORDER BY created_at
+	`, periodID)
+	if err != nil {
+		return err
+	}
+	defer bonusRows.Close()
+
+	for bonusRows.Next() {
+		var userID string
+		var e payroll.Earning
+		if err := bonusRows.Scan(&userID, &e.Label, &e.Amount, &e.Taxable); err != nil {
+			return err
+		}
+		if in, ok := inputs[userID]; ok {
+			in.Bonuses = append(in.Bonuses, e)
+		}
+	}
+	return bonusRows.Err()
+}
+
+// loadLoanInstallments adds the installments due in the period to the inputs: the installment of every loan
+// started by the end of the period that isn't skipped for it, at most the remaining balance.
+// Installments of the draft being re-run were deleted with its payslips, so they don't count.
+func loadLoanInstallments(tx *sql.Tx, periodID string, endDate time.Time, inputs map[string]*payroll.Input) error {
+	rows, err := tx.Query(`
+		SELECT l.id, l.user_id, l.description, LEAST(l.installment_amount, l.principal - COALESCE(SUM(r.amount), 0))
+		FROM loans l
+		LEFT JOIN loan_repayments r ON r.loan_id = l.id
+		WHERE l.start_date <= $2
+			AND NOT EXISTS (SELECT 1 FROM loan_skips s WHERE s.loan_id = l.id AND s.attendance_periods_id = $1)
+		GROUP BY l.id
+		HAVING l.principal - COALESCE(SUM(r.amount), 0) > 0
+		ORDER BY l.created_at
+	`, periodID, endDate)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var loan payroll.LoanInstallment
+		if err := rows.Scan(&loan.LoanID, &userID, &loan.Label, &loan.Amount); err != nil {
+			return err
+		}
+		if in, ok := inputs[userID]; ok {
+			in.Loans = append(in.Loans, loan)
+		}
+	}
+	return rows.Err()
+}
+
+// lockPayrollRun returns the run of a period, locked for the rest of the transaction, or an empty id when
+// payroll hasn't been run for the period yet
+func lockPayrollRun(tx *sql.Tx, periodID string) (string, string, error) {
+	var id, status string
+	err := tx.QueryRow(`
+		SELECT id, status FROM payroll_runs WHERE attendance_periods_id = $1 FOR UPDATE
+	`, periodID).Scan(&id, &status)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	return id, status, err
+}
+
+// ListPayrollRuns returns payroll runs, newest period first, optionally for one period
+func ListPayrollRuns(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := `
+			SELECT r.id, r.attendance_periods_id, r.status, r.run_count, COUNT(p.id), COALESCE(SUM(p.total_take_home), 0),
+				r.created_at, r.updated_at, r.finalized_at, r.finalized_by
+			FROM payroll_runs r
+			JOIN attendance_periods ap ON ap.id = r.attendance_periods_id
+			LEFT JOIN payslips p ON p.payroll_run_id = r.id
 		`
+		var args []interface{}
+		if periodID := c.Query("period_id"); periodID != "" {
+			query += ` WHERE r.attendance_periods_id = $1`
+			args = append(args, periodID)
+		}
+		query += ` GROUP BY r.id, ap.start_date ORDER BY ap.start_date DESC`
 
-		_, err = db.Exec(query, req.PeriodID, workingDays, userID, ip)
+		rows, err := db.Query(query, args...)
 		if err != nil {
-			log.Printf("[RunPayroll] Failed: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payroll"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payroll runs"})
 			return
 		}
+		defer rows.Close()
 
-		c.JSON(http.StatusOK, gin.H{"message": "Payroll processed successfully"})
+		runs := []models.PayrollRun{}
+		for rows.Next() {
+			var r models.PayrollRun
+			err := rows.Scan(&r.ID, &r.PeriodID, &r.Status, &r.RunCount, &r.Payslips, &r.TotalTakeHome,
+				&r.CreatedAt, &r.UpdatedAt, &r.FinalizedAt, &r.FinalizedBy)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan payroll run"})
+				return
+			}
+			runs = append(runs, r)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"runs": runs})
+	}
+}
+
+// FinalizePayrollRun freezes a draft run. Its payslips become visible to employees and can't be re-run.
+func FinalizePayrollRun(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID, err := uuid.Parse(c.Param("run_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run_id"})
+			return
+		}
+
+		actor, ok := actorID(c)
+		if !ok {
+			return
+		}
+		ip := c.ClientIP()
+
+		var periodID string
+		err = db.QueryRow(`
+			UPDATE payroll_runs
+			SET status = $2, finalized_at = now(), finalized_by = $3, finalized_ip = $4, updated_at = now(), updated_by = $3, updated_ip = $4
+			WHERE id = $1 AND status = $5
+			RETURNING attendance_periods_id
+		`, runID, models.PayrollRunFinalized, actor, ip, models.PayrollRunDraft).Scan(&periodID)
+		if err == sql.ErrNoRows {
+			var exists bool
+			if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM payroll_runs WHERE id = $1)`, runID).Scan(&exists); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if exists {
+				c.JSON(http.StatusConflict, gin.H{"error": "Payroll run is already finalized"})
+			} else {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Payroll run not found"})
+			}
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize payroll run"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]string{"period_id": periodID, "status": models.PayrollRunFinalized})
+		utils.LogAudit(db, "FINALIZE", "payroll_runs", runID.String(), actor, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Payroll run finalized successfully"})
+	}
+}
+
+// loadOvertimePolicies sets the overtime policy of the employee's level on the inputs. Employees whose level
+// has no policy keep the company policy of the calculator.
+func loadOvertimePolicies(tx *sql.Tx, inputs map[string]*payroll.Input) error {
+	rows, err := tx.Query(`
+		SELECT u.id, ` + overtimePolicyColumns + `
+		FROM overtime_policies op
+		JOIN users u ON u.level_id = op.level_id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var p payroll.OvertimePolicy
+		if err := rows.Scan(append([]interface{}{&userID}, overtimePolicyFields(&p)...)...); err != nil {
+			return err
+		}
+		if in, ok := inputs[userID]; ok {
+			in.Overtime = &p
+		}
 	}
+	return rows.Err()
 }
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Attendance period statuses
+const (
+	periodOpen   = "open"
+	periodClosed = "closed"
+)
+
+// periodLockError explains why userID may not submit or change records dated date, or returns "" when it may.
+// A period is locked once it is closed or payroll has been run for it. An active override lifts the lock
+// for corrections, except once the payroll run is finalized. Dates outside any period are never locked.
+func periodLockError(db *sql.DB, userID uuid.UUID, date time.Time) (string, error) {
+	var periodID, status string
+	var runStatus sql.NullString
+	var overridden bool
+	err := db.QueryRow(`
+		SELECT ap.id, ap.status, r.status,
+		       EXISTS (
+		           SELECT 1 FROM period_overrides o
+		           WHERE o.attendance_periods_id = ap.id
+		             AND (o.user_id IS NULL OR o.user_id = $2)
+		             AND o.revoked_at IS NULL AND o.expires_at > now()
+		       )
+		FROM attendance_periods ap
+		LEFT JOIN payroll_runs r ON r.attendance_periods_id = ap.id
+		WHERE $1::date BETWEEN ap.start_date AND ap.end_date
+	`, date, userID).Scan(&periodID, &status, &runStatus, &overridden)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case runStatus.String == models.PayrollRunFinalized:
+		return fmt.Sprintf("Payroll for period %s is finalized, records for it can no longer be changed", periodID), nil
+	case overridden:
+		return "", nil
+	case runStatus.Valid:
+		return fmt.Sprintf("Payroll has been processed for period %s, submissions are closed", periodID), nil
+	case status == periodClosed:
+		return fmt.Sprintf("Period %s is closed for submissions", periodID), nil
+	}
+	return "", nil
+}
+
+// rejectLockedPeriod responds with 409 when the period containing date is locked for userID and reports whether it did
+func rejectLockedPeriod(c *gin.Context, db *sql.DB, userID uuid.UUID, date time.Time) bool {
+	msg, err := periodLockError(db, userID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if msg != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+		return true
+	}
+	return false
+}
+
+// CloseAttendancePeriod stops submissions for a period ahead of running payroll
+func CloseAttendancePeriod(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		periodID := c.Param("period_id")
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		ip := c.ClientIP()
+		res, err := db.Exec(`
+			UPDATE attendance_periods
+			SET status = $2, closed_at = now(), closed_by = $3, updated_at = now(), updated_by = $3, updated_ip = $4
+			WHERE id = $1 AND status = $5
+		`, periodID, periodClosed, adminID, ip, periodOpen)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close attendance period"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attendance period not found or already closed"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]string{"status": periodClosed})
+		utils.LogAudit(db, "CLOSE", "attendance_period", periodID, adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Attendance period closed"})
+	}
+}
+
+type PeriodOverrideRequest struct {
+	UserID    *string `json:"user_id"` //optional, every employee when omitted
+	Reason    string  `json:"reason" binding:"required"`
+	ExpiresAt *string `json:"expires_at"` //RFC 3339, optional
+}
+
+// CreatePeriodOverride reopens a locked period for corrections until the override expires or is revoked
+func CreatePeriodOverride(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		periodID := c.Param("period_id")
+
+		var req PeriodOverrideRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var userID *uuid.UUID
+		if req.UserID != nil {
+			id, err := uuid.Parse(*req.UserID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+				return
+			}
+			userID = &id
+		}
+
+		expiresAt := time.Now().Add(config.PeriodOverrideTTL)
+		if req.ExpiresAt != nil {
+			t, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+			if err != nil || !t.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be a future RFC 3339 timestamp"})
+				return
+			}
+			expiresAt = t
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM attendance_periods WHERE id = $1)`, periodID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attendance period not found"})
+			return
+		}
+
+		ip := c.ClientIP()
+		overrideID := uuid.New()
+		_, err := db.Exec(`
+			INSERT INTO period_overrides (id, attendance_periods_id, user_id, reason, expires_at, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, overrideID, periodID, userID, req.Reason, expiresAt, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create override"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"period_id":  periodID,
+			"user_id":    userID,
+			"reason":     req.Reason,
+			"expires_at": expiresAt,
+		})
+		utils.LogAudit(db, "OVERRIDE", "period_overrides", overrideID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": overrideID, "period_id": periodID, "user_id": userID, "expires_at": expiresAt})
+	}
+}
+
+// ListPeriodOverrides returns the overrides of a period, newest first
+func ListPeriodOverrides(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Query(`
+			SELECT id, attendance_periods_id, user_id, reason, expires_at, revoked_at, created_at, created_by
+			FROM period_overrides
+			WHERE attendance_periods_id = $1
+			ORDER BY created_at DESC
+		`, c.Param("period_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overrides"})
+			return
+		}
+		defer rows.Close()
+
+		overrides := []models.PeriodOverride{}
+		for rows.Next() {
+			var o models.PeriodOverride
+			if err := rows.Scan(&o.ID, &o.PeriodID, &o.UserID, &o.Reason, &o.ExpiresAt, &o.RevokedAt, &o.CreatedAt, &o.CreatedBy); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan override"})
+				return
+			}
+			overrides = append(overrides, o)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+	}
+}
+
+// RevokePeriodOverride ends an override before it expires
+func RevokePeriodOverride(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		periodID := c.Param("period_id")
+		overrideID, err := uuid.Parse(c.Param("override_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid override_id"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE period_overrides SET revoked_at = now(), revoked_by = $3
+			WHERE id = $1 AND attendance_periods_id = $2 AND revoked_at IS NULL
+		`, overrideID, periodID, adminID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke override"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Override not found or already revoked"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]string{"period_id": periodID})
+		utils.LogAudit(db, "REVOKE", "period_overrides", overrideID.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Override revoked successfully"})
+	}
+}
@@ -3,21 +3,201 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
 	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type ReimbursementRequest struct {
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Description string  `json:"description"`
-	Date        string  `json:"date" binding:"required"`
+	Category    string        `json:"category" binding:"required"` //code of an active category
+	Amount      money.Decimal `json:"amount"`
+	Description string        `json:"description"`
+	Date        string        `json:"date" binding:"required"`
 }
 
+type ReviewReimbursementRequest struct {
+	Status string `json:"status" binding:"required"` //approved or rejected
+	Reason string `json:"reason"`                    //required when rejecting
+}
+
+const reimbursementSelect = `
+	SELECT r.id, r.user_id, u.username, r.category_code, r.date, r.description, r.claimed_amount, r.amount, r.over_limit,
+		(SELECT COUNT(*) FROM reimbursement_receipts rr WHERE rr.reimbursement_id = r.id),
+		r.status, r.reviewed_by, r.reviewed_at, r.review_reason, r.created_at
+	FROM reimbursements r
+	JOIN users u ON u.id = r.user_id
+`
+
+func scanReimbursement(row interface{ Scan(...interface{}) error }) (models.ReimbursementClaim, error) {
+	var r models.ReimbursementClaim
+	var date time.Time
+	var description, reviewedBy, reason sql.NullString
+	var reviewedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.UserID, &r.Username, &r.Category, &date, &description, &r.ClaimedAmount, &r.Amount, &r.OverLimit,
+		&r.Receipts, &r.Status, &reviewedBy, &reviewedAt, &reason, &r.CreatedAt)
+	if err != nil {
+		return r, err
+	}
+	r.Date = date.Format("2006-01-02")
+	r.Description = description.String
+	if reviewedBy.Valid {
+		r.ReviewedBy = &reviewedBy.String
+	}
+	if reviewedAt.Valid {
+		r.ReviewedAt = &reviewedAt.Time
+	}
+	if reason.Valid {
+		r.ReviewReason = &reason.String
+	}
+	return r, nil
+}
+
+// listReimbursements responds with the reimbursement claims matching the conditions, by date
+func listReimbursements(c *gin.Context, db *sql.DB, conditions []string, args ...interface{}) {
+	query := reimbursementSelect
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	rows, err := db.Query(query+` ORDER BY r.date, u.username`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reimbursements"})
+		return
+	}
+	defer rows.Close()
+
+	reimbursements := []models.ReimbursementClaim{}
+	for rows.Next() {
+		r, err := scanReimbursement(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan reimbursement"})
+			return
+		}
+		reimbursements = append(reimbursements, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reimbursements": reimbursements})
+}
+
+// ListReimbursements returns the reimbursement claims to review, the pending ones unless another status is asked
+// for. They can be narrowed to a period with period_id and to a category with category.
+func ListReimbursements(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var conditions []string
+		var args []interface{}
+		if category := c.Query("category"); category != "" {
+			conditions, args = append(conditions, `r.category_code = $1`), append(args, category)
+		}
+		conditions, args, ok := reviewFilters(c, db, "r", models.ReviewPending, conditions, args)
+		if !ok {
+			return
+		}
+		listReimbursements(c, db, conditions, args...)
+	}
+}
+
+// ListMyReimbursements returns the reimbursement claims of the authenticated employee with their review
+func ListMyReimbursements(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		conditions, args, ok := reviewFilters(c, db, "r", "", []string{`r.user_id = $1`}, []interface{}{userID})
+		if !ok {
+			return
+		}
+		listReimbursements(c, db, conditions, args...)
+	}
+}
+
+// ReviewReimbursement approves or rejects a pending reimbursement claim. Approvers can't review their own claims,
+// and claims in a period whose payroll is finalized can no longer change.
+func ReviewReimbursement(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reimbursementID, err := uuid.Parse(c.Param("reimbursement_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reimbursement_id"})
+			return
+		}
+
+		var req ReviewReimbursementRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if !isDecision(req.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be approved or rejected"})
+			return
+		}
+		if req.Status == models.ReviewRejected && req.Reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to reject a reimbursement"})
+			return
+		}
+
+		approverID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		var ownerID uuid.UUID
+		var date time.Time
+		var status string
+		err = db.QueryRow(`SELECT user_id, date, status FROM reimbursements WHERE id = $1`, reimbursementID).Scan(&ownerID, &date, &status)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reimbursement not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reimbursement"})
+			return
+		}
+		if rejectReview(c, db, "reimbursement", ownerID, approverID, status, date) {
+			return
+		}
+
+		//the status condition keeps a concurrent review from being overwritten
+		var reason *string
+		if req.Reason != "" {
+			reason = &req.Reason
+		}
+		ip := c.ClientIP()
+		res, err := db.Exec(`
+			UPDATE reimbursements
+			SET status = $2, reviewed_by = $3, reviewed_at = now(), review_reason = $4, updated_at = now(), updated_by = $3, updated_ip = $5
+			WHERE id = $1 AND status = 'pending'
+		`, reimbursementID, req.Status, approverID, reason, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review reimbursement"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Reimbursement has already been reviewed"})
+			return
+		}
+
+		action := "APPROVE"
+		if req.Status == models.ReviewRejected {
+			action = "REJECT"
+		}
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, action, "reimbursements", reimbursementID.String(), approverID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"id": reimbursementID, "status": req.Status})
+	}
+}
+
+// SubmitReimbursement records a reimbursement claim for approval. A claim over the limits of its category is
+// flagged, or reduced to what the limits leave when the category caps claims.
 func SubmitReimbursement(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req ReimbursementRequest
@@ -25,6 +205,10 @@ func SubmitReimbursement(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !req.Amount.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+			return
+		}
 
 		userIDStr := c.GetString("user_id")
 		userID, err := uuid.Parse(userIDStr)
@@ -40,31 +224,107 @@ func SubmitReimbursement(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format"})
 			return
 		}
+		if rejectLockedPeriod(c, db, userID, parsedDate) {
+			return
+		}
+
+		category, err := scanReimbursementCategory(db.QueryRow(reimbursementCategorySelect+` WHERE code = $1`, req.Category))
+		if err == sql.ErrNoRows || (err == nil && !category.Active) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reimbursement category"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reimbursement category"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		//claims of the user are serialized, so concurrent claims can't both fit in what the limit leaves
+		if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		//claims of the category in the attendance period of the claim count towards its period limit, rejected ones
+		//don't; a date outside every period falls back to its calendar month
+		var periodStart, periodEnd time.Time
+		err = tx.QueryRow(`
+			SELECT start_date, end_date
+			FROM attendance_periods
+			WHERE $1::date BETWEEN start_date AND end_date
+		`, parsedDate).Scan(&periodStart, &periodEnd)
+		if err == sql.ErrNoRows {
+			periodStart = parsedDate.AddDate(0, 0, 1-parsedDate.Day())
+			periodEnd = periodStart.AddDate(0, 1, -1)
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance period"})
+			return
+		}
+		var used money.Decimal
+		err = tx.QueryRow(`
+			SELECT COALESCE(SUM(amount), 0)
+			FROM reimbursements
+			WHERE user_id = $1 AND category_code = $2 AND status <> 'rejected' AND date BETWEEN $3 AND $4
+		`, userID, category.Code, periodStart, periodEnd).Scan(&used)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch claimed reimbursements"})
+			return
+		}
+		amount, overLimit, err := categoryLimits(category).Apply(req.Amount, used)
+		if err != nil {
+			if errors.Is(err, payroll.ErrReimbursementLimit) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply reimbursement limits"})
+			}
+			return
+		}
 
 		id := uuid.New()
 
-		_, err = db.Exec(`
-			INSERT INTO reimbursements 
-			(id, user_id, amount, description, date, created_by, updated_by, created_ip, updated_ip)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		`, id, userID, req.Amount, req.Description, parsedDate, userID, userID, ip, ip)
+		_, err = tx.Exec(`
+			INSERT INTO reimbursements
+			(id, user_id, category_code, claimed_amount, amount, over_limit, description, date, created_by, updated_by, created_ip, updated_ip)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, id, userID, category.Code, req.Amount, amount, overLimit, req.Description, parsedDate, userID, userID, ip, ip)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit reimbursement"})
 			return
 		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit reimbursement"})
+			return
+		}
 
 		//Audit log
 		changeData := map[string]interface{}{
-			"user_id":     userID,
-			"amount":      req.Amount,
-			"description": req.Description,
-			"date":        req.Date,
+			"user_id":        userID,
+			"category":       category.Code,
+			"claimed_amount": req.Amount,
+			"amount":         amount,
+			"over_limit":     overLimit,
+			"description":    req.Description,
+			"date":           req.Date,
 		}
 
 		jsonBytes, _ := json.Marshal(changeData)
 		utils.LogAudit(db, "INSERT", "reimbursements", id.String(), userID, net.ParseIP(ip), jsonBytes)
 
-		c.JSON(http.StatusOK, gin.H{"message": "Reimbursement submitted successfully"})
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Reimbursement submitted successfully",
+			"id":             id,
+			"status":         models.ReviewPending,
+			"category":       category.Code,
+			"claimed_amount": req.Amount,
+			"amount":         amount,
+			"over_limit":     overLimit,
+		})
 	}
 }
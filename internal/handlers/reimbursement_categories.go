@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+var reimbursementCategoryCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+type ReimbursementCategoryRequest struct {
+	Code            string         `json:"code"` //e.g. medical, travel, set on creation only
+	Name            string         `json:"name" binding:"required"`
+	PerClaimLimit   *money.Decimal `json:"per_claim_limit"`   //no limit when omitted
+	PerPeriodLimit  *money.Decimal `json:"per_period_limit"`  //per attendance period, no limit when omitted
+	OverLimitAction string         `json:"over_limit_action"` //flag or cap, defaults to flag
+	Active          *bool          `json:"active"`            //defaults to true
+}
+
+// limits returns the limits of the request, checked
+func (r *ReimbursementCategoryRequest) limits() (payroll.ReimbursementLimits, error) {
+	if r.OverLimitAction == "" {
+		r.OverLimitAction = payroll.OverLimitFlag
+	}
+	limits := payroll.ReimbursementLimits{PerClaim: r.PerClaimLimit, PerPeriod: r.PerPeriodLimit, OverLimit: r.OverLimitAction}
+	return limits, limits.Validate()
+}
+
+// categoryLimits returns the limits of a category
+func categoryLimits(category models.ReimbursementCategory) payroll.ReimbursementLimits {
+	return payroll.ReimbursementLimits{
+		PerClaim:  category.PerClaimLimit,
+		PerPeriod: category.PerPeriodLimit,
+		OverLimit: category.OverLimitAction,
+	}
+}
+
+const reimbursementCategorySelect = `
+	SELECT code, name, per_claim_limit, per_period_limit, over_limit_action, is_active
+	FROM reimbursement_categories
+`
+
+func scanReimbursementCategory(row interface{ Scan(...interface{}) error }) (models.ReimbursementCategory, error) {
+	var category models.ReimbursementCategory
+	err := row.Scan(&category.Code, &category.Name, &category.PerClaimLimit, &category.PerPeriodLimit,
+		&category.OverLimitAction, &category.Active)
+	return category, err
+}
+
+// listReimbursementCategories responds with the categories by name, only the active ones when activeOnly is set
+func listReimbursementCategories(c *gin.Context, db *sql.DB, activeOnly bool) {
+	query := reimbursementCategorySelect
+	if activeOnly {
+		query += ` WHERE is_active`
+	}
+	rows, err := db.Query(query + ` ORDER BY name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reimbursement categories"})
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.ReimbursementCategory{}
+	for rows.Next() {
+		category, err := scanReimbursementCategory(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan reimbursement category"})
+			return
+		}
+		categories = append(categories, category)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// ListReimbursementCategories returns every reimbursement category, including the inactive ones
+func ListReimbursementCategories(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listReimbursementCategories(c, db, false)
+	}
+}
+
+// ListActiveReimbursementCategories returns the categories employees can claim in
+func ListActiveReimbursementCategories(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listReimbursementCategories(c, db, true)
+	}
+}
+
+// bindReimbursementCategory reads and checks a category request, answering the request when it is invalid
+func bindReimbursementCategory(c *gin.Context) (ReimbursementCategoryRequest, bool) {
+	var req ReimbursementCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return req, false
+	}
+	if _, err := req.limits(); err != nil {
+		if errors.Is(err, payroll.ErrInvalidReimbursementLimits) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate reimbursement category"})
+		}
+		return req, false
+	}
+	if req.Active == nil {
+		active := true
+		req.Active = &active
+	}
+	return req, true
+}
+
+// CreateReimbursementCategory adds a category employees can claim reimbursements in
+func CreateReimbursementCategory(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindReimbursementCategory(c)
+		if !ok {
+			return
+		}
+		if !reimbursementCategoryCodePattern.MatchString(req.Code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code must be lower case letters, digits and underscores, e.g. medical"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		ip := c.ClientIP()
+
+		_, err := db.Exec(`
+			INSERT INTO reimbursement_categories (
+				code, name, per_claim_limit, per_period_limit, over_limit_action, is_active,
+				created_by, updated_by, created_ip, updated_ip
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $8)
+		`, req.Code, req.Name, req.PerClaimLimit, req.PerPeriodLimit, req.OverLimitAction, *req.Active, adminID, ip)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "A reimbursement category with this code already exists"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reimbursement category"})
+			}
+			return
+		}
+
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "INSERT", "reimbursement_categories", req.Code, adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, models.ReimbursementCategory{
+			Code:            req.Code,
+			Name:            req.Name,
+			PerClaimLimit:   req.PerClaimLimit,
+			PerPeriodLimit:  req.PerPeriodLimit,
+			OverLimitAction: req.OverLimitAction,
+			Active:          *req.Active,
+		})
+	}
+}
+
+// UpdateReimbursementCategory replaces the name, limits and active flag of a category. The limits apply to claims
+// submitted from now on, claims already submitted keep their amount. An inactive category takes no new claims.
+func UpdateReimbursementCategory(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindReimbursementCategory(c)
+		if !ok {
+			return
+		}
+		req.Code = c.Param("code")
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		ip := c.ClientIP()
+
+		res, err := db.Exec(`
+			UPDATE reimbursement_categories
+			SET name = $2, per_claim_limit = $3, per_period_limit = $4, over_limit_action = $5, is_active = $6,
+				updated_at = now(), updated_by = $7, updated_ip = $8
+			WHERE code = $1
+		`, req.Code, req.Name, req.PerClaimLimit, req.PerPeriodLimit, req.OverLimitAction, *req.Active, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reimbursement category"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reimbursement category not found"})
+			return
+		}
+
+		changeData, _ := json.Marshal(req)
+		utils.LogAudit(db, "UPDATE", "reimbursement_categories", req.Code, adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, models.ReimbursementCategory{
+			Code:            req.Code,
+			Name:            req.Name,
+			PerClaimLimit:   req.PerClaimLimit,
+			PerPeriodLimit:  req.PerPeriodLimit,
+			OverLimitAction: req.OverLimitAction,
+			Active:          *req.Active,
+		})
+	}
+}
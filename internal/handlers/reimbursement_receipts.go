@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/storage"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxReceiptsPerUpload is the most files UploadReceipts accepts at once
+const maxReceiptsPerUpload = 10
+
+// receiptTypes are the accepted receipt content types, detected from the content rather than trusted from the client
+var receiptTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+}
+
+// receiptContentType detects the content type of an uploaded file from its first bytes
+func receiptContentType(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	return contentType, nil
+}
+
+// receiptFileName keeps the base name of an uploaded file, the path a browser may send is dropped
+func receiptFileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "receipt"
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+// canAccessReceipts tells whether the actor may see the receipts of a claim: its owner and the approvers, which
+// include admins. Other callers get 403 and the denial is audited like a failed authorization.
+func canAccessReceipts(c *gin.Context, db *sql.DB, actor, ownerID uuid.UUID) bool {
+	role := c.GetString("role")
+	if actor == ownerID || rbac.Can(role, rbac.PermApproveReimbursements) {
+		return true
+	}
+	changeData, _ := json.Marshal(map[string]string{
+		"role":   role,
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+	})
+	utils.LogAudit(db, "DENY", "authorization", c.FullPath(), actor, net.ParseIP(c.ClientIP()), changeData)
+	c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+	return false
+}
+
+// reimbursementOwner reads the reimbursement_id parameter and returns the owner and status of the claim,
+// answering the request when it doesn't exist
+func reimbursementOwner(c *gin.Context, db *sql.DB) (reimbursementID, ownerID uuid.UUID, status string, ok bool) {
+	reimbursementID, err := uuid.Parse(c.Param("reimbursement_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reimbursement_id"})
+		return
+	}
+	err = db.QueryRow(`SELECT user_id, status FROM reimbursements WHERE id = $1`, reimbursementID).Scan(&ownerID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reimbursement not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reimbursement"})
+		return
+	}
+	return reimbursementID, ownerID, status, true
+}
+
+// UploadReceipts attaches one or more receipt files, uploaded as files in a multipart form, to a pending claim of
+// the authenticated employee. Files must be PDF, JPEG, PNG or WebP and at most RECEIPT_MAX_SIZE bytes each.
+func UploadReceipts(db *sql.DB, store storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		//the whole form is bounded by the largest upload allowed, with room for the multipart framing
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxReceiptsPerUpload*config.ReceiptMaxSize+1<<20)
+		form, err := c.MultipartForm()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload is too large"})
+			return
+		}
+		if err != nil || len(form.File["files"]) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one receipt is required in the files field"})
+			return
+		}
+		headers := form.File["files"]
+		if len(headers) > maxReceiptsPerUpload {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d receipts can be uploaded at once", maxReceiptsPerUpload)})
+			return
+		}
+
+		//every file is checked before any is stored
+		receipts := make([]models.ReimbursementReceipt, len(headers))
+		for i, header := range headers {
+			name := receiptFileName(header.Filename)
+			if header.Size == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " is empty"})
+				return
+			}
+			if header.Size > config.ReceiptMaxSize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s is larger than %d bytes", name, config.ReceiptMaxSize)})
+				return
+			}
+			contentType, err := receiptContentType(header)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read " + name})
+				return
+			}
+			if !receiptTypes[contentType] {
+				c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": name + " must be a PDF, JPEG, PNG or WebP file"})
+				return
+			}
+			receipts[i] = models.ReimbursementReceipt{ID: uuid.NewString(), FileName: name, ContentType: contentType, Size: header.Size}
+		}
+
+		reimbursementID, ownerID, status, ok := reimbursementOwner(c, db)
+		if !ok {
+			return
+		}
+		if ownerID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only attach receipts to your own reimbursements"})
+			return
+		}
+		if status != models.ReviewPending {
+			c.JSON(http.StatusConflict, gin.H{"error": "Receipts can only be attached while the reimbursement is pending"})
+			return
+		}
+
+		ip := c.ClientIP()
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		//files stored before a failure are removed again, the rows go with the rollback
+		var stored []string
+		removeStored := func() {
+			for _, key := range stored {
+				if err := store.Delete(key); err != nil {
+					log.Printf("[UploadReceipts] Failed to remove receipt %s: %v\n", key, err)
+				}
+			}
+		}
+
+		now := time.Now()
+		for i, header := range headers {
+			receipt := &receipts[i]
+			receipt.ReimbursementID = reimbursementID.String()
+			receipt.CreatedAt = now
+
+			file, err := header.Open()
+			if err != nil {
+				removeStored()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read " + receipt.FileName})
+				return
+			}
+			hash := sha256.New()
+			err = store.Put(receipt.ID, io.TeeReader(file, hash))
+			file.Close()
+			if err != nil {
+				removeStored()
+				log.Printf("[UploadReceipts] Failed to store receipt: %v\n", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store receipt"})
+				return
+			}
+			stored = append(stored, receipt.ID)
+			receipt.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+			_, err = tx.Exec(`
+				INSERT INTO reimbursement_receipts (id, reimbursement_id, file_name, content_type, size, sha256, storage_key, created_by, created_ip)
+				VALUES ($1, $2, $3, $4, $5, $6, $1, $7, $8)
+			`, receipt.ID, reimbursementID, receipt.FileName, receipt.ContentType, receipt.Size, receipt.SHA256, userID, ip)
+			if err != nil {
+				removeStored()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save receipt"})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			removeStored()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save receipts"})
+			return
+		}
+
+		for _, receipt := range receipts {
+			changeData, _ := json.Marshal(receipt)
+			utils.LogAudit(db, "INSERT", "reimbursement_receipts", receipt.ID, userID, net.ParseIP(ip), changeData)
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"receipts": receipts})
+	}
+}
+
+// ListReceipts returns the receipts of a claim, to its owner and the approvers
+func ListReceipts(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		reimbursementID, ownerID, _, ok := reimbursementOwner(c, db)
+		if !ok || !canAccessReceipts(c, db, userID, ownerID) {
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, reimbursement_id, file_name, content_type, size, sha256, created_at
+			FROM reimbursement_receipts
+			WHERE reimbursement_id = $1
+			ORDER BY created_at, file_name
+		`, reimbursementID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipts"})
+			return
+		}
+		defer rows.Close()
+
+		receipts := []models.ReimbursementReceipt{}
+		for rows.Next() {
+			var r models.ReimbursementReceipt
+			if err := rows.Scan(&r.ID, &r.ReimbursementID, &r.FileName, &r.ContentType, &r.Size, &r.SHA256, &r.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan receipt"})
+				return
+			}
+			receipts = append(receipts, r)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"receipts": receipts})
+	}
+}
+
+// DownloadReceipt sends a receipt file to the owner of the claim or an approver. The SHA-256 checksum recorded
+// on upload is sent in the X-Checksum-SHA256 header so the file can be verified.
+func DownloadReceipt(db *sql.DB, store storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		reimbursementID, err := uuid.Parse(c.Param("reimbursement_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reimbursement_id"})
+			return
+		}
+		receiptID, err := uuid.Parse(c.Param("receipt_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt_id"})
+			return
+		}
+
+		var ownerID uuid.UUID
+		var fileName, contentType, checksum, key string
+		var size int64
+		err = db.QueryRow(`
+			SELECT r.user_id, rr.file_name, rr.content_type, rr.size, rr.sha256, rr.storage_key
+			FROM reimbursement_receipts rr
+			JOIN reimbursements r ON r.id = rr.reimbursement_id
+			WHERE rr.id = $1 AND rr.reimbursement_id = $2
+		`, receiptID, reimbursementID).Scan(&ownerID, &fileName, &contentType, &size, &checksum, &key)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipt"})
+			return
+		}
+		if !canAccessReceipts(c, db, userID, ownerID) {
+			return
+		}
+
+		file, err := store.Open(key)
+		if err != nil {
+			log.Printf("[DownloadReceipt] Failed to open receipt %s: %v\n", key, err)
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Receipt file is missing"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open receipt"})
+			}
+			return
+		}
+		defer file.Close()
+
+		c.DataFromReader(http.StatusOK, size, contentType, file, map[string]string{
+			"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
+			"X-Checksum-SHA256":      checksum,
+			"X-Content-Type-Options": "nosniff",
+			"Cache-Control":          "private, no-store",
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// isDecision reports whether status is an outcome of a review
+func isDecision(status string) bool {
+	return status == models.ReviewApproved || status == models.ReviewRejected
+}
+
+// reviewFilters reads the status and period_id query parameters of a list of requests, answering the request
+// when they are invalid. alias is the alias of the requests table. status falls back to defaultStatus, every
+// status is listed when both are empty.
+func reviewFilters(c *gin.Context, db *sql.DB, alias, defaultStatus string, conditions []string, args []interface{}) ([]string, []interface{}, bool) {
+	if status := c.DefaultQuery("status", defaultStatus); status != "" {
+		if !models.IsReviewStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved or rejected"})
+			return nil, nil, false
+		}
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf(`%s.status = $%d`, alias, len(args)))
+	}
+	if periodID := c.Query("period_id"); periodID != "" {
+		var start, end time.Time
+		err := db.QueryRow(`SELECT start_date, end_date FROM attendance_periods WHERE id = $1`, periodID).Scan(&start, &end)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attendance period not found"})
+			return nil, nil, false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, nil, false
+		}
+		args = append(args, start, end)
+		conditions = append(conditions, fmt.Sprintf(`%s.date BETWEEN $%d AND $%d`, alias, len(args)-1, len(args)))
+	}
+	return conditions, args, true
+}
+
+// rejectReview answers the request when a request for something dated date can't be reviewed: approvers can't
+// review their own requests, a request is reviewed once, and requests in a period whose payroll is finalized
+// can no longer change. what names the request in the messages.
+func rejectReview(c *gin.Context, db *sql.DB, what string, ownerID, approverID uuid.UUID, status string, date time.Time) bool {
+	if ownerID == approverID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot review your own " + what})
+		return true
+	}
+	if status != models.ReviewPending {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The %s has already been %s", what, status)})
+		return true
+	}
+	finalized, err := inFinalizedPeriod(db, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if finalized {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payroll for this period has been finalized and can no longer be changed"})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// serviceAccountPassword is stored in users.password for service accounts. It is not a
+// bcrypt hash, so password login never succeeds for them.
+const serviceAccountPassword = "!"
+
+type CreateServiceAccountRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name             string   `json:"name" binding:"required"`
+	Scopes           []string `json:"scopes" binding:"required,min=1"`
+	RequireSignature bool     `json:"require_signature"`
+	ExpiresAt        *string  `json:"expires_at"` //RFC 3339, optional
+}
+
+// CreateServiceAccount creates a non-human account that authenticates with API keys only
+func CreateServiceAccount(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateServiceAccountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		id := uuid.New()
+		_, err := db.Exec(`
+			INSERT INTO users (id, username, password, role, created_by, updated_by)
+			VALUES ($1, $2, $3, $4, $5, $5)
+		`, id, req.Name, serviceAccountPassword, string(rbac.RoleService), adminID)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Name is already taken"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+			}
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]string{"name": req.Name, "role": string(rbac.RoleService)})
+		utils.LogAudit(db, "INSERT", "users", id.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "name": req.Name})
+	}
+}
+
+// ListServiceAccounts returns every service account
+func ListServiceAccounts(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Query(`
+			SELECT id, username, is_active, created_at FROM users WHERE role = $1 ORDER BY username
+		`, string(rbac.RoleService))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service accounts"})
+			return
+		}
+		defer rows.Close()
+
+		accounts := []models.ServiceAccount{}
+		for rows.Next() {
+			var a models.ServiceAccount
+			if err := rows.Scan(&a.ID, &a.Name, &a.IsActive, &a.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan service account"})
+				return
+			}
+			accounts = append(accounts, a)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"service_accounts": accounts})
+	}
+}
+
+// serviceAccountExists checks that id names a service account, responding with 404 when it doesn't
+func serviceAccountExists(c *gin.Context, db *sql.DB, id uuid.UUID) bool {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role = $2)`, id, string(rbac.RoleService)).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return false
+	}
+	return true
+}
+
+// CreateAPIKey issues a scoped key for a service account. The key and its signing secret are returned once;
+// only the hash of the key is stored, the signing secret is kept to verify signatures.
+func CreateAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("account_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+
+		var req CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !rbac.IsValidScope(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+				return
+			}
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresAt != nil {
+			t, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+			if err != nil || !t.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be a future RFC 3339 timestamp"})
+				return
+			}
+			expiresAt = &t
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		if !serviceAccountExists(c, db, accountID) {
+			return
+		}
+
+		key, prefix, hash, err := utils.GenerateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+			return
+		}
+		signingSecret, err := utils.GenerateSigningSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+			return
+		}
+
+		ip := c.ClientIP()
+		keyID := uuid.New()
+		_, err = db.Exec(`
+			INSERT INTO api_keys (id, service_account_id, name, key_prefix, key_hash, signing_secret, scopes, require_signature, expires_at, created_by, created_ip)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`, keyID, accountID, req.Name, prefix, hash, signingSecret, pq.Array(req.Scopes), req.RequireSignature, expiresAt, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"service_account_id": accountID,
+			"name":               req.Name,
+			"key_prefix":         prefix,
+			"scopes":             req.Scopes,
+			"require_signature":  req.RequireSignature,
+			"expires_at":         expiresAt,
+		})
+		utils.LogAudit(db, "INSERT", "api_keys", keyID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"id":                keyID,
+			"key":               key,
+			"signing_secret":    signingSecret,
+			"key_prefix":        prefix,
+			"scopes":            req.Scopes,
+			"require_signature": req.RequireSignature,
+			"expires_at":        expiresAt,
+			"message":           "Store this key and its signing secret now, they will not be shown again",
+		})
+	}
+}
+
+// ListAPIKeys returns the keys of a service account without their secrets
+func ListAPIKeys(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("account_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, service_account_id, name, key_prefix, scopes, require_signature,
+			       expires_at, last_used_at, last_used_ip, revoked_at, created_at
+			FROM api_keys
+			WHERE service_account_id = $1
+			ORDER BY created_at DESC
+		`, accountID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+			return
+		}
+		defer rows.Close()
+
+		keys := []models.APIKey{}
+		for rows.Next() {
+			var k models.APIKey
+			err := rows.Scan(&k.ID, &k.ServiceAccountID, &k.Name, &k.KeyPrefix, pq.Array(&k.Scopes), &k.RequireSignature,
+				&k.ExpiresAt, &k.LastUsedAt, &k.LastUsedIP, &k.RevokedAt, &k.CreatedAt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan API key"})
+				return
+			}
+			keys = append(keys, k)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+	}
+}
+
+// RevokeAPIKey disables a key immediately
+func RevokeAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("account_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+			return
+		}
+		keyID, err := uuid.Parse(c.Param("key_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key_id"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE api_keys SET revoked_at = now()
+			WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL
+		`, keyID, accountID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]string{"service_account_id": accountID.String()})
+		utils.LogAudit(db, "REVOKE", "api_keys", keyID.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+	}
+}
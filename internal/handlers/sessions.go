@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const sessionSelect = `
+	SELECT id, user_id, ip_address, user_agent, created_at, last_seen_at, last_seen_ip, expires_at, revoked_at, revoked_reason
+	FROM sessions
+`
+
+// activeSession limits a session query to sessions that can still be used
+const activeSession = ` AND revoked_at IS NULL AND expires_at > now()`
+
+// fetchSessions lists the sessions of a user, newest activity first. currentID marks the caller's own session.
+func fetchSessions(db *sql.DB, userID uuid.UUID, includeEnded bool, currentID string) ([]models.Session, error) {
+	query := sessionSelect + ` WHERE user_id = $1`
+	if !includeEnded {
+		query += activeSession
+	}
+	rows, err := db.Query(query+` ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		err := rows.Scan(&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.IssuedAt, &s.LastSeenAt, &s.LastSeenIP,
+			&s.ExpiresAt, &s.RevokedAt, &s.RevokedReason)
+		if err != nil {
+			return nil, err
+		}
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// terminateSession ends a session of userID and audits it, responding with 404 when there is no such active session
+func terminateSession(c *gin.Context, db *sql.DB, userID uuid.UUID, sessionID string) {
+	actor, ok := actorID(c)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2`+activeSession+`)`, sessionID, userID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := revokeSession(db, sessionID, sessionTerminated); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to terminate session"})
+		return
+	}
+
+	changeData, _ := json.Marshal(map[string]string{"user_id": userID.String()})
+	utils.LogAudit(db, "TERMINATE", "sessions", sessionID, actor, net.ParseIP(c.ClientIP()), changeData)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session terminated successfully"})
+}
+
+// ListMySessions returns the active sessions of the authenticated user
+func ListMySessions(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		sessions, err := fetchSessions(db, userID, false, c.GetString("session_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	}
+}
+
+// TerminateMySession signs the authenticated user out of one of their sessions
+func TerminateMySession(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, err := uuid.Parse(c.Param("session_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session_id"})
+			return
+		}
+		userID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		terminateSession(c, db, userID, sessionID.String())
+	}
+}
+
+// ListUserSessions returns the sessions of any user, ended ones too with include_ended=true
+func ListUserSessions(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		includeEnded := false
+		if v := c.Query("include_ended"); v != "" {
+			includeEnded, err = strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid include_ended filter"})
+				return
+			}
+		}
+
+		sessions, err := fetchSessions(db, targetID, includeEnded, c.GetString("session_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	}
+}
+
+// TerminateUserSession ends one session of any user
+func TerminateUserSession(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		sessionID, err := uuid.Parse(c.Param("session_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session_id"})
+			return
+		}
+
+		terminateSession(c, db, targetID, sessionID.String())
+	}
+}
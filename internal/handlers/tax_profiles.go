@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TaxProfileRequest struct {
+	Married    *bool `json:"married" binding:"required"`
+	Dependents *int  `json:"dependents" binding:"required,min=0"`
+}
+
+// taxStatus formats a profile the way the next payroll run will record it on the payslip
+func taxStatus(p models.TaxProfile) string {
+	rules := config.TaxRules
+	if rules == nil {
+		defaults := payroll.DefaultTaxRules()
+		rules = &defaults
+	}
+	return payroll.TaxProfile{Married: p.Married, Dependents: p.Dependents}.Status(rules.MaxDependents)
+}
+
+// GetTaxProfile returns the marital status and dependents used for income tax withholding
+func GetTaxProfile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		//employees without a profile are withheld as single without dependents
+		var profile models.TaxProfile
+		err = db.QueryRow(`
+			SELECT u.id, COALESCE(tp.married, false), COALESCE(tp.dependents, 0), tp.updated_at
+			FROM users u
+			LEFT JOIN tax_profiles tp ON tp.user_id = u.id
+			WHERE u.id = $1
+		`, userID).Scan(&profile.UserID, &profile.Married, &profile.Dependents, &profile.UpdatedAt)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tax profile"})
+			return
+		}
+		profile.Status = taxStatus(profile)
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+// UpdateTaxProfile sets the marital status and dependents of an employee. It applies to the next payroll run.
+func UpdateTaxProfile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var req TaxProfileRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "married and a non-negative dependents are required"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		ip := c.ClientIP()
+		res, err := db.Exec(`
+			INSERT INTO tax_profiles (user_id, married, dependents, updated_at, updated_by, updated_ip)
+			SELECT u.id, $2, $3, now(), $4, $5 FROM users u WHERE u.id = $1 AND u.role <> 'service'
+			ON CONFLICT (user_id) DO UPDATE
+			SET married = EXCLUDED.married, dependents = EXCLUDED.dependents,
+				updated_at = now(), updated_by = EXCLUDED.updated_by, updated_ip = EXCLUDED.updated_ip
+		`, userID, *req.Married, *req.Dependents, adminID, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax profile"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		profile := models.TaxProfile{UserID: userID.String(), Married: *req.Married, Dependents: *req.Dependents}
+		profile.Status = taxStatus(profile)
+
+		changeData, _ := json.Marshal(profile)
+		utils.LogAudit(db, "UPDATE", "tax_profiles", userID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
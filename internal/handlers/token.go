@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenRestriction picks what a new access token is limited to: a pending password change first,
+// then a missing 2FA enrollment when it is mandatory for the role
+func tokenRestriction(role string, mustChangePassword, totpEnabled bool) string {
+	if mustChangePassword {
+		return utils.RestrictionPasswordChange
+	}
+	if config.RequireAdminMFA && role == string(rbac.RoleAdmin) && !totpEnabled {
+		return utils.RestrictionMFAEnrollment
+	}
+	return ""
+}
+
+// startSession records a new login session for the device making the request
+func startSession(db *sql.DB, c *gin.Context, userID string) (string, error) {
+	sessionID := uuid.New().String()
+	_, err := db.Exec(`
+		INSERT INTO sessions (id, user_id, ip_address, user_agent, last_seen_ip, expires_at)
+		VALUES ($1, $2, $3, $4, $3, $5)
+	`, sessionID, userID, c.ClientIP(), c.Request.UserAgent(), time.Now().Add(config.RefreshTokenTTL))
+	if err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// issueTokens creates an access token plus a rotating refresh token for a session and stores the refresh token hash
+func issueTokens(db *sql.DB, sessionID, userID, role, restriction, ip string) (gin.H, error) {
+	access, err := utils.GenerateJWT(userID, sessionID, role, restriction)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshID := uuid.New()
+	_, err = db.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, session_id, token_hash, access_jti, access_expires_at, expires_at, created_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, refreshID, userID, sessionID, refreshHash, access.JTI, access.ExpiresAt, time.Now().Add(config.RefreshTokenTTL), ip)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := gin.H{
+		"token":         access.Token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(time.Until(access.ExpiresAt).Seconds()),
+	}
+	switch restriction {
+	case utils.RestrictionPasswordChange:
+		tokens["password_change_required"] = true
+	case utils.RestrictionMFAEnrollment:
+		tokens["mfa_enrollment_required"] = true
+	}
+	return tokens, nil
+}
+
+// startSessionWithTokens starts a session and issues its first token pair
+func startSessionWithTokens(db *sql.DB, c *gin.Context, userID, role, restriction string) (gin.H, error) {
+	sessionID, err := startSession(db, c, userID)
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(db, sessionID, userID, role, restriction, c.ClientIP())
+}
+
+// Reasons recorded on sessions.revoked_reason
+const (
+	sessionLogout     = "logout"
+	sessionTerminated = "terminated"
+	sessionRevokedAll = "revoked_all"
+)
+
+// revokeTokensWhere denylists the live access tokens and revokes the refresh tokens and sessions matching
+// column = value. column is always a constant chosen by the callers below.
+func revokeTokensWhere(db *sql.DB, column, value, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, access_expires_at FROM refresh_tokens
+		WHERE `+column+` = $1 AND access_expires_at > now()
+		ON CONFLICT (jti) DO NOTHING
+	`, value)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE `+column+` = $1 AND revoked_at IS NULL
+	`, value)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sessions SET revoked_at = now(), revoked_reason = $2
+		WHERE `+column+` = $1 AND revoked_at IS NULL
+	`, value, reason)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeAllUserTokens denylists every live access token of the user and revokes all refresh tokens and sessions
+func revokeAllUserTokens(db *sql.DB, userID string) error {
+	return revokeTokensWhere(db, "user_id", userID, sessionRevokedAll)
+}
+
+// revokeSession ends a single login session
+func revokeSession(db *sql.DB, sessionID, reason string) error {
+	return revokeTokensWhere(db, "session_id", sessionID, reason)
+}
+
+func RefreshTokenHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var refreshID, sessionID, userID, role string
+		var mustChangePassword, totpEnabled bool
+		var expiresAt time.Time
+		var revokedAt sql.NullTime
+		err := db.QueryRow(`
+			SELECT t.id, t.session_id, t.user_id, u.role, u.must_change_password, u.totp_enabled, t.expires_at, t.revoked_at
+			FROM refresh_tokens t
+			JOIN users u ON u.id = t.user_id
+			WHERE t.token_hash = $1 AND u.is_active
+		`, utils.HashToken(req.RefreshToken)).Scan(&refreshID, &sessionID, &userID, &role, &mustChangePassword, &totpEnabled, &expiresAt, &revokedAt)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+
+		//a revoked refresh token being presented again means it leaked, so kill every session of the user
+		if revokedAt.Valid {
+			if err := revokeAllUserTokens(db, userID); err != nil {
+				log.Printf("[RefreshToken] Failed to revoke tokens after reuse: %v\n", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+			return
+		}
+
+		if time.Now().After(expiresAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired"})
+			return
+		}
+
+		//claim the token so concurrent refreshes with the same token can't both succeed
+		res, err := db.Exec(`
+			UPDATE refresh_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL
+		`, refreshID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+			return
+		}
+
+		ip := c.ClientIP()
+		tokens, err := issueTokens(db, sessionID, userID, role, tokenRestriction(role, mustChangePassword, totpEnabled), ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		//the session lives as long as its newest refresh token
+		_, err = db.Exec(`
+			UPDATE sessions SET last_seen_at = now(), last_seen_ip = $2, expires_at = $3 WHERE id = $1
+		`, sessionID, ip, time.Now().Add(config.RefreshTokenTTL))
+		if err != nil {
+			log.Printf("[RefreshToken] Failed to update session: %v\n", err)
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func LogoutHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LogoutRequest
+		//body is optional, the access token alone is enough to log out
+		_ = c.ShouldBindJSON(&req)
+
+		userID := c.GetString("user_id")
+		jti := c.GetString("jti")
+		expiresAt := c.GetTime("token_expires_at")
+
+		_, err := db.Exec(`
+			INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+			ON CONFLICT (jti) DO NOTHING
+		`, jti, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+
+		//end the login session, which also revokes every token issued for it
+		if sessionID := c.GetString("session_id"); sessionID != "" {
+			if err := revokeSession(db, sessionID, sessionLogout); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+				return
+			}
+		}
+
+		//revoke the refresh token issued with this access token, plus the one given in the body if any
+		_, err = db.Exec(`
+			UPDATE refresh_tokens SET revoked_at = now()
+			WHERE user_id = $1 AND revoked_at IS NULL AND (access_jti = $2 OR token_hash = $3)
+		`, userID, jti, utils.HashToken(req.RefreshToken))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	}
+}
+
+func RevokeUserSessions(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		adminID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+			return
+		}
+
+		if err := revokeAllUserTokens(db, targetID.String()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+
+		ip := c.ClientIP()
+		changeData, _ := json.Marshal(map[string]string{"user_id": targetID.String()})
+		utils.LogAudit(db, "REVOKE_SESSIONS", "refresh_tokens", targetID.String(), adminID, net.ParseIP(ip), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": "All sessions for the user have been revoked"})
+	}
+}
+
+// JWKSHandler publishes the public signing keys so other services can verify our tokens
+func JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, utils.CurrentKeyStore().JWKS())
+	}
+}
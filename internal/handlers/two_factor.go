@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCount = 10
+
+type VerifyTwoFactorRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user. It only becomes active once verified.
+func EnrollTwoFactor(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+			return
+		}
+
+		var username string
+		var enabled bool
+		err = db.QueryRow(`SELECT username, totp_enabled FROM users WHERE id = $1`, userID).Scan(&username, &enabled)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		if enabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+
+		_, err = db.Exec(`
+			UPDATE users SET totp_secret = $2, totp_last_step = NULL, updated_at = now() WHERE id = $1
+		`, userID, secret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":           secret,
+			"provisioning_uri": utils.TOTPProvisioningURI(secret, config.TOTPIssuer, username),
+		})
+	}
+}
+
+// VerifyTwoFactor confirms enrollment with a first code, enables 2FA and returns the recovery codes
+func VerifyTwoFactor(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req VerifyTwoFactorRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		userID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+			return
+		}
+
+		var secret sql.NullString
+		var enabled, mustChangePassword bool
+		err = db.QueryRow(`
+			SELECT totp_secret, totp_enabled, must_change_password FROM users WHERE id = $1
+		`, userID).Scan(&secret, &enabled, &mustChangePassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		if enabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		if !secret.Valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment before verifying"})
+			return
+		}
+
+		step, ok := utils.ValidateTOTP(secret.String, req.Code, time.Now(), 0)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`
+			UPDATE users SET totp_enabled = true, totp_last_step = $2, updated_at = now() WHERE id = $1
+		`, userID, step)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
+
+		if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store recovery codes"})
+			return
+		}
+		for _, code := range codes {
+			_, err := tx.Exec(`
+				INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)
+			`, userID, utils.HashToken(code))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store recovery codes"})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
+
+		ip := c.ClientIP()
+		utils.LogAudit(db, "2FA_ENABLED", "users", userID.String(), userID, net.ParseIP(ip), []byte(`{}`))
+
+		//tokens issued before enrollment may be restricted, replace them
+		if err := revokeAllUserTokens(db, userID.String()); err != nil {
+			log.Printf("[VerifyTwoFactor] Failed to revoke tokens: %v\n", err)
+		}
+		//enrolling doesn't lift a pending password change
+		role := c.GetString("role")
+		tokens, err := startSessionWithTokens(db, c, userID.String(), role, tokenRestriction(role, mustChangePassword, true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		tokens["recovery_codes"] = codes
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// TwoFactorLogin completes a login started by LoginHandler with a TOTP or recovery code
+func TwoFactorLogin(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TwoFactorLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		userID, err := utils.ParseMFAToken(req.MFAToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		ip := c.ClientIP()
+		if addressThrottled(c, db, ip) {
+			return
+		}
+
+		var username, role, secret string
+		var mustChangePassword bool
+		var failedCount int
+		var lastStep sql.NullInt64
+		var lastFailedAt, lockedUntil sql.NullTime
+		err = db.QueryRow(`
+			SELECT username, role, must_change_password, totp_secret, totp_last_step,
+				failed_login_count, last_failed_login_at, locked_until
+			FROM users
+			WHERE id = $1 AND totp_enabled AND is_active
+		`, userID).Scan(&username, &role, &mustChangePassword, &secret, &lastStep, &failedCount, &lastFailedAt, &lockedUntil)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		if loginBlocked(c, "Invalid verification code", failedCount, lastFailedAt, lockedUntil) {
+			recordLoginAttempt(db, username, ip, false)
+			return
+		}
+
+		verified := false
+		if req.Code != "" {
+			if step, ok := utils.ValidateTOTP(secret, req.Code, time.Now(), lastStep.Int64); ok {
+				//only advance the step forward, so a parallel request with the same code loses
+				res, err := db.Exec(`
+					UPDATE users SET totp_last_step = $2
+					WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+				`, userID, step)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+					return
+				}
+				n, _ := res.RowsAffected()
+				verified = n == 1
+			}
+		} else {
+			res, err := db.Exec(`
+				UPDATE recovery_codes SET used_at = now()
+				WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			`, userID, utils.HashToken(req.RecoveryCode))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 1 {
+				verified = true
+				if uid, err := uuid.Parse(userID); err == nil {
+					utils.LogAudit(db, "RECOVERY_CODE_USED", "users", userID, uid, net.ParseIP(ip), []byte(`{}`))
+				}
+			}
+		}
+
+		if !verified {
+			recordLoginAttempt(db, username, ip, false)
+			registerFailedLogin(db, userID, username, ip)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		completeLogin(c, db, userID, username, role, tokenRestriction(role, mustChangePassword, true), failedCount > 0 || lockedUntil.Valid)
+	}
+}
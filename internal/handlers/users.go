@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chafid/payroll-project/internal/models"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type CreateUserRequest struct {
+	Username string  `json:"username" binding:"required"`
+	Password string  `json:"password" binding:"required"`
+	Role     string  `json:"role" binding:"required"`
+	LevelID  *string `json:"level_id"`
+	HiredOn  *string `json:"hired_on"` //format YYYY-MM-DD
+}
+
+// UpdateUserRequest changes only the fields that are set, an empty date clears it
+type UpdateUserRequest struct {
+	Role         *string `json:"role"`
+	LevelID      *string `json:"level_id"`
+	HiredOn      *string `json:"hired_on"`      //format YYYY-MM-DD
+	TerminatedOn *string `json:"terminated_on"` //format YYYY-MM-DD, last day of employment
+}
+
+const userSelect = `
+	SELECT u.id, u.username, u.role, u.level_id, l.name, u.is_active, u.hired_on, u.terminated_on, u.created_at, u.updated_at
+	FROM users u
+	LEFT JOIN employee_levels l ON l.id = u.level_id
+`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var u models.User
+	var hiredOn, terminatedOn sql.NullTime
+	err := row.Scan(&u.ID, &u.Username, &u.Role, &u.LevelID, &u.LevelName, &u.IsActive, &hiredOn, &terminatedOn, &u.CreatedAt, &u.UpdatedAt)
+	u.HiredOn = formatOptionalDate(hiredOn)
+	u.TerminatedOn = formatOptionalDate(terminatedOn)
+	return u, err
+}
+
+func formatOptionalDate(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	date := t.Time.Format("2006-01-02")
+	return &date
+}
+
+// parseOptionalDate parses a YYYY-MM-DD date, nil and the empty string are no date
+func parseOptionalDate(value *string) (*time.Time, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", *value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// actorID reads the authenticated user id, responding with 401 when it's missing or malformed
+func actorID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user id in token"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// canAssignRole keeps non-admin user managers (e.g. hr) from granting or taking away admin rights
+func canAssignRole(actorRole, role string) bool {
+	return role != string(rbac.RoleAdmin) || actorRole == string(rbac.RoleAdmin)
+}
+
+// canManageUser checks that the target user exists and that the actor may lock them out of or back into
+// their account, which only admins may do to an admin. It responds when they may not.
+func canManageUser(c *gin.Context, db *sql.DB, targetID uuid.UUID) bool {
+	var targetRole string
+	err := db.QueryRow(`SELECT role FROM users WHERE id = $1`, targetID).Scan(&targetRole)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !canAssignRole(c.GetString("role"), targetRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can manage the account of an admin"})
+		return false
+	}
+	return true
+}
+
+// CreateUser hires a new user with an initial password they must change on first login
+func CreateUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
+			return
+		}
+		if !rbac.IsValidRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+		if !canAssignRole(c.GetString("role"), req.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can assign the admin role"})
+			return
+		}
+		if err := utils.ValidatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hiredOn, err := parseOptionalDate(req.HiredOn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hired_on format"})
+			return
+		}
+
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer tx.Rollback()
+
+		id := uuid.New()
+		_, err = tx.Exec(`
+			INSERT INTO users (id, username, password, role, level_id, hired_on, must_change_password, created_by, updated_by)
+			VALUES ($1, $2, $3, $4, $5, $6, true, $7, $7)
+		`, id, req.Username, hash, req.Role, req.LevelID, hiredOn, adminID)
+		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			}
+			return
+		}
+
+		_, err = tx.Exec(`INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`, id, hash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"username": req.Username,
+			"role":     req.Role,
+			"level_id": req.LevelID,
+			"hired_on": req.HiredOn,
+		})
+		utils.LogAudit(db, "INSERT", "users", id.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		user, err := scanUser(db.QueryRow(userSelect+` WHERE u.id = $1`, id))
+		if err != nil {
+			c.JSON(http.StatusCreated, gin.H{"id": id})
+			return
+		}
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// ListUsers searches users by username with optional role, level and status filters
+func ListUsers(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page_size must be between 1 and %d", maxPageSize)})
+			return
+		}
+
+		var conditions []string
+		var args []interface{}
+		addCondition := func(format string, value interface{}) {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf(format, len(args)))
+		}
+
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			addCondition("u.username ILIKE '%%' || $%d || '%%'", q)
+		}
+		if role := c.Query("role"); role != "" {
+			addCondition("u.role = $%d", role)
+		}
+		if levelID := c.Query("level_id"); levelID != "" {
+			addCondition("u.level_id = $%d", levelID)
+		}
+		if active := c.Query("active"); active != "" {
+			isActive, err := strconv.ParseBool(active)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid active filter"})
+				return
+			}
+			addCondition("u.is_active = $%d", isActive)
+		}
+
+		where := ""
+		if len(conditions) > 0 {
+			where = " WHERE " + strings.Join(conditions, " AND ")
+		}
+
+		var total int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM users u`+where, args...).Scan(&total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count users"})
+			return
+		}
+
+		args = append(args, pageSize, (page-1)*pageSize)
+		rows, err := db.Query(userSelect+where+fmt.Sprintf(` ORDER BY u.username LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			return
+		}
+		defer rows.Close()
+
+		users := []models.User{}
+		for rows.Next() {
+			u, err := scanUser(rows)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
+				return
+			}
+			users = append(users, u)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"users":     users,
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		})
+	}
+}
+
+// UpdateUser changes the role, level and/or employment dates of a user
+func UpdateUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var req UpdateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Role == nil && req.LevelID == nil && req.HiredOn == nil && req.TerminatedOn == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+
+		if req.Role != nil && !rbac.IsValidRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+
+		before, err := scanUser(db.QueryRow(userSelect+` WHERE u.id = $1`, targetID))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+
+		if before.Role == string(rbac.RoleService) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Service accounts are managed under /admin/service-accounts"})
+			return
+		}
+
+		if !canAssignRole(c.GetString("role"), before.Role) || (req.Role != nil && !canAssignRole(c.GetString("role"), *req.Role)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can assign the admin role"})
+			return
+		}
+
+		role := before.Role
+		if req.Role != nil {
+			role = *req.Role
+		}
+		levelID := before.LevelID
+		if req.LevelID != nil {
+			levelID = req.LevelID
+			if *levelID == "" {
+				levelID = nil
+			}
+		}
+		hiredOn, terminatedOn := before.HiredOn, before.TerminatedOn
+		if req.HiredOn != nil {
+			hiredOn = req.HiredOn
+			if *hiredOn == "" {
+				hiredOn = nil
+			}
+		}
+		if req.TerminatedOn != nil {
+			terminatedOn = req.TerminatedOn
+			if *terminatedOn == "" {
+				terminatedOn = nil
+			}
+		}
+		hiredDate, err := parseOptionalDate(hiredOn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hired_on format"})
+			return
+		}
+		terminatedDate, err := parseOptionalDate(terminatedOn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminated_on format"})
+			return
+		}
+		if hiredDate != nil && terminatedDate != nil && terminatedDate.Before(*hiredDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "terminated_on must be on or after hired_on"})
+			return
+		}
+
+		_, err = db.Exec(`
+			UPDATE users SET role = $2, level_id = $3, hired_on = $4, terminated_on = $5, updated_at = now(), updated_by = $6
+			WHERE id = $1
+		`, targetID, role, levelID, hiredDate, terminatedDate, adminID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+
+		//the role is baked into issued tokens, so make the user log in again
+		if role != before.Role {
+			if err := revokeAllUserTokens(db, targetID.String()); err != nil {
+				log.Printf("[UpdateUser] Failed to revoke tokens: %v\n", err)
+			}
+		}
+
+		changeData, _ := json.Marshal(map[string]interface{}{
+			"before": map[string]interface{}{"role": before.Role, "level_id": before.LevelID, "hired_on": before.HiredOn, "terminated_on": before.TerminatedOn},
+			"after":  map[string]interface{}{"role": role, "level_id": levelID, "hired_on": hiredOn, "terminated_on": terminatedOn},
+		})
+		utils.LogAudit(db, "UPDATE", "users", targetID.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		after, err := scanUser(db.QueryRow(userSelect+` WHERE u.id = $1`, targetID))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+			return
+		}
+		c.JSON(http.StatusOK, after)
+	}
+}
+
+// DeactivateUser blocks a user from logging in and revokes their sessions
+func DeactivateUser(db *sql.DB) gin.HandlerFunc {
+	return setUserActive(db, false)
+}
+
+// ReactivateUser allows a deactivated user to log in again
+func ReactivateUser(db *sql.DB) gin.HandlerFunc {
+	return setUserActive(db, true)
+}
+
+func setUserActive(db *sql.DB, active bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		adminID, ok := actorID(c)
+		if !ok {
+			return
+		}
+		if !active && targetID == adminID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+			return
+		}
+		if !canManageUser(c, db, targetID) {
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE users SET is_active = $2, updated_at = now(), updated_by = $3 WHERE id = $1
+		`, targetID, active, adminID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		action := "REACTIVATE"
+		message := "User reactivated successfully"
+		if !active {
+			action = "DEACTIVATE"
+			message = "User deactivated successfully"
+			if err := revokeAllUserTokens(db, targetID.String()); err != nil {
+				log.Printf("[DeactivateUser] Failed to revoke tokens: %v\n", err)
+			}
+		}
+
+		changeData, _ := json.Marshal(map[string]bool{"is_active": active})
+		utils.LogAudit(db, action, "users", targetID.String(), adminID, net.ParseIP(c.ClientIP()), changeData)
+
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	}
+}
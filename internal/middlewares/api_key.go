@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// authenticateAPIKey resolves an API key to its service account and injects user_id, role,
+// api_key_id and api_key_scopes into context. Requests may be signed with X-Signature and
+// X-Signature-Timestamp using the signing secret of the key; keys created with require_signature
+// must be, and a signature is accepted once. It responds and aborts on failure and reports whether
+// the request may continue.
+func authenticateAPIKey(db *sql.DB, c *gin.Context, key string) bool {
+	keyHash := utils.HashToken(key)
+
+	var keyID, serviceAccountID, signingSecret string
+	var scopes []string
+	var requireSignature bool
+	err := db.QueryRow(`
+		SELECT k.id, k.service_account_id, k.signing_secret, k.scopes, k.require_signature
+		FROM api_keys k
+		JOIN users u ON u.id = k.service_account_id
+		WHERE k.key_hash = $1
+		  AND k.revoked_at IS NULL
+		  AND (k.expires_at IS NULL OR k.expires_at > now())
+		  AND u.is_active
+	`, keyHash).Scan(&keyID, &serviceAccountID, &signingSecret, pq.Array(&scopes), &requireSignature)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate API key"})
+		c.Abort()
+		return false
+	}
+
+	timestamp := c.GetHeader("X-Signature-Timestamp")
+	signature := c.GetHeader("X-Signature")
+	if requireSignature || timestamp != "" || signature != "" {
+		if timestamp == "" || signature == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Request signature is required"})
+			c.Abort()
+			return false
+		}
+
+		//the timestamp bounds how long a captured request can be replayed
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature timestamp"})
+			c.Abort()
+			return false
+		}
+		skew := time.Since(time.Unix(unix, 0))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > config.APIKeySignatureWindow {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Signature timestamp is outside the allowed window"})
+			c.Abort()
+			return false
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+				c.Abort()
+				return false
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if !utils.VerifyRequestSignature(signingSecret, timestamp, c.Request.Method, c.Request.URL.RequestURI(), body, signature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid request signature"})
+			c.Abort()
+			return false
+		}
+
+		//a signature is accepted once; it is remembered until its timestamp leaves the window
+		res, err := db.Exec(`
+			WITH expired AS (
+				DELETE FROM api_key_signatures WHERE api_key_id = $1 AND expires_at < now()
+			)
+			INSERT INTO api_key_signatures (api_key_id, signature, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, keyID, strings.ToLower(signature), time.Unix(unix, 0).Add(config.APIKeySignatureWindow))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate request signature"})
+			c.Abort()
+			return false
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Request signature has already been used"})
+			c.Abort()
+			return false
+		}
+	}
+
+	if _, err := db.Exec(`UPDATE api_keys SET last_used_at = now(), last_used_ip = $2 WHERE id = $1`, keyID, c.ClientIP()); err != nil {
+		log.Printf("[AuthMiddleware] Failed to record API key usage: %v\n", err)
+	}
+
+	c.Set("user_id", serviceAccountID)
+	c.Set("role", "service")
+	c.Set("api_key_id", keyID)
+	c.Set("api_key_scopes", scopes)
+	return true
+}
+
+// RejectAPIKeys keeps service accounts away from routes that only make sense for people,
+// e.g. changing a password or enrolling 2FA
+func RejectAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available to API keys"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
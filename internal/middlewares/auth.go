@@ -1,17 +1,19 @@
 package middlewares
 
 import (
-	"fmt"
+	"database/sql"
+	"log"
 	"net/http"
 	"strings"
 
-	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware validates JWT and injects user_id and role into context
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates JWT, rejects revoked tokens and injects user_id, role and jti into context.
+// Service accounts may authenticate with "ApiKey <key>" instead, see authenticateAPIKey.
+func AuthMiddleware(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -20,8 +22,14 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		//Check format: "Bearer <token>"
+		//Check format: "Bearer <token>" or "ApiKey <key>"
 		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && parts[0] == "ApiKey" {
+			if authenticateAPIKey(db, c, parts[1]) {
+				c.Next()
+			}
+			return
+		}
 		if len(parts) != 2 || parts[0] != "Bearer" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
 			c.Abort()
@@ -29,25 +37,89 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenStr := parts[1]
-		//jwtKey := config.JwtSecret
 
 		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JwtSecret), nil
-		})
+		token, err := utils.ParseJWT(tokenStr, claims)
 
 		if err != nil || !token.Valid {
-			fmt.Printf("err: %s\n", err.Error())
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		//check the jti denylist so revocation takes effect before the token expires
+		//tokens issued for a specific purpose (e.g. the 2FA login step) are not access tokens
+		jti, _ := claims["jti"].(string)
+		if _, hasPurpose := claims["purpose"]; jti == "" || hasPurpose {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		var revoked bool
+		err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		exp, err := claims.GetExpirationTime()
+		if err != nil || exp == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		//keep the session's last-seen time fresh, at most one write per minute per session
+		sessionID, _ := claims["sid"].(string)
+		if sessionID != "" {
+			_, err := db.Exec(`
+				UPDATE sessions SET last_seen_at = now(), last_seen_ip = $2
+				WHERE id = $1 AND last_seen_at < now() - interval '1 minute'
+			`, sessionID, c.ClientIP())
+			if err != nil {
+				log.Printf("[AuthMiddleware] Failed to update session: %v\n", err)
+			}
+		}
+
 		//inject user info into context to be used in handlers
 		c.Set("user_id", claims["user_id"])
 		c.Set("role", claims["role"])
+		c.Set("jti", jti)
+		c.Set("session_id", sessionID)
+		c.Set("token_expires_at", exp.Time)
+		if restriction, ok := claims["restriction"].(string); ok {
+			c.Set("restriction", restriction)
+		}
 
 		c.Next()
 
 	}
 }
+
+var restrictionMessages = map[string]string{
+	utils.RestrictionPasswordChange: "Password change required before continuing",
+	utils.RestrictionMFAEnrollment:  "Two-factor authentication must be enabled before continuing",
+}
+
+// RequireFullAccess rejects restricted tokens, e.g. those issued to users who must change their password first
+func RequireFullAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if restriction := c.GetString("restriction"); restriction != "" {
+			msg, ok := restrictionMessages[restriction]
+			if !ok {
+				msg = "Token is restricted"
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": msg, "restriction": restriction})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
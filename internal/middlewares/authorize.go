@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Authorize rejects requests whose role is not granted perm with 403 and records the denial in audit_logs.
+// Requests authenticated with an API key are checked against the scopes of the key instead of the role.
+// It must run after AuthMiddleware.
+func Authorize(db *sql.DB, perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		scopes, isAPIKey := c.Get("api_key_scopes")
+		if isAPIKey {
+			if granted, _ := scopes.([]string); rbac.HasScope(granted, perm) {
+				c.Next()
+				return
+			}
+		} else if rbac.Can(role, perm) {
+			c.Next()
+			return
+		}
+
+		userID, _ := uuid.Parse(c.GetString("user_id"))
+		denial := map[string]string{
+			"role":       role,
+			"permission": string(perm),
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+		}
+		if isAPIKey {
+			denial["api_key_id"] = c.GetString("api_key_id")
+		}
+		changeData, err := json.Marshal(denial)
+		if err != nil {
+			changeData = []byte(`{}`)
+		}
+		utils.LogAudit(db, "DENY", "authorization", c.FullPath(), userID, net.ParseIP(c.ClientIP()), changeData)
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// Allowance is a fixed monthly amount paid to everyone on a level or to one employee
+type Allowance struct {
+	ID        string        `json:"id"`
+	Code      string        `json:"code"`
+	Label     string        `json:"label"`
+	Amount    money.Decimal `json:"amount"`
+	Taxable   bool          `json:"taxable"`
+	LevelID   *string       `json:"level_id"`
+	UserID    *string       `json:"user_id"`
+	StartDate string        `json:"start_date"`
+	EndDate   *string       `json:"end_date"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Bonus is a one-off amount paid with the payslip of a period
+type Bonus struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"user_id"`
+	PeriodID  string        `json:"period_id"`
+	Label     string        `json:"label"`
+	Amount    money.Decimal `json:"amount"`
+	Taxable   bool          `json:"taxable"`
+	CreatedAt time.Time     `json:"created_at"`
+}
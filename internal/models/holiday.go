@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Holiday is a public holiday, it is not a working day
+type Holiday struct {
+	Date      string    `json:"date"` //format YYYY-MM-DD
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+type EmployeeLevel struct {
+	ID                     string         `json:"id"`
+	Name                   string         `json:"name"`
+	CurrentSalary          *money.Decimal `json:"current_salary"`
+	CurrentSalaryEffective *string        `json:"current_salary_effective_from"`
+}
+
+type LevelSalary struct {
+	ID            string        `json:"id"`
+	LevelID       string        `json:"level_id"`
+	BaseSalary    money.Decimal `json:"base_salary"`
+	EffectiveFrom string        `json:"effective_from"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+const (
+	LoanActive  = "active"
+	LoanPaidOff = "paid_off"
+
+	LoanRepaymentInstallment = "installment"
+	LoanRepaymentPayoff      = "payoff"
+)
+
+type Loan struct {
+	ID                string        `json:"id"`
+	UserID            string        `json:"user_id"`
+	Description       string        `json:"description"`
+	Principal         money.Decimal `json:"principal"`
+	InstallmentAmount money.Decimal `json:"installment_amount"`
+	StartDate         string        `json:"start_date"`
+	Repaid            money.Decimal `json:"repaid"`
+	Balance           money.Decimal `json:"balance"`
+	NextInstallment   money.Decimal `json:"next_installment"`
+	Status            string        `json:"status"`
+	CreatedAt         time.Time     `json:"created_at"`
+}
+
+type LoanRepayment struct {
+	ID        string        `json:"id"`
+	Kind      string        `json:"kind"`
+	PeriodID  *string       `json:"period_id"`
+	Amount    money.Decimal `json:"amount"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type LoanSkip struct {
+	PeriodID  string    `json:"period_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoanDetailResponse struct {
+	Loan       Loan            `json:"loan"`
+	Repayments []LoanRepayment `json:"repayments"`
+	Skips      []LoanSkip      `json:"skips"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// Overtime is an overtime request, its Status is a review status. Only approved hours are paid.
+type Overtime struct {
+	ID            string        `json:"id"`
+	UserID        string        `json:"user_id"`
+	Username      string        `json:"username"`
+	Date          string        `json:"date"`
+	Hours         money.Decimal `json:"hours"`
+	Status        string        `json:"status"`
+	ReviewedBy    *string       `json:"reviewed_by"`
+	ReviewedAt    *time.Time    `json:"reviewed_at"`
+	ReviewComment *string       `json:"review_comment"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// Payroll run statuses
+const (
+	PayrollRunDraft     = "draft"
+	PayrollRunFinalized = "finalized"
+)
+
+type PayrollRun struct {
+	ID            string        `json:"id"`
+	PeriodID      string        `json:"period_id"`
+	Status        string        `json:"status"`
+	RunCount      int           `json:"run_count"`
+	Payslips      int           `json:"payslips"`
+	TotalTakeHome money.Decimal `json:"total_take_home"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	FinalizedAt   *time.Time    `json:"finalized_at"`
+	FinalizedBy   *string       `json:"finalized_by"`
+}
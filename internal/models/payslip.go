@@ -1,49 +1,89 @@
 package models
 
 import (
-	"database/sql"
 	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
 )
 
 type Payslip struct {
-	ID                  string          `json:"id"`
-	UserID              string          `json:"user_id"`
-	Username            string          `json:"username"`
-	AttendancePeriodID  string          `json:"attendance_period_id"`
-	BaseSalary          float64         `json:"base_salary"`
-	AttendanceAmount    float64         `json:"attendance_amount"`
-	AttendanceDays      int             `json:"attendance_days"`
-	OvertimeHours       sql.NullFloat64 `json:"overtime_hours"`
-	OvertimeAmount      sql.NullFloat64 `json:"overtime_amount"`
-	ReimbursementAmount sql.NullFloat64 `json:"reimbursement_amount"`
-	TotalTakeHome       float64         `json:"total_take_home"`
-	CreatedAt           time.Time       `json:"created_at"`
+	ID                    string        `json:"id"`
+	UserID                string        `json:"user_id"`
+	Username              string        `json:"username"`
+	AttendancePeriodID    string        `json:"attendance_period_id"`
+	BaseSalary            money.Decimal `json:"base_salary"`
+	AttendanceAmount      money.Decimal `json:"attendance_amount"`
+	AttendanceDays        int           `json:"attendance_days"`
+	OvertimeHours         money.Decimal `json:"overtime_hours"`
+	OvertimeAmount        money.Decimal `json:"overtime_amount"`
+	ReimbursementAmount   money.Decimal `json:"reimbursement_amount"`
+	TaxAmount             money.Decimal `json:"tax_amount"`
+	TaxStatus             *string       `json:"tax_status"`
+	EmployeeContributions money.Decimal `json:"employee_contributions"`
+	EmployerContributions money.Decimal `json:"employer_contributions"`
+	TotalEarnings         money.Decimal `json:"total_earnings"`
+	TotalDeductions       money.Decimal `json:"total_deductions"`
+	TotalTakeHome         money.Decimal `json:"total_take_home"`
+	CreatedAt             time.Time     `json:"created_at"`
 }
 
 type PayslipDetailResponse struct {
 	Payslip        Payslip             `json:"payslip"`
+	Items          []PayslipItem       `json:"items"`
 	Attendance     AttendanceBreakdown `json:"attendance"`
 	Overtime       OvertimeBreakdown   `json:"overtime"`
 	Reimbursements []Reimbursement     `json:"reimbursements"`
+	Deductions     []Deduction         `json:"deductions"`
+	Contributions  []Contribution      `json:"contributions"`
 }
 
 type AttendanceBreakdown struct {
-	WorkingDays      int     `json:"working_days"`
-	AttendanceDays   int     `json:"attendance_days"`
-	AttendanceAmount float64 `json:"attendance_amount"`
+	WorkingDays       int           `json:"working_days"`        // days the employee was employed
+	PeriodWorkingDays int           `json:"period_working_days"` // days of the whole period, the salary denominator
+	AttendanceDays    int           `json:"attendance_days"`
+	AttendanceAmount  money.Decimal `json:"attendance_amount"`
 }
 
 type OvertimeBreakdown struct {
-	OvertimeHours  float64 `json:"overtime_hours"`
-	HourlyRate     float64 `json:"hourly_rate"`
-	OvertimeRate   float64 `json:"overtime_rate"`
-	OvertimeAmount float64 `json:"overtime_amount"`
+	OvertimeHours  money.Decimal `json:"overtime_hours"` // of every kind of day
+	HourlyRate     money.Decimal `json:"hourly_rate"`
+	OvertimeRate   money.Decimal `json:"overtime_rate"` // weekday rate, the items hold the rest day and holiday rates
+	OvertimeAmount money.Decimal `json:"overtime_amount"`
 }
 
+// Reimbursement is an approved reimbursement paid with a payslip
 type Reimbursement struct {
-	ID          string    `json:"id"`
-	Date        string    `json:"date"`
-	Description string    `json:"description"`
-	Amount      float64   `json:"amount"`
-	SubmittedAt time.Time `json:"submitted_at"`
+	ID          string        `json:"id"`
+	Category    string        `json:"category"`
+	Date        string        `json:"date"`
+	Description string        `json:"description"`
+	Amount      money.Decimal `json:"amount"`
+	SubmittedAt time.Time     `json:"submitted_at"`
+}
+
+// PayslipItem is one earning or deduction line of a payslip
+type PayslipItem struct {
+	Code     string        `json:"code"`
+	Label    string        `json:"label"`
+	Kind     string        `json:"kind"`
+	Quantity money.Decimal `json:"quantity"`
+	Rate     money.Decimal `json:"rate"`
+	Amount   money.Decimal `json:"amount"`
+	Taxable  bool          `json:"taxable"`
+}
+
+// Deduction is an amount withheld from the take home pay
+type Deduction struct {
+	Code   string        `json:"code"`
+	Label  string        `json:"label"`
+	Amount money.Decimal `json:"amount"`
+}
+
+// Contribution is the social security paid on a payslip for one program
+type Contribution struct {
+	Code           string        `json:"code"`
+	Label          string        `json:"label"`
+	Base           money.Decimal `json:"base"`
+	EmployeeAmount money.Decimal `json:"employee_amount"`
+	EmployerAmount money.Decimal `json:"employer_amount"`
 }
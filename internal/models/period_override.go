@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type PeriodOverride struct {
+	ID        string     `json:"id"`
+	PeriodID  string     `json:"period_id"`
+	UserID    *string    `json:"user_id"` //nil when the override applies to every employee
+	Reason    string     `json:"reason"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy *string    `json:"created_by"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// ReimbursementCategory groups reimbursement claims, e.g. medical or travel, and sets their limits
+type ReimbursementCategory struct {
+	Code            string         `json:"code"`
+	Name            string         `json:"name"`
+	PerClaimLimit   *money.Decimal `json:"per_claim_limit"`  // no limit when nil
+	PerPeriodLimit  *money.Decimal `json:"per_period_limit"` // attendance period, no limit when nil
+	OverLimitAction string         `json:"over_limit_action"`
+	Active          bool           `json:"active"`
+}
+
+// ReimbursementClaim is a reimbursement request, its Status is a review status. Only approved claims are paid.
+// Amount is what is paid, ClaimedAmount what the employee asked for; they differ when the category capped the claim.
+type ReimbursementClaim struct {
+	ID            string        `json:"id"`
+	UserID        string        `json:"user_id"`
+	Username      string        `json:"username"`
+	Category      string        `json:"category"`
+	Date          string        `json:"date"`
+	Description   string        `json:"description"`
+	ClaimedAmount money.Decimal `json:"claimed_amount"`
+	Amount        money.Decimal `json:"amount"`
+	OverLimit     bool          `json:"over_limit"`
+	Receipts      int           `json:"receipts"` // number of receipt files attached
+	Status        string        `json:"status"`
+	ReviewedBy    *string       `json:"reviewed_by"`
+	ReviewedAt    *time.Time    `json:"reviewed_at"`
+	ReviewReason  *string       `json:"review_reason"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// ReimbursementReceipt is a receipt file attached to a reimbursement claim. The file is kept in receipt storage,
+// SHA256 is the hex checksum of its content.
+type ReimbursementReceipt struct {
+	ID              string    `json:"id"`
+	ReimbursementID string    `json:"reimbursement_id"`
+	FileName        string    `json:"file_name"`
+	ContentType     string    `json:"content_type"`
+	Size            int64     `json:"size"`
+	SHA256          string    `json:"sha256"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// Statuses of requests that need approval before they are paid: overtime and reimbursements
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// IsReviewStatus reports whether status is one of the review statuses
+func IsReviewStatus(status string) bool {
+	return status == ReviewPending || status == ReviewApproved || status == ReviewRejected
+}
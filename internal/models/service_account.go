@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type ServiceAccount struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKey struct {
+	ID               string     `json:"id"`
+	ServiceAccountID string     `json:"service_account_id"`
+	Name             string     `json:"name"`
+	KeyPrefix        string     `json:"key_prefix"`
+	Scopes           []string   `json:"scopes"`
+	RequireSignature bool       `json:"require_signature"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	LastUsedIP       *string    `json:"last_used_ip"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
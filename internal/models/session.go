@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	IPAddress     *string    `json:"ip_address"`
+	UserAgent     *string    `json:"user_agent"`
+	IssuedAt      time.Time  `json:"issued_at"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	LastSeenIP    *string    `json:"last_seen_ip"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason *string    `json:"revoked_reason,omitempty"`
+	Current       bool       `json:"current"`
+}
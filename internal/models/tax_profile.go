@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type TaxProfile struct {
+	UserID     string     `json:"user_id"`
+	Married    bool       `json:"married"`
+	Dependents int        `json:"dependents"`
+	Status     string     `json:"status"` //PPh 21 status, e.g. K/1
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
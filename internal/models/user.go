@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	Role         string    `json:"role"`
+	LevelID      *string   `json:"level_id"`
+	LevelName    *string   `json:"level_name"`
+	IsActive     bool      `json:"is_active"`
+	HiredOn      *string   `json:"hired_on"`      //format YYYY-MM-DD
+	TerminatedOn *string   `json:"terminated_on"` //format YYYY-MM-DD, last day of employment
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
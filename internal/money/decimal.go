@@ -0,0 +1,176 @@
+// Package money is a fixed-point decimal type for salaries, rates and quantities.
+// Values are exact up to Scale decimal places, so sums never drift the way float64 does.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places a Decimal keeps
+const Scale = 4
+
+const unit = 10000 // 10^Scale
+
+var ErrInvalidDecimal = errors.New("invalid decimal")
+
+// Decimal is a signed fixed-point number with Scale decimal places. The zero value is 0.
+type Decimal struct {
+	v int64 // value * 10^Scale
+}
+
+// Zero is the decimal 0
+var Zero = Decimal{}
+
+// New returns the decimal for n
+func New(n int64) Decimal {
+	return Decimal{v: n * unit}
+}
+
+// Parse reads a plain decimal such as "1500000", "-12.5" or "0.0001".
+// Digits beyond Scale are rounded half to even.
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") {
+		return Zero, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	return fromRat(r, HalfEven)
+}
+
+// MustParse is Parse for constants, it panics on invalid input
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// FromFloat converts f using its shortest decimal representation
+func FromFloat(f float64) Decimal {
+	d, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Zero
+	}
+	return d
+}
+
+func fromRat(r *big.Rat, mode Mode) (Decimal, error) {
+	n := new(big.Int).Mul(r.Num(), big.NewInt(unit))
+	q := roundQuo(n, r.Denom(), mode)
+	if !q.IsInt64() {
+		return Zero, fmt.Errorf("%w: %s is out of range", ErrInvalidDecimal, r.FloatString(Scale))
+	}
+	return Decimal{v: q.Int64()}, nil
+}
+
+func (d Decimal) Add(e Decimal) Decimal { return Decimal{v: d.v + e.v} }
+func (d Decimal) Sub(e Decimal) Decimal { return Decimal{v: d.v - e.v} }
+func (d Decimal) Neg() Decimal          { return Decimal{v: -d.v} }
+
+// Mul returns d * e, rounded half to even at Scale
+func (d Decimal) Mul(e Decimal) Decimal {
+	return d.MulDiv(e, New(1), HalfEven)
+}
+
+// MulDiv returns d * num / den computed exactly and rounded once with mode at Scale.
+// It panics when den is zero, like integer division.
+func (d Decimal) MulDiv(num, den Decimal, mode Mode) Decimal {
+	if den.v == 0 {
+		panic("money: division by zero")
+	}
+	n := new(big.Int).Mul(big.NewInt(d.v), big.NewInt(num.v))
+	return Decimal{v: roundQuo(n, big.NewInt(den.v), mode).Int64()}
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than e
+func (d Decimal) Cmp(e Decimal) int {
+	switch {
+	case d.v < e.v:
+		return -1
+	case d.v > e.v:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) Equal(e Decimal) bool { return d.v == e.v }
+func (d Decimal) IsZero() bool         { return d.v == 0 }
+func (d Decimal) IsNegative() bool     { return d.v < 0 }
+func (d Decimal) IsPositive() bool     { return d.v > 0 }
+
+// String formats d without trailing zeros, e.g. "4550", "12.5" or "-0.0001"
+func (d Decimal) String() string {
+	v := d.v
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	s := fmt.Sprintf("%s%d.%0*d", sign, v/unit, Scale, v%unit)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Float64 is for display and tests only, never compute with it
+func (d Decimal) Float64() float64 {
+	return float64(d.v) / unit
+}
+
+// Sum adds up values
+func Sum(values ...Decimal) Decimal {
+	var total Decimal
+	for _, v := range values {
+		total = total.Add(v)
+	}
+	return total
+}
+
+// MarshalJSON writes d as a JSON number
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one, without going through float64
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := Parse(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan reads NUMERIC columns, which lib/pq returns as text
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*d = Zero
+	case []byte:
+		*d, err = Parse(string(v))
+	case string:
+		*d, err = Parse(v)
+	case int64:
+		*d = New(v)
+	case float64:
+		*d = FromFloat(v)
+	default:
+		err = fmt.Errorf("money: cannot scan %T into Decimal", src)
+	}
+	return err
+}
+
+// Value stores d as text so NUMERIC columns receive the exact value
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,117 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Mode decides which way a value between two multiples of the minor unit goes
+type Mode string
+
+const (
+	HalfUp   Mode = "half_up"   // ties away from zero
+	HalfEven Mode = "half_even" // ties to the even multiple, banker's rounding
+	Down     Mode = "down"      // towards zero
+	Up       Mode = "up"        // away from zero
+)
+
+// ParseMode validates a rounding mode name
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case HalfUp, HalfEven, Down, Up:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown rounding mode %q", s)
+}
+
+// Rounding is how payable amounts are rounded: to a multiple of MinorUnit using Mode,
+// e.g. 0.01 for cents or 100 to pay whole hundreds of rupiah.
+// The zero value rounds half up to 0.01.
+type Rounding struct {
+	Mode      Mode
+	MinorUnit Decimal
+}
+
+// DefaultRounding is used when nothing is configured
+var DefaultRounding = Rounding{Mode: HalfUp, MinorUnit: MustParse("0.01")}
+
+// NewRounding validates a mode name and a positive minor unit
+func NewRounding(mode, minorUnit string) (Rounding, error) {
+	m, err := ParseMode(mode)
+	if err != nil {
+		return Rounding{}, err
+	}
+	u, err := Parse(minorUnit)
+	if err != nil {
+		return Rounding{}, err
+	}
+	if !u.IsPositive() {
+		return Rounding{}, fmt.Errorf("minor unit must be positive, got %s", u)
+	}
+	return Rounding{Mode: m, MinorUnit: u}, nil
+}
+
+func (r Rounding) withDefaults() Rounding {
+	if r.Mode == "" {
+		r.Mode = DefaultRounding.Mode
+	}
+	if !r.MinorUnit.IsPositive() {
+		r.MinorUnit = DefaultRounding.MinorUnit
+	}
+	return r
+}
+
+// Round rounds d to a multiple of the minor unit
+func (r Rounding) Round(d Decimal) Decimal {
+	return r.MulDiv(d, New(1), New(1))
+}
+
+// MulDiv returns d * num / den rounded once to the minor unit, with no intermediate rounding
+func (r Rounding) MulDiv(d, num, den Decimal) Decimal {
+	if den.v == 0 {
+		panic("money: division by zero")
+	}
+	r = r.withDefaults()
+	n := new(big.Int).Mul(big.NewInt(d.v), big.NewInt(num.v))
+	m := new(big.Int).Mul(big.NewInt(den.v), big.NewInt(r.MinorUnit.v))
+	// n/m counts minor units once both sides are divided by unit
+	q := roundQuo(n, m, r.Mode)
+	return Decimal{v: q.Int64() * r.MinorUnit.v}
+}
+
+// roundQuo returns n / d rounded to an integer with mode
+func roundQuo(n, d *big.Int, mode Mode) *big.Int {
+	if d.Sign() < 0 {
+		n, d = new(big.Int).Neg(n), new(big.Int).Neg(d)
+	}
+	q, rem := new(big.Int).QuoRem(n, d, new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+
+	away := false
+	switch mode {
+	case Up:
+		away = true
+	case Down:
+		away = false
+	default:
+		// compare twice the remainder with the divisor to find ties
+		twice := new(big.Int).Abs(rem)
+		twice.Lsh(twice, 1)
+		switch twice.Cmp(d) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == HalfUp || q.Bit(0) == 1
+		}
+	}
+	if away {
+		if n.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
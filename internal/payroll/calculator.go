@@ -0,0 +1,409 @@
+// Package payroll holds the payroll math. It has no database access so every rule can be unit tested
+// and the payroll run and the payslip view compute the same numbers.
+package payroll
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+var (
+	// DefaultHoursPerDay is the length of a working day used to derive the hourly rate
+	DefaultHoursPerDay = money.New(8)
+	// DefaultOvertimeMultiplier is applied to the hourly rate for overtime hours by the default overtime policy
+	DefaultOvertimeMultiplier = money.New(2)
+)
+
+// Kind tells whether an item adds to or subtracts from the take home pay
+type Kind string
+
+const (
+	KindEarning   Kind = "earning"
+	KindDeduction Kind = "deduction"
+)
+
+// Item codes produced by the calculator
+const (
+	CodeAttendance      = "ATTENDANCE"
+	CodeOvertime        = "OVERTIME"
+	CodeOvertimeRestDay = "OVERTIME_REST_DAY"
+	CodeOvertimeHoliday = "OVERTIME_HOLIDAY"
+	CodeReimbursement   = "REIMBURSEMENT"
+	CodeBonus           = "BONUS"
+	CodeLoan            = "LOAN"
+
+	// CodeAllowancePrefix starts the item code of an allowance, e.g. ALLOWANCE_MEAL
+	CodeAllowancePrefix = "ALLOWANCE_"
+)
+
+// Input is everything the calculator needs to know about one employee for one period
+type Input struct {
+	BaseSalary        money.Decimal // monthly salary of the employee's level
+	WorkingDays       int           // working days of the period the employee was employed
+	PeriodWorkingDays int           // working days of the whole period when the employee joined or left during it, zero otherwise
+	AttendanceDays    int
+	OvertimeHours     money.Decimal     // overtime on weekdays
+	RestDayOvertime   money.Decimal     // overtime on weekends
+	HolidayOvertime   money.Decimal     // overtime on public holidays
+	Overtime          *OvertimePolicy   // policy of the employee's level, the calculator's when nil
+	Reimbursements    money.Decimal     // total of the reimbursements paid with this payslip
+	Allowances        []Earning         // recurring allowances in force during the period
+	Bonuses           []Earning         // one-off bonuses paid with this payslip
+	Loans             []LoanInstallment // installments due, deducted after tax
+	TaxProfile        TaxProfile
+}
+
+// LoanInstallment is the repayment of a loan deducted from a payslip
+type LoanInstallment struct {
+	LoanID string
+	Label  string
+	Amount money.Decimal
+}
+
+// Earning is a fixed amount paid on top of the salary. Its Code is the allowance code, it is
+// not used for bonuses.
+type Earning struct {
+	Code    string
+	Label   string
+	Amount  money.Decimal
+	Taxable bool
+}
+
+// Item is one line of a payslip. Amount is rounded to the minor unit, Rate is informational.
+// Taxable earnings make up the income tax base.
+type Item struct {
+	Code     string        `json:"code"`
+	Label    string        `json:"label"`
+	Kind     Kind          `json:"kind"`
+	Quantity money.Decimal `json:"quantity"`
+	Rate     money.Decimal `json:"rate"`
+	Amount   money.Decimal `json:"amount"`
+	Taxable  bool          `json:"taxable"`
+}
+
+// Result is the itemized outcome of a calculation. Amounts are rounded to the minor unit
+// and TotalTakeHome is always the signed sum of the item amounts.
+type Result struct {
+	HourlyRate          money.Decimal
+	OvertimeRate        money.Decimal // weekday overtime rate
+	AttendanceAmount    money.Decimal
+	OvertimeAmount      money.Decimal // overtime of every kind of day
+	ReimbursementAmount money.Decimal
+	AllowanceAmount     money.Decimal
+	BonusAmount         money.Decimal
+	TaxAmount           money.Decimal
+	Tax                 *TaxBreakdown // nil when the calculator withholds no tax
+	LoanAmount          money.Decimal
+	Loans               []LoanInstallment // installments actually deducted, never more than the pay left
+
+	Contributions         []ContributionAmount
+	EmployeeContributions money.Decimal // withheld from the pay
+	EmployerContributions money.Decimal // paid by the company on top of the pay
+	TotalEarnings         money.Decimal
+	TotalDeductions       money.Decimal
+	TotalTakeHome         money.Decimal
+	Items                 []Item
+}
+
+// Calculator computes payslips. The zero value is not usable, start from NewCalculator.
+type Calculator struct {
+	HoursPerDay   money.Decimal
+	Overtime      OvertimePolicy // company overtime policy
+	Rounding      money.Rounding
+	Tax           *TaxRules // income tax withholding, none when nil
+	Contributions []Contribution
+}
+
+// NewCalculator returns a calculator with the company defaults
+func NewCalculator() Calculator {
+	return Calculator{
+		HoursPerDay: DefaultHoursPerDay,
+		Overtime:    DefaultOvertimePolicy(),
+		Rounding:    money.DefaultRounding,
+	}
+}
+
+var (
+	ErrNoWorkingDays = errors.New("period has no working days")
+	ErrInvalidInput  = errors.New("invalid payroll input")
+	ErrUnbalanced    = errors.New("payslip total does not equal the sum of its items")
+)
+
+// Rates returns the hourly and weekday overtime rates of the company policy for a salary spread over workingDays.
+// They are kept at full precision; amounts are derived from the salary directly and rounded once.
+func (c Calculator) Rates(baseSalary money.Decimal, workingDays int) (hourly, overtime money.Decimal, err error) {
+	if workingDays <= 0 {
+		return money.Zero, money.Zero, ErrNoWorkingDays
+	}
+	hours := money.New(int64(workingDays)).Mul(c.HoursPerDay)
+	hourly = baseSalary.MulDiv(money.New(1), hours, money.HalfEven)
+	overtime = baseSalary.MulDiv(c.Overtime.WeekdayMultiplier, hours, money.HalfEven)
+	return hourly, overtime, nil
+}
+
+// Calculate prorates the salary by attendance, pays overtime at the rate of its kind of day, adds reimbursements,
+// allowances and bonuses, withholds the employee share of social security contributions, withholds
+// income tax when the calculator has tax rules and deducts loan installments.
+// Attendance is prorated over the working days of the whole period, so an employee who joined or left
+// during it earns the share of the monthly salary for the days they attended while employed.
+func (c Calculator) Calculate(in Input) (Result, error) {
+	if in.BaseSalary.IsNegative() || in.AttendanceDays < 0 || in.OvertimeHours.IsNegative() || in.RestDayOvertime.IsNegative() ||
+		in.HolidayOvertime.IsNegative() || in.Reimbursements.IsNegative() {
+		return Result{}, fmt.Errorf("%w: amounts must not be negative", ErrInvalidInput)
+	}
+	for _, e := range append(append([]Earning{}, in.Allowances...), in.Bonuses...) {
+		if e.Amount.IsNegative() {
+			return Result{}, fmt.Errorf("%w: %s must not be negative", ErrInvalidInput, e.Label)
+		}
+	}
+	for _, loan := range in.Loans {
+		if loan.Amount.IsNegative() {
+			return Result{}, fmt.Errorf("%w: installment of %s must not be negative", ErrInvalidInput, loan.Label)
+		}
+	}
+	//the salary of the days employed spread over those days is the monthly salary spread over the
+	//whole period, so the daily and hourly rates don't depend on the hire or termination date
+	periodDays := in.WorkingDays
+	if in.PeriodWorkingDays != 0 {
+		if in.WorkingDays < 0 || in.WorkingDays > in.PeriodWorkingDays {
+			return Result{}, fmt.Errorf("%w: %d working days employed is outside the %d working days of the period",
+				ErrInvalidInput, in.WorkingDays, in.PeriodWorkingDays)
+		}
+		periodDays = in.PeriodWorkingDays
+	}
+	hourly, _, err := c.Rates(in.BaseSalary, periodDays)
+	if err != nil {
+		return Result{}, err
+	}
+	//attendance can't exceed the working days the employee was employed
+	if in.AttendanceDays > in.WorkingDays {
+		return Result{}, fmt.Errorf("%w: %d attendance days exceed the %d working days", ErrInvalidInput, in.AttendanceDays, in.WorkingDays)
+	}
+	policy := c.Overtime
+	if in.Overtime != nil {
+		policy = *in.Overtime
+	}
+
+	days := money.New(int64(periodDays))
+	attendanceDays := money.New(int64(in.AttendanceDays))
+	hours := days.Mul(c.HoursPerDay)
+	res := Result{
+		HourlyRate:          hourly,
+		OvertimeRate:        in.BaseSalary.MulDiv(policy.Multiplier(DayWeekday), hours, money.HalfEven),
+		AttendanceAmount:    c.Rounding.MulDiv(in.BaseSalary, attendanceDays, days),
+		ReimbursementAmount: c.Rounding.Round(in.Reimbursements),
+	}
+
+	res.Items = []Item{{
+		Code:     CodeAttendance,
+		Label:    "Salary for days attended",
+		Kind:     KindEarning,
+		Quantity: attendanceDays,
+		Rate:     in.BaseSalary.MulDiv(money.New(1), days, money.HalfEven),
+		Amount:   res.AttendanceAmount,
+		Taxable:  true,
+	}}
+	for _, overtime := range []struct {
+		code, label string
+		kind        DayKind
+		hours       money.Decimal
+	}{
+		{CodeOvertime, "Overtime", DayWeekday, in.OvertimeHours},
+		{CodeOvertimeRestDay, "Rest day overtime", DayRestDay, in.RestDayOvertime},
+		{CodeOvertimeHoliday, "Holiday overtime", DayHoliday, in.HolidayOvertime},
+	} {
+		if !overtime.hours.IsPositive() {
+			continue
+		}
+		multiplier := policy.Multiplier(overtime.kind)
+		amount := c.Rounding.MulDiv(in.BaseSalary, overtime.hours.Mul(multiplier), hours)
+		res.OvertimeAmount = res.OvertimeAmount.Add(amount)
+		res.Items = append(res.Items, Item{
+			Code:     overtime.code,
+			Label:    overtime.label,
+			Kind:     KindEarning,
+			Quantity: overtime.hours,
+			Rate:     in.BaseSalary.MulDiv(multiplier, hours, money.HalfEven),
+			Amount:   amount,
+			Taxable:  true,
+		})
+	}
+	if in.Reimbursements.IsPositive() {
+		res.Items = append(res.Items, Item{
+			Code:     CodeReimbursement,
+			Label:    "Reimbursements",
+			Kind:     KindEarning,
+			Quantity: money.New(1),
+			Rate:     res.ReimbursementAmount,
+			Amount:   res.ReimbursementAmount,
+		})
+	}
+
+	for _, allowance := range in.Allowances {
+		amount := c.Rounding.Round(allowance.Amount)
+		res.AllowanceAmount = res.AllowanceAmount.Add(amount)
+		res.Items = append(res.Items, Item{
+			Code:     CodeAllowancePrefix + allowance.Code,
+			Label:    allowance.Label,
+			Kind:     KindEarning,
+			Quantity: money.New(1),
+			Rate:     amount,
+			Amount:   amount,
+			Taxable:  allowance.Taxable,
+		})
+	}
+	for _, bonus := range in.Bonuses {
+		amount := c.Rounding.Round(bonus.Amount)
+		res.BonusAmount = res.BonusAmount.Add(amount)
+		res.Items = append(res.Items, Item{
+			Code:     CodeBonus,
+			Label:    bonus.Label,
+			Kind:     KindEarning,
+			Quantity: money.New(1),
+			Rate:     amount,
+			Amount:   amount,
+			Taxable:  bonus.Taxable,
+		})
+	}
+
+	//reimbursements pay back expenses, they are not income; bonuses are taxed once, not annualized
+	taxableGross := TaxableEarnings(res.Items)
+	irregular := IrregularEarnings(res.Items)
+
+	//social security is contributed on the salary earned for the days attended, so a prorated
+	//salary is never outweighed by contributions charged on the full month
+	deductible := money.Zero
+	for _, program := range c.Contributions {
+		amount := program.Amount(res.AttendanceAmount, c.Rounding)
+		res.Contributions = append(res.Contributions, amount)
+		res.EmployeeContributions = res.EmployeeContributions.Add(amount.EmployeeAmount)
+		res.EmployerContributions = res.EmployerContributions.Add(amount.EmployerAmount)
+		if program.EmployerShareTaxable {
+			taxableGross = taxableGross.Add(amount.EmployerAmount)
+		}
+		if program.EmployeeShareDeductible {
+			deductible = deductible.Add(amount.EmployeeAmount)
+		}
+		if amount.EmployeeAmount.IsPositive() {
+			res.Items = append(res.Items, Item{
+				Code:     program.Code,
+				Label:    program.Label,
+				Kind:     KindDeduction,
+				Quantity: amount.Base,
+				Rate:     program.EmployeeRate,
+				Amount:   amount.EmployeeAmount,
+			})
+		}
+	}
+
+	if c.Tax != nil {
+		tax := c.Tax.Withholding(taxableGross.Sub(irregular), irregular, deductible, in.TaxProfile, c.Rounding)
+		res.Tax = &tax
+		res.TaxAmount = tax.PeriodTax
+		if res.TaxAmount.IsPositive() {
+			res.Items = append(res.Items, Item{
+				Code:     CodeIncomeTax,
+				Label:    "Income tax (PPh 21)",
+				Kind:     KindDeduction,
+				Quantity: money.New(1),
+				Rate:     res.TaxAmount,
+				Amount:   res.TaxAmount,
+			})
+		}
+	}
+
+	//loans are repaid from what is left after tax, an installment that doesn't fit is cut short
+	left := Total(res.Items)
+	for _, loan := range in.Loans {
+		amount := c.Rounding.Round(loan.Amount)
+		if amount.Cmp(left) > 0 {
+			amount = left
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+		left = left.Sub(amount)
+		res.LoanAmount = res.LoanAmount.Add(amount)
+		res.Loans = append(res.Loans, LoanInstallment{LoanID: loan.LoanID, Label: loan.Label, Amount: amount})
+		res.Items = append(res.Items, Item{
+			Code:     CodeLoan,
+			Label:    loan.Label,
+			Kind:     KindDeduction,
+			Quantity: money.New(1),
+			Rate:     amount,
+			Amount:   amount,
+		})
+	}
+
+	res.TotalEarnings, res.TotalDeductions = Totals(res.Items)
+	res.TotalTakeHome = res.TotalEarnings.Sub(res.TotalDeductions)
+	if err := CheckBalanced(res); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// Totals adds up the earnings and the deductions of items
+func Totals(items []Item) (earnings, deductions money.Decimal) {
+	for _, item := range items {
+		if item.Kind == KindDeduction {
+			deductions = deductions.Add(item.Amount)
+		} else {
+			earnings = earnings.Add(item.Amount)
+		}
+	}
+	return earnings, deductions
+}
+
+// Total is the take home pay of items: earnings minus deductions
+func Total(items []Item) money.Decimal {
+	earnings, deductions := Totals(items)
+	return earnings.Sub(deductions)
+}
+
+// TaxableEarnings is the part of the earnings that is income for the income tax
+func TaxableEarnings(items []Item) money.Decimal {
+	total := money.Zero
+	for _, item := range items {
+		if item.Kind == KindEarning && item.Taxable {
+			total = total.Add(item.Amount)
+		}
+	}
+	return total
+}
+
+// IrregularEarnings is the part of the taxable earnings paid once rather than every period, i.e. bonuses
+func IrregularEarnings(items []Item) money.Decimal {
+	total := money.Zero
+	for _, item := range items {
+		if item.Kind == KindEarning && item.Taxable && item.Code == CodeBonus {
+			total = total.Add(item.Amount)
+		}
+	}
+	return total
+}
+
+// SumByCode adds up the amounts of the items with a code
+func SumByCode(items []Item, code string) money.Decimal {
+	total := money.Zero
+	for _, item := range items {
+		if item.Code == code {
+			total = total.Add(item.Amount)
+		}
+	}
+	return total
+}
+
+// CheckBalanced verifies that the totals and the per-component amounts agree with the items
+func CheckBalanced(res Result) error {
+	earnings, deductions := Totals(res.Items)
+	components := money.Sum(res.AttendanceAmount, res.OvertimeAmount, res.ReimbursementAmount, res.AllowanceAmount, res.BonusAmount).
+		Sub(res.TaxAmount).Sub(res.EmployeeContributions).Sub(res.LoanAmount)
+	if !res.TotalEarnings.Equal(earnings) || !res.TotalDeductions.Equal(deductions) ||
+		!res.TotalTakeHome.Equal(earnings.Sub(deductions)) || !res.TotalTakeHome.Equal(components) {
+		return ErrUnbalanced
+	}
+	return nil
+}
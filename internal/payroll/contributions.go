@@ -0,0 +1,117 @@
+package payroll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// Contribution is a social security program funded by a share of the salary from the employee
+// and/or the employer, modelled on BPJS Kesehatan and BPJS Ketenagakerjaan
+type Contribution struct {
+	Code         string         `json:"code"`
+	Label        string         `json:"label"`
+	EmployeeRate money.Decimal  `json:"employee_rate"`
+	EmployerRate money.Decimal  `json:"employer_rate"`
+	SalaryCap    *money.Decimal `json:"salary_cap"` // salary above this is not contributed on, no cap when nil
+
+	// EmployerShareTaxable adds the employer share to the income tax base (JKK, JKM, health insurance)
+	EmployerShareTaxable bool `json:"employer_share_taxable"`
+	// EmployeeShareDeductible subtracts the employee share from the income tax base (JHT, JP)
+	EmployeeShareDeductible bool `json:"employee_share_deductible"`
+}
+
+// ContributionAmount is what one program costs for one payslip
+type ContributionAmount struct {
+	Code           string        `json:"code"`
+	Label          string        `json:"label"`
+	Base           money.Decimal `json:"base"`
+	EmployeeAmount money.Decimal `json:"employee_amount"`
+	EmployerAmount money.Decimal `json:"employer_amount"`
+}
+
+// DefaultContributions are the BPJS programs with the rates and caps in force in 2024
+func DefaultContributions() []Contribution {
+	limit := func(s string) *money.Decimal {
+		d := money.MustParse(s)
+		return &d
+	}
+	return []Contribution{
+		{
+			Code: "BPJS_KES", Label: "Health insurance (BPJS Kesehatan)",
+			EmployeeRate: money.MustParse("0.01"), EmployerRate: money.MustParse("0.04"),
+			SalaryCap: limit("12000000"), EmployerShareTaxable: true,
+		},
+		{
+			Code: "BPJS_JHT", Label: "Old age savings (JHT)",
+			EmployeeRate: money.MustParse("0.02"), EmployerRate: money.MustParse("0.037"),
+			EmployeeShareDeductible: true,
+		},
+		{
+			Code: "BPJS_JP", Label: "Pension (JP)",
+			EmployeeRate: money.MustParse("0.01"), EmployerRate: money.MustParse("0.02"),
+			SalaryCap: limit("10042300"), EmployeeShareDeductible: true,
+		},
+		{
+			Code: "BPJS_JKK", Label: "Work accident insurance (JKK)",
+			EmployerRate: money.MustParse("0.0024"), EmployerShareTaxable: true,
+		},
+		{
+			Code: "BPJS_JKM", Label: "Life insurance (JKM)",
+			EmployerRate: money.MustParse("0.003"), EmployerShareTaxable: true,
+		},
+	}
+}
+
+var ErrInvalidContributions = errors.New("invalid contributions")
+
+// ValidateContributions checks codes are unique and rates and caps make sense
+func ValidateContributions(contributions []Contribution) error {
+	seen := map[string]bool{}
+	for _, c := range contributions {
+		if c.Code == "" || seen[c.Code] {
+			return fmt.Errorf("%w: codes must be set and unique, got %q", ErrInvalidContributions, c.Code)
+		}
+		seen[c.Code] = true
+		for _, rate := range []money.Decimal{c.EmployeeRate, c.EmployerRate} {
+			if rate.IsNegative() || rate.Cmp(money.New(1)) > 0 {
+				return fmt.Errorf("%w: %s rates must be between 0 and 1", ErrInvalidContributions, c.Code)
+			}
+		}
+		if c.SalaryCap != nil && !c.SalaryCap.IsPositive() {
+			return fmt.Errorf("%w: %s salary_cap must be positive", ErrInvalidContributions, c.Code)
+		}
+	}
+	return nil
+}
+
+// LoadContributions reads a JSON array of contributions from a file
+func LoadContributions(path string) ([]Contribution, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var contributions []Contribution
+	if err := json.Unmarshal(data, &contributions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidContributions, err)
+	}
+	return contributions, ValidateContributions(contributions)
+}
+
+// Amount applies the program to the salary of a payslip
+func (c Contribution) Amount(salary money.Decimal, rounding money.Rounding) ContributionAmount {
+	base := salary
+	if c.SalaryCap != nil && base.Cmp(*c.SalaryCap) > 0 {
+		base = *c.SalaryCap
+	}
+	return ContributionAmount{
+		Code:           c.Code,
+		Label:          c.Label,
+		Base:           base,
+		EmployeeAmount: rounding.MulDiv(base, c.EmployeeRate, money.New(1)),
+		EmployerAmount: rounding.MulDiv(base, c.EmployerRate, money.New(1)),
+	}
+}
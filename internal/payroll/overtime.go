@@ -0,0 +1,122 @@
+package payroll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// DayKind tells which overtime multiplier applies to a day
+type DayKind string
+
+const (
+	DayWeekday DayKind = "weekday"
+	DayRestDay DayKind = "rest_day" // a weekend day
+	DayHoliday DayKind = "holiday"  // a public holiday, also when it falls on a weekend
+)
+
+// maxOvertimePerDay is the most overtime a single day can hold whatever the policy
+var maxOvertimePerDay = money.New(24)
+
+// OvertimePolicy limits how much overtime can be recorded and sets how it is paid.
+// A zero cap or increment means no limit.
+type OvertimePolicy struct {
+	DailyCap          money.Decimal `json:"daily_cap"`
+	WeeklyCap         money.Decimal `json:"weekly_cap"`  // Monday to Sunday
+	MonthlyCap        money.Decimal `json:"monthly_cap"` // calendar month
+	WeekdayMultiplier money.Decimal `json:"weekday_multiplier"`
+	RestDayMultiplier money.Decimal `json:"rest_day_multiplier"`
+	HolidayMultiplier money.Decimal `json:"holiday_multiplier"`
+	Increment         money.Decimal `json:"increment"` // hours must be a multiple of it, e.g. 0.5
+}
+
+// DefaultOvertimePolicy is the company policy: at most 3 hours a day paid at 2x the hourly rate
+func DefaultOvertimePolicy() OvertimePolicy {
+	return OvertimePolicy{
+		DailyCap:          money.New(3),
+		WeekdayMultiplier: DefaultOvertimeMultiplier,
+		RestDayMultiplier: DefaultOvertimeMultiplier,
+		HolidayMultiplier: DefaultOvertimeMultiplier,
+	}
+}
+
+var (
+	ErrInvalidOvertimePolicy = errors.New("invalid overtime policy")
+	ErrOvertimeLimit         = errors.New("overtime outside the policy")
+)
+
+// Validate checks that the multipliers are positive and the caps consistent
+func (p OvertimePolicy) Validate() error {
+	for _, m := range []money.Decimal{p.WeekdayMultiplier, p.RestDayMultiplier, p.HolidayMultiplier} {
+		if !m.IsPositive() {
+			return fmt.Errorf("%w: multipliers must be greater than 0", ErrInvalidOvertimePolicy)
+		}
+	}
+	for _, d := range []money.Decimal{p.DailyCap, p.WeeklyCap, p.MonthlyCap, p.Increment} {
+		if d.IsNegative() {
+			return fmt.Errorf("%w: caps and increment must not be negative", ErrInvalidOvertimePolicy)
+		}
+	}
+	if p.DailyCap.Cmp(maxOvertimePerDay) > 0 || p.Increment.Cmp(maxOvertimePerDay) > 0 {
+		return fmt.Errorf("%w: daily_cap and increment must be at most %s hours", ErrInvalidOvertimePolicy, maxOvertimePerDay)
+	}
+	//a smaller cap inside a larger one would make the larger one meaningless
+	caps := []money.Decimal{p.DailyCap, p.WeeklyCap, p.MonthlyCap}
+	for i := range caps {
+		for _, wider := range caps[i+1:] {
+			if !caps[i].IsZero() && !wider.IsZero() && wider.Cmp(caps[i]) < 0 {
+				return fmt.Errorf("%w: caps over longer spans must not be lower than shorter ones", ErrInvalidOvertimePolicy)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadOvertimePolicy reads a policy from a JSON file with the fields of OvertimePolicy
+func LoadOvertimePolicy(path string) (OvertimePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return OvertimePolicy{}, err
+	}
+	var p OvertimePolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return OvertimePolicy{}, fmt.Errorf("%w: %v", ErrInvalidOvertimePolicy, err)
+	}
+	return p, p.Validate()
+}
+
+// Multiplier returns the multiplier of the hourly rate for overtime on a kind of day
+func (p OvertimePolicy) Multiplier(kind DayKind) money.Decimal {
+	switch kind {
+	case DayRestDay:
+		return p.RestDayMultiplier
+	case DayHoliday:
+		return p.HolidayMultiplier
+	default:
+		return p.WeekdayMultiplier
+	}
+}
+
+// CheckHours verifies that hours of overtime on one day fit the policy. weekOther and monthOther are the hours
+// already recorded on the other days of the same week and month.
+func (p OvertimePolicy) CheckHours(hours, weekOther, monthOther money.Decimal) error {
+	if !hours.IsPositive() || hours.Cmp(maxOvertimePerDay) > 0 {
+		return fmt.Errorf("%w: hours must be greater than 0 and at most %s", ErrOvertimeLimit, maxOvertimePerDay)
+	}
+	if p.Increment.IsPositive() && !(money.Rounding{Mode: money.Down, MinorUnit: p.Increment}).Round(hours).Equal(hours) {
+		return fmt.Errorf("%w: hours must be recorded in steps of %s", ErrOvertimeLimit, p.Increment)
+	}
+	if p.DailyCap.IsPositive() && hours.Cmp(p.DailyCap) > 0 {
+		return fmt.Errorf("%w: at most %s hours a day", ErrOvertimeLimit, p.DailyCap)
+	}
+	if p.WeeklyCap.IsPositive() && hours.Add(weekOther).Cmp(p.WeeklyCap) > 0 {
+		return fmt.Errorf("%w: at most %s hours a week, %s already recorded", ErrOvertimeLimit, p.WeeklyCap, weekOther)
+	}
+	if p.MonthlyCap.IsPositive() && hours.Add(monthOther).Cmp(p.MonthlyCap) > 0 {
+		return fmt.Errorf("%w: at most %s hours a month, %s already recorded", ErrOvertimeLimit, p.MonthlyCap, monthOther)
+	}
+	return nil
+}
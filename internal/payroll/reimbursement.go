@@ -0,0 +1,72 @@
+package payroll
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// What happens to a reimbursement claim above the limits of its category
+const (
+	OverLimitFlag = "flag" // the claim keeps its amount and is marked for the approver
+	OverLimitCap  = "cap"  // the claim is reduced to what the limits leave
+)
+
+// ReimbursementLimits are the limits of a reimbursement category, nil means no limit
+type ReimbursementLimits struct {
+	PerClaim  *money.Decimal
+	PerPeriod *money.Decimal // attendance period, calendar month outside any period
+	OverLimit string         // OverLimitFlag or OverLimitCap
+}
+
+var (
+	ErrInvalidReimbursementLimits = errors.New("invalid reimbursement limits")
+	ErrReimbursementLimit         = errors.New("reimbursement limit reached")
+)
+
+// Validate checks that the limits are positive and the over-limit action known
+func (l ReimbursementLimits) Validate() error {
+	if l.OverLimit != OverLimitFlag && l.OverLimit != OverLimitCap {
+		return fmt.Errorf("%w: over_limit_action must be %s or %s", ErrInvalidReimbursementLimits, OverLimitFlag, OverLimitCap)
+	}
+	for _, limit := range []*money.Decimal{l.PerClaim, l.PerPeriod} {
+		if limit != nil && !limit.IsPositive() {
+			return fmt.Errorf("%w: limits must be greater than 0", ErrInvalidReimbursementLimits)
+		}
+	}
+	if l.PerClaim != nil && l.PerPeriod != nil && l.PerPeriod.Cmp(*l.PerClaim) < 0 {
+		return fmt.Errorf("%w: per_period_limit must not be lower than per_claim_limit", ErrInvalidReimbursementLimits)
+	}
+	return nil
+}
+
+// Apply returns the payable amount of a claim and whether it goes over a limit. usedInPeriod is the amount of the
+// other claims of the category in the same period that are not rejected. A capped claim that leaves nothing to pay
+// is refused with ErrReimbursementLimit.
+func (l ReimbursementLimits) Apply(claimed, usedInPeriod money.Decimal) (money.Decimal, bool, error) {
+	allowed := claimed
+	if l.PerClaim != nil && allowed.Cmp(*l.PerClaim) > 0 {
+		allowed = *l.PerClaim
+	}
+	if l.PerPeriod != nil {
+		remaining := l.PerPeriod.Sub(usedInPeriod)
+		if remaining.IsNegative() {
+			remaining = money.Zero
+		}
+		if allowed.Cmp(remaining) > 0 {
+			allowed = remaining
+		}
+	}
+
+	if allowed.Equal(claimed) {
+		return claimed, false, nil
+	}
+	if l.OverLimit == OverLimitFlag {
+		return claimed, true, nil
+	}
+	if allowed.IsZero() {
+		return money.Zero, true, fmt.Errorf("%w: the period limit of %s is used up", ErrReimbursementLimit, *l.PerPeriod)
+	}
+	return allowed, true, nil
+}
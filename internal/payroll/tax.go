@@ -0,0 +1,217 @@
+package payroll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chafid/payroll-project/internal/money"
+)
+
+// CodeIncomeTax is the payslip item for withheld income tax
+const CodeIncomeTax = "PPH21"
+
+// TaxBracket taxes the part of the annual taxable income up to UpTo at Rate. The last bracket has no UpTo.
+type TaxBracket struct {
+	UpTo *money.Decimal `json:"up_to"`
+	Rate money.Decimal  `json:"rate"`
+}
+
+// TaxRules is a progressive withholding scheme on annualized income, modelled on Indonesian PPh 21:
+// annual gross minus the occupational cost allowance (biaya jabatan) and the non-taxable allowance (PTKP),
+// rounded down, taxed per bracket and spread back over the periods of the year. Irregular income such as
+// a bonus is taxed once, in the period it is paid, on top of the annualized regular income.
+type TaxRules struct {
+	Brackets             []TaxBracket  `json:"brackets"`
+	PersonalAllowance    money.Decimal `json:"personal_allowance"`     // PTKP of a single taxpayer
+	MarriedAllowance     money.Decimal `json:"married_allowance"`      // added for a married taxpayer
+	DependentAllowance   money.Decimal `json:"dependent_allowance"`    // added per dependent
+	MaxDependents        int           `json:"max_dependents"`         // dependents beyond this do not count
+	OccupationalCostRate money.Decimal `json:"occupational_cost_rate"` // share of gross income that is deductible
+	OccupationalCostCap  money.Decimal `json:"occupational_cost_cap"`  // yearly ceiling of that deduction
+	PeriodsPerYear       int           `json:"periods_per_year"`
+	TaxableRounding      money.Decimal `json:"taxable_rounding"` // annual taxable income is rounded down to a multiple of this
+}
+
+// TaxProfile is the personal situation that sets the non-taxable allowance
+type TaxProfile struct {
+	Married    bool
+	Dependents int
+}
+
+// Status formats the profile the way PPh 21 does, e.g. "TK/0" or "K/2"
+func (p TaxProfile) Status(maxDependents int) string {
+	prefix := "TK"
+	if p.Married {
+		prefix = "K"
+	}
+	dependents := p.Dependents
+	if dependents > maxDependents {
+		dependents = maxDependents
+	}
+	return fmt.Sprintf("%s/%d", prefix, dependents)
+}
+
+// TaxBreakdown shows how the withholding of one period was reached
+type TaxBreakdown struct {
+	Status           string        `json:"status"`
+	AnnualGross      money.Decimal `json:"annual_gross"`     // annualized regular income plus the irregular income
+	IrregularIncome  money.Decimal `json:"irregular_income"` // paid this period only, not annualized
+	OccupationalCost money.Decimal `json:"occupational_cost"`
+	Contributions    money.Decimal `json:"deductible_contributions"`
+	Allowance        money.Decimal `json:"non_taxable_allowance"`
+	AnnualTaxable    money.Decimal `json:"annual_taxable"`
+	AnnualTax        money.Decimal `json:"annual_tax"`
+	IrregularTax     money.Decimal `json:"irregular_tax"` // the part of AnnualTax due to the irregular income, withheld in full
+	PeriodTax        money.Decimal `json:"period_tax"`
+}
+
+// DefaultTaxRules are the PPh 21 brackets of UU HPP and the PTKP amounts in force since 2016
+func DefaultTaxRules() TaxRules {
+	limit := func(s string) *money.Decimal {
+		d := money.MustParse(s)
+		return &d
+	}
+	return TaxRules{
+		Brackets: []TaxBracket{
+			{UpTo: limit("60000000"), Rate: money.MustParse("0.05")},
+			{UpTo: limit("250000000"), Rate: money.MustParse("0.15")},
+			{UpTo: limit("500000000"), Rate: money.MustParse("0.25")},
+			{UpTo: limit("5000000000"), Rate: money.MustParse("0.30")},
+			{Rate: money.MustParse("0.35")},
+		},
+		PersonalAllowance:    money.New(54000000),
+		MarriedAllowance:     money.New(4500000),
+		DependentAllowance:   money.New(4500000),
+		MaxDependents:        3,
+		OccupationalCostRate: money.MustParse("0.05"),
+		OccupationalCostCap:  money.New(6000000),
+		PeriodsPerYear:       12,
+		TaxableRounding:      money.New(1000),
+	}
+}
+
+var ErrInvalidTaxRules = errors.New("invalid tax rules")
+
+// Validate checks that brackets ascend and end with an open bracket and that the amounts make sense
+func (r TaxRules) Validate() error {
+	if len(r.Brackets) == 0 {
+		return fmt.Errorf("%w: at least one bracket is required", ErrInvalidTaxRules)
+	}
+	prev := money.Zero
+	for i, b := range r.Brackets {
+		last := i == len(r.Brackets)-1
+		if b.Rate.IsNegative() || b.Rate.Cmp(money.New(1)) > 0 {
+			return fmt.Errorf("%w: bracket %d rate must be between 0 and 1", ErrInvalidTaxRules, i+1)
+		}
+		if last != (b.UpTo == nil) {
+			return fmt.Errorf("%w: only the last bracket must have no up_to", ErrInvalidTaxRules)
+		}
+		if b.UpTo != nil {
+			if b.UpTo.Cmp(prev) <= 0 {
+				return fmt.Errorf("%w: bracket limits must ascend", ErrInvalidTaxRules)
+			}
+			prev = *b.UpTo
+		}
+	}
+	if r.PeriodsPerYear <= 0 || r.MaxDependents < 0 {
+		return fmt.Errorf("%w: periods_per_year must be positive and max_dependents not negative", ErrInvalidTaxRules)
+	}
+	for _, d := range []money.Decimal{r.PersonalAllowance, r.MarriedAllowance, r.DependentAllowance, r.OccupationalCostRate, r.OccupationalCostCap, r.TaxableRounding} {
+		if d.IsNegative() {
+			return fmt.Errorf("%w: amounts and rates must not be negative", ErrInvalidTaxRules)
+		}
+	}
+	return nil
+}
+
+// LoadTaxRules reads rules from a JSON file with the fields of TaxRules
+func LoadTaxRules(path string) (TaxRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TaxRules{}, err
+	}
+	var r TaxRules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return TaxRules{}, fmt.Errorf("%w: %v", ErrInvalidTaxRules, err)
+	}
+	return r, r.Validate()
+}
+
+// Allowance is the yearly non-taxable income for a profile
+func (r TaxRules) Allowance(p TaxProfile) money.Decimal {
+	total := r.PersonalAllowance
+	if p.Married {
+		total = total.Add(r.MarriedAllowance)
+	}
+	dependents := p.Dependents
+	if dependents > r.MaxDependents {
+		dependents = r.MaxDependents
+	}
+	return total.Add(r.DependentAllowance.Mul(money.New(int64(dependents))))
+}
+
+// AnnualTax applies the brackets to an annual taxable income
+func (r TaxRules) AnnualTax(taxable money.Decimal, rounding money.Rounding) money.Decimal {
+	tax := money.Zero
+	lower := money.Zero
+	for _, b := range r.Brackets {
+		if taxable.Cmp(lower) <= 0 {
+			break
+		}
+		upper := taxable
+		if b.UpTo != nil && b.UpTo.Cmp(taxable) < 0 {
+			upper = *b.UpTo
+		}
+		tax = tax.Add(rounding.MulDiv(upper.Sub(lower), b.Rate, money.New(1)))
+		if b.UpTo == nil {
+			break
+		}
+		lower = *b.UpTo
+	}
+	return tax
+}
+
+// Withholding annualizes the regular taxable gross of one period and returns the tax to withhold for it.
+// periodIrregular is taxable income paid once, e.g. a bonus: the tax it adds to the year is withheld in full
+// in this period instead of being spread. periodDeductible are the employee's pension contributions of the
+// period, which reduce the tax base.
+func (r TaxRules) Withholding(periodRegular, periodIrregular, periodDeductible money.Decimal, p TaxProfile, rounding money.Rounding) TaxBreakdown {
+	periods := money.New(int64(r.PeriodsPerYear))
+	regularGross := periodRegular.Mul(periods)
+	b := TaxBreakdown{
+		Status:          p.Status(r.MaxDependents),
+		AnnualGross:     regularGross.Add(periodIrregular),
+		IrregularIncome: periodIrregular,
+		Contributions:   periodDeductible.Mul(periods),
+		Allowance:       r.Allowance(p),
+	}
+
+	_, regularTaxable := r.annualTaxable(regularGross, b.Contributions, b.Allowance, rounding)
+	regularTax := r.AnnualTax(regularTaxable, rounding)
+
+	b.OccupationalCost, b.AnnualTaxable = r.annualTaxable(b.AnnualGross, b.Contributions, b.Allowance, rounding)
+	b.AnnualTax = r.AnnualTax(b.AnnualTaxable, rounding)
+	b.IrregularTax = b.AnnualTax.Sub(regularTax)
+	b.PeriodTax = rounding.MulDiv(regularTax, money.New(1), periods).Add(b.IrregularTax)
+	return b
+}
+
+// annualTaxable reduces an annual gross by the capped occupational cost, the deductible contributions and the
+// non-taxable allowance, rounded down and never negative
+func (r TaxRules) annualTaxable(gross, contributions, allowance money.Decimal, rounding money.Rounding) (occupationalCost, taxable money.Decimal) {
+	occupationalCost = rounding.MulDiv(gross, r.OccupationalCostRate, money.New(1))
+	if occupationalCost.Cmp(r.OccupationalCostCap) > 0 {
+		occupationalCost = r.OccupationalCostCap
+	}
+
+	taxable = gross.Sub(occupationalCost).Sub(contributions).Sub(allowance)
+	if r.TaxableRounding.IsPositive() {
+		taxable = money.Rounding{Mode: money.Down, MinorUnit: r.TaxableRounding}.Round(taxable)
+	}
+	if taxable.IsNegative() {
+		taxable = money.Zero
+	}
+	return occupationalCost, taxable
+}
@@ -0,0 +1,150 @@
+package rbac
+
+// Role is a user role as stored in users.role
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleHR       Role = "hr"
+	RoleFinance  Role = "finance"
+	RoleManager  Role = "manager"
+	RoleEmployee Role = "employee"
+
+	// RoleService marks service accounts. They authenticate with API keys and are
+	// authorized by the scopes of the key rather than by the matrix.
+	RoleService Role = "service"
+)
+
+// Permission names a single protected action
+type Permission string
+
+const (
+	PermManageAttendancePeriods Permission = "attendance_periods:manage"
+	PermOverridePeriodLock      Permission = "attendance_periods:override"
+	PermRunPayroll              Permission = "payroll:run"
+	PermFinalizePayroll         Permission = "payroll:finalize"
+	PermViewPayrollSummary      Permission = "payroll:view_summary"
+	PermManageSessions          Permission = "sessions:manage"
+	PermManageUsers             Permission = "users:manage"
+	PermManageLevels            Permission = "levels:manage"
+	PermManageServiceAccounts   Permission = "service_accounts:manage"
+	PermImportAttendance        Permission = "attendance:import"
+	PermManageCompensation      Permission = "compensation:manage"
+	PermManageLoans             Permission = "loans:manage"
+	PermManageHolidays          Permission = "holidays:manage"
+	PermApproveOvertime         Permission = "overtime:approve"
+	PermApproveReimbursements   Permission = "reimbursement:approve"
+
+	PermSubmitAttendance     Permission = "attendance:submit"
+	PermSubmitOvertime       Permission = "overtime:submit"
+	PermSubmitReimbursement  Permission = "reimbursement:submit"
+	PermViewOwnPayslip       Permission = "payslip:view_own"
+	PermViewOwnLoans         Permission = "loans:view_own"
+	PermViewOwnOvertime      Permission = "overtime:view_own"
+	PermViewOwnReimbursement Permission = "reimbursement:view_own"
+)
+
+// selfService are the permissions every authenticated user gets for their own records
+var selfService = []Permission{
+	PermSubmitAttendance,
+	PermSubmitOvertime,
+	PermSubmitReimbursement,
+	PermViewOwnPayslip,
+	PermViewOwnLoans,
+	PermViewOwnOvertime,
+	PermViewOwnReimbursement,
+}
+
+// matrix maps each role to the permissions it is granted on top of selfService
+var matrix = map[Role][]Permission{
+	RoleAdmin: {
+		PermManageAttendancePeriods,
+		PermOverridePeriodLock,
+		PermRunPayroll,
+		PermFinalizePayroll,
+		PermViewPayrollSummary,
+		PermManageSessions,
+		PermManageUsers,
+		PermManageLevels,
+		PermManageServiceAccounts,
+		PermImportAttendance,
+		PermManageCompensation,
+		PermManageLoans,
+		PermManageHolidays,
+		PermApproveOvertime,
+		PermApproveReimbursements,
+	},
+	RoleHR: {
+		PermManageAttendancePeriods,
+		PermViewPayrollSummary,
+		PermManageUsers,
+		PermManageLevels,
+		PermImportAttendance,
+		PermManageCompensation,
+		PermManageHolidays,
+		PermApproveOvertime,
+	},
+	RoleFinance: {
+		PermRunPayroll,
+		PermFinalizePayroll,
+		PermViewPayrollSummary,
+		PermManageCompensation,
+		PermManageLoans,
+		PermApproveReimbursements,
+	},
+	RoleManager: {
+		PermApproveOvertime,
+	},
+	RoleEmployee: {},
+}
+
+// serviceScopes are the permissions that can be granted to an API key
+var serviceScopes = []Permission{
+	PermImportAttendance,
+	PermViewPayrollSummary,
+}
+
+// IsValidRole reports whether role is one of the declared roles
+func IsValidRole(role string) bool {
+	_, ok := matrix[Role(role)]
+	return ok
+}
+
+// Can reports whether role is granted perm
+func Can(role string, perm Permission) bool {
+	granted, ok := matrix[Role(role)]
+	if !ok {
+		return false
+	}
+	for _, p := range selfService {
+		if p == perm {
+			return true
+		}
+	}
+	for _, p := range granted {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidScope reports whether scope can be granted to an API key
+func IsValidScope(scope string) bool {
+	for _, p := range serviceScopes {
+		if string(p) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether perm is among the scopes of an API key
+func HasScope(scopes []string, perm Permission) bool {
+	for _, s := range scopes {
+		if s == string(perm) {
+			return true
+		}
+	}
+	return false
+}
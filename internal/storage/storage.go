@@ -0,0 +1,30 @@
+// Package storage keeps uploaded files, such as reimbursement receipts, outside the database
+package storage
+
+import (
+	"errors"
+	"io"
+	"regexp"
+)
+
+// Store keeps files by key. Keys are chosen by the caller and are letters, digits, '-', '_' and '.'.
+type Store interface {
+	// Put stores the content of r under key, replacing any file with that key
+	Put(key string, r io.Reader) error
+	// Open returns the file stored under key, ErrNotFound when there is none
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key, it is not an error when there is none
+	Delete(key string) error
+}
+
+var (
+	ErrNotFound   = errors.New("stored file not found")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// validKey reports whether key is a single path element that can't leave the store
+func validKey(key string) bool {
+	return len(key) <= 255 && keyPattern.MatchString(key)
+}
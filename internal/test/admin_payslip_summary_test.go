@@ -11,6 +11,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+var payslipSummaryColumns = []string{"username", "id", "total_earnings", "tax_amount", "employee_contributions", "employer_contributions", "total_take_home"}
+
 func TestGetPayslipSummaryForAdmin(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
@@ -19,14 +21,21 @@ func TestGetPayslipSummaryForAdmin(t *testing.T) {
 	router := gin.Default()
 	router.GET("/admin/payslip-summary/:period_id", handlers.GetPayslipSummaryForAdmin(db))
 
-	// Mock rows that match: username, user_id, total_pay
-	mockRows := sqlmock.NewRows([]string{"username", "id", "total_take_home"}).
-		AddRow("employee001", "user1", 3000.0).
-		AddRow("employee002", "user2", 2500.0)
+	// Mock rows that match: username, user_id, earnings, tax, employee and employer contributions, total_pay
+	mockRows := sqlmock.NewRows(payslipSummaryColumns).
+		AddRow("employee001", "user1", 3270.0, 150.0, 120.0, 300.0, 3000.0).
+		AddRow("employee002", "user2", 2600.0, 0.0, 100.0, 250.0, 2500.0)
 
-	mock.ExpectQuery(`SELECT u.username, u.id, p.total_take_home FROM payslips p`).
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1`).
 		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("run1", "draft"))
+	mock.ExpectQuery(`SELECT u.username, u.id, p.total_earnings, p.tax_amount, p.employee_contributions, p.employer_contributions, p.total_take_home FROM payslips p`).
+		WithArgs("run1").
 		WillReturnRows(mockRows)
+	mock.ExpectQuery(`SELECT pc.code, pc.label, SUM\(pc.employee_amount\), SUM\(pc.employer_amount\) FROM payslip_contributions pc`).
+		WithArgs("run1").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "label", "employee_amount", "employer_amount"}).
+			AddRow("BPJS_JHT", "Old age savings (JHT)", 220.0, 550.0))
 
 	req := httptest.NewRequest(http.MethodGet, "/admin/payslip-summary/06-2025", nil)
 	w := httptest.NewRecorder()
@@ -36,4 +45,59 @@ func TestGetPayslipSummaryForAdmin(t *testing.T) {
 	assert.Contains(t, w.Body.String(), `"username":"employee001"`)
 	assert.Contains(t, w.Body.String(), `"username":"employee002"`)
 	assert.Contains(t, w.Body.String(), `"grand_total":5500`)
+	assert.Contains(t, w.Body.String(), `"total_tax":150`)
+	assert.Contains(t, w.Body.String(), `"status":"draft"`)
+	assert.Contains(t, w.Body.String(), `"total_employee_contributions":220`)
+	assert.Contains(t, w.Body.String(), `"total_employer_contributions":550`)
+	assert.Contains(t, w.Body.String(), `"total_employer_cost":6420`)
+	assert.Contains(t, w.Body.String(), `"contributions":[{"code":"BPJS_JHT","label":"Old age savings (JHT)","employee_amount":220,"employer_amount":550}]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPayslipSummaryForAdminWithLoanInstallment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.GET("/admin/payslip-summary/:period_id", handlers.GetPayslipSummaryForAdmin(db))
+
+	// 500 of the 5000 earned goes to a loan installment: take home is 5000 - 100 tax - 200 contributions - 500
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("run1", "draft"))
+	mock.ExpectQuery(`SELECT u.username, u.id, p.total_earnings, p.tax_amount, p.employee_contributions, p.employer_contributions, p.total_take_home FROM payslips p`).
+		WithArgs("run1").
+		WillReturnRows(sqlmock.NewRows(payslipSummaryColumns).AddRow("employee001", "user1", 5000.0, 100.0, 200.0, 400.0, 4200.0))
+	mock.ExpectQuery(`SELECT pc.code, pc.label, SUM\(pc.employee_amount\), SUM\(pc.employer_amount\) FROM payslip_contributions pc`).
+		WithArgs("run1").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "label", "employee_amount", "employer_amount"}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/payslip-summary/06-2025", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"grand_total":4200`)
+	// the installment is still paid by the company, so it doesn't lower the cost
+	assert.Contains(t, w.Body.String(), `"total_employer_cost":5400`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPayslipSummaryForAdminWithoutRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.GET("/admin/payslip-summary/:period_id", handlers.GetPayslipSummaryForAdmin(db))
+
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1`).
+		WithArgs("07-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/payslip-summary/07-2025", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -38,6 +38,8 @@ func TestSubmitAttendance(t *testing.T) {
 			WithArgs(periodID).
 			WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
 				AddRow(startDate, endDate))
+		expectNoHolidays(mock)
+		expectPeriodOpen(mock)
 
 		mock.ExpectExec(`INSERT INTO attendances`).
 			WithArgs(sqlmock.AnyArg(), userID, sqlmock.AnyArg(), periodID, userID, "127.0.0.1").
@@ -102,3 +104,52 @@ func TestSubmitAttendance(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Invalid period_id")
 	})
 }
+
+func TestImportAttendance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	employeeA := uuid.New().String()
+	employeeB := uuid.New().String()
+
+	mock.ExpectQuery(`SELECT start_date, end_date from attendance_periods WHERE id = \$1`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	expectPeriodOpen(mock)
+	mock.ExpectExec(`INSERT INTO attendances`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), "06-2025", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectPeriodOpen(mock)
+	mock.ExpectExec(`INSERT INTO attendances`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("attendance", "06-2025", "IMPORT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	payload := `{"period_id":"06-2025","records":[
+		{"user_id":"` + employeeA + `","date":"2025-06-02"},
+		{"user_id":"` + employeeB + `","date":"2025-06-02"},
+		{"user_id":"` + employeeA + `","date":"2025-06-07"},
+		{"user_id":"` + employeeA + `","date":"2025-07-01"}
+	]}`
+
+	router := newUserAdminRouter(handlers.ImportAttendance(db), http.MethodPost, "/admin/attendance/import", "service")
+	req := httptest.NewRequest(http.MethodPost, "/admin/attendance/import", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"imported":1`)
+	assert.Contains(t, w.Body.String(), "already submitted")
+	assert.Contains(t, w.Body.String(), "weekends")
+	assert.Contains(t, w.Body.String(), "not within the attendance period")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -6,17 +6,58 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/chafid/payroll-project/config"
 	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/testutils"
+	"github.com/chafid/payroll-project/internal/utils"
 )
 
+var userColumns = []string{"id", "password", "role", "must_change_password", "totp_enabled", "failed_login_count", "last_failed_login_at", "locked_until", "is_active"}
+
+func setLoginConfig() {
+	config.LoginBackoffThreshold = 3
+	config.LoginBackoffBase = 2 * time.Second
+	config.LoginMaxFailedAttempts = 5
+	config.LoginLockoutDuration = 15 * time.Minute
+	config.LoginMaxIPFailures = 20
+	config.LoginIPWindow = 15 * time.Minute
+}
+
+func postLogin(router *gin.Engine, username, password string) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:1234"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func expectIPFailures(mock sqlmock.Sqlmock, count int) {
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM login_attempts`).
+		WithArgs("127.0.0.1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func expectLoginAttempt(mock sqlmock.Sqlmock, succeeded bool) {
+	mock.ExpectExec(`INSERT INTO login_attempts`).
+		WithArgs("admin", "127.0.0.1", succeeded).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 func TestLogin(t *testing.T) {
 	gin.SetMode(gin.TestMode)
+	setLoginConfig()
+
+	assert.NoError(t, testutils.UseTestKeyStore())
 
 	// Mock DB
 	db, mock, err := sqlmock.New()
@@ -26,32 +67,219 @@ func TestLogin(t *testing.T) {
 	// Simulate hashed password in DB
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
 
-	// Expect DB query and return mock row
-	mock.ExpectQuery(`SELECT id, password, role FROM users WHERE username = \$1`).
-		WithArgs("admin").
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "password", "role",
-		}).AddRow("1", string(hashedPassword), "admin"))
-
 	// Setup router
 	router := gin.Default()
 	router.POST("/login", handlers.LoginHandler(db)) // fixed path
 
-	// Create request body
-	body := map[string]string{
-		"username": "admin",
-		"password": "admin123",
+	t.Run("Success", func(t *testing.T) {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users WHERE username = \$1`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).AddRow("1", string(hashedPassword), "admin", false, false, 0, nil, nil, true))
+		expectLoginAttempt(mock, true)
+
+		// Expect a session and its refresh token to be stored
+		mock.ExpectExec(`INSERT INTO sessions`).
+			WithArgs(sqlmock.AnyArg(), "1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).
+			WithArgs(sqlmock.AnyArg(), "1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := postLogin(router, "admin", "admin123")
+
+		// Assertions
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "token")
+		assert.Contains(t, w.Body.String(), "refresh_token")
+		assert.NotContains(t, w.Body.String(), "password_change_required")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Temporary password gets a restricted token", func(t *testing.T) {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).AddRow("1", string(hashedPassword), "admin", true, false, 0, nil, nil, true))
+		expectLoginAttempt(mock, true)
+		mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := postLogin(router, "admin", "admin123")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"password_change_required":true`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Two-factor user gets an MFA challenge", func(t *testing.T) {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).AddRow("1", string(hashedPassword), "admin", false, true, 0, nil, nil, true))
+
+		w := postLogin(router, "admin", "admin123")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"mfa_required":true`)
+		assert.NotContains(t, w.Body.String(), "refresh_token")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Wrong password reaching the limit locks the account", func(t *testing.T) {
+		userID := "11111111-1111-1111-1111-111111111111"
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).
+				AddRow(userID, string(hashedPassword), "admin", false, false, 4, time.Now().Add(-time.Hour), nil, true))
+		expectLoginAttempt(mock, false)
+		mock.ExpectQuery(`UPDATE users SET failed_login_count = CASE WHEN locked_until <= now\(\) THEN 0 ELSE failed_login_count END \+ 1`).
+			WithArgs(userID, 5, float64(900)).
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login_count", "locked_until"}).
+				AddRow(5, time.Now().Add(15*time.Minute)))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", userID, "LOGIN_FAILED", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", userID, "LOCKOUT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := postLogin(router, "admin", "wrong")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Wrong password after an expired lockout restarts the count", func(t *testing.T) {
+		userID := "11111111-1111-1111-1111-111111111111"
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).
+				AddRow(userID, string(hashedPassword), "admin", false, false, 5, time.Now().Add(-time.Hour), time.Now().Add(-45*time.Minute), true))
+		expectLoginAttempt(mock, false)
+		mock.ExpectQuery(`UPDATE users SET failed_login_count = CASE WHEN locked_until <= now\(\) THEN 0 ELSE failed_login_count END \+ 1, last_failed_login_at = now\(\), locked_until = CASE WHEN CASE WHEN locked_until <= now\(\) THEN 0 ELSE failed_login_count END \+ 1 >= \$2`).
+			WithArgs(userID, 5, float64(900)).
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login_count", "locked_until"}).AddRow(1, nil))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", userID, "LOGIN_FAILED", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := postLogin(router, "admin", "wrong")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Deactivated account", func(t *testing.T) {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).AddRow("1", string(hashedPassword), "admin", false, false, 0, nil, nil, false))
+		expectLoginAttempt(mock, false)
+
+		w := postLogin(router, "admin", "admin123")
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "deactivated")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Locked account", func(t *testing.T) {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).
+				AddRow("1", string(hashedPassword), "admin", false, false, 5, time.Now(), time.Now().Add(10*time.Minute), true))
+		expectLoginAttempt(mock, false)
+
+		w := postLogin(router, "admin", "admin123")
+
+		//same response as a wrong password, so the lock doesn't reveal the username
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid username or password")
+		assert.Empty(t, w.Header().Get("Retry-After"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Backoff skips password check", func(t *testing.T) {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT id, password, role, must_change_password, totp_enabled, failed_login_count, last_failed_login_at, locked_until, is_active FROM users`).
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows(userColumns).
+				AddRow("1", string(hashedPassword), "admin", false, false, 3, time.Now(), nil, true))
+		expectLoginAttempt(mock, false)
+
+		w := postLogin(router, "admin", "admin123")
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Address throttled", func(t *testing.T) {
+		expectIPFailures(mock, 20)
+
+		w := postLogin(router, "admin", "admin123")
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestLoginBackoff(t *testing.T) {
+	base := 2 * time.Second
+	max := 15 * time.Minute
+
+	assert.Equal(t, time.Duration(0), utils.LoginBackoff(2, 3, base, max))
+	assert.Equal(t, 2*time.Second, utils.LoginBackoff(3, 3, base, max))
+	assert.Equal(t, 4*time.Second, utils.LoginBackoff(4, 3, base, max))
+	assert.Equal(t, 8*time.Second, utils.LoginBackoff(5, 3, base, max))
+	assert.Equal(t, max, utils.LoginBackoff(50, 3, base, max))
+}
+
+func TestUnlockUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	unlock := func(role string) *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.UnlockUser(db), http.MethodPost, "/admin/users/:user_id/unlock", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+targetID+"/unlock", nil))
+		return w
+	}
+	expectTargetRole := func(role string) {
+		mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).
+			WithArgs(targetID).
+			WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(role))
 	}
-	jsonBody, _ := json.Marshal(body)
 
-	// Send request
-	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
+	t.Run("Success", func(t *testing.T) {
+		expectTargetRole("employee")
+		mock.ExpectExec(`UPDATE users SET failed_login_count = 0`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", targetID, "UNLOCK", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		w := unlock("hr")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("HR cannot unlock an admin", func(t *testing.T) {
+		expectTargetRole("admin")
+
+		w := unlock("hr")
 
-	// Assertions
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "token")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
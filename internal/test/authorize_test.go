@@ -0,0 +1,72 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/middlewares"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	newRouter := func(role string) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user_id", "11111111-1111-1111-1111-111111111111")
+			c.Set("role", role)
+			c.Next()
+		})
+		router.POST("/admin/run-payroll", middlewares.Authorize(db, rbac.PermRunPayroll), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "ok"})
+		})
+		return router
+	}
+
+	t.Run("Allowed role", func(t *testing.T) {
+		for _, role := range []string{"admin", "finance"} {
+			w := httptest.NewRecorder()
+			newRouter(role).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/run-payroll", nil))
+			assert.Equal(t, http.StatusOK, w.Code, role)
+		}
+	})
+
+	t.Run("Forbidden role is audited", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("authorization", "/admin/run-payroll", "DENY", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := httptest.NewRecorder()
+		newRouter("employee").ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/run-payroll", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "permission")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		assert.False(t, rbac.Can("superuser", rbac.PermSubmitAttendance))
+		assert.True(t, rbac.Can("manager", rbac.PermSubmitAttendance))
+	})
+
+	t.Run("Managers approve overtime", func(t *testing.T) {
+		assert.True(t, rbac.Can("manager", rbac.PermApproveOvertime))
+		assert.False(t, rbac.Can("finance", rbac.PermApproveOvertime))
+		assert.True(t, rbac.Can("employee", rbac.PermViewOwnOvertime))
+	})
+
+	t.Run("Finance approves reimbursements", func(t *testing.T) {
+		assert.True(t, rbac.Can("finance", rbac.PermApproveReimbursements))
+		assert.False(t, rbac.Can("manager", rbac.PermApproveReimbursements))
+		assert.True(t, rbac.Can("employee", rbac.PermViewOwnReimbursement))
+	})
+}
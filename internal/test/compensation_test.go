@@ -0,0 +1,217 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculatorAllowancesAndBonuses(t *testing.T) {
+	rules := payroll.DefaultTaxRules()
+	calc := payroll.NewCalculator()
+	calc.Tax = &rules
+
+	res, err := calc.Calculate(payroll.Input{
+		BaseSalary:     money.New(10000000),
+		WorkingDays:    20,
+		AttendanceDays: 20,
+		Allowances: []payroll.Earning{
+			{Code: "MEAL", Label: "Meal allowance", Amount: money.New(500000), Taxable: true},
+			{Code: "TRANSPORT", Label: "Transport allowance", Amount: money.New(300000)},
+		},
+		Bonuses: []payroll.Earning{{Label: "Project bonus", Amount: money.New(1000000), Taxable: true}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(800000), res.AllowanceAmount)
+	assert.Equal(t, money.New(1000000), res.BonusAmount)
+
+	var codes []string
+	for _, item := range res.Items {
+		codes = append(codes, item.Code)
+	}
+	assert.Equal(t, []string{"ATTENDANCE", "ALLOWANCE_MEAL", "ALLOWANCE_TRANSPORT", "BONUS", "PPH21"}, codes)
+
+	//the transport allowance is not taxable, the bonus is counted once instead of annualized
+	assert.Equal(t, money.New(127000000), res.Tax.AnnualGross)
+	assert.Equal(t, money.New(475000), res.TaxAmount)
+	assert.Equal(t, money.New(11325000), res.TotalTakeHome)
+	assert.NoError(t, payroll.CheckBalanced(res))
+
+	_, err = calc.Calculate(payroll.Input{
+		BaseSalary: money.New(4200), WorkingDays: 21, AttendanceDays: 21,
+		Bonuses: []payroll.Earning{{Label: "Clawback", Amount: money.New(-100)}},
+	})
+	assert.ErrorIs(t, err, payroll.ErrInvalidInput)
+}
+
+func TestRunPayrollPaysAllowancesAndBonuses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+		WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+			AddRow("u1", 4200.0, 21, 0.0, 0.0, 0.0, 0.0, false, 0, nil, nil))
+	expectEarnings(mock,
+		sqlmock.NewRows([]string{"user_id", "code", "label", "amount", "taxable"}).
+			AddRow("u1", "MEAL", "Meal allowance", 100.0, true).
+			AddRow("u2", "MEAL", "Meal allowance", 100.0, true), //no attendance, not paid
+		sqlmock.NewRows([]string{"user_id", "label", "amount", "taxable"}).
+			AddRow("u1", "Project bonus", 50.0, true))
+	expectNoLoans(mock)
+	expectNoOvertimePolicies(mock)
+	mock.ExpectExec(`INSERT INTO payslips`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "06-2025", "4200", "4200", 21, 21, "0", "0", "0", "0", nil, "0", "0", "4350", "0", "4350", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "21", "200", "4200", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 2, "ALLOWANCE_MEAL", "Meal allowance", "earning", "1", "100", "100", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 3, "BONUS", "Project bonus", "earning", "1", "50", "50", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAllowance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	levelID := "33333333-3333-3333-3333-333333333333"
+	router := newUserAdminRouter(handlers.CreateAllowance(db), http.MethodPost, "/admin/allowances", "hr")
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/allowances", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Level allowance", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM employee_levels WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`INSERT INTO allowances`).
+			WithArgs(sqlmock.AnyArg(), "MEAL", "Meal allowance", "500000", true, sqlmock.AnyArg(), nil,
+				time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("allowances", sqlmock.AnyArg(), "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"code":"meal","label":"Meal allowance","amount":500000,"level_id":"` + levelID + `","start_date":"2025-01-01"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Level and user at once", func(t *testing.T) {
+		w := post(`{"code":"MEAL","label":"Meal","amount":1,"level_id":"` + levelID + `","user_id":"` + levelID + `","start_date":"2025-01-01"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("End before start", func(t *testing.T) {
+		w := post(`{"code":"MEAL","label":"Meal","amount":1,"level_id":"` + levelID + `","start_date":"2025-01-01","end_date":"2024-12-31"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestCreateBonus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	employeeID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.CreateBonus(db), http.MethodPost, "/admin/attendance-periods/:period_id/bonuses", "finance")
+	post := func() *httptest.ResponseRecorder {
+		body := `{"user_id":"` + employeeID + `","label":"Project bonus","amount":1000000}`
+		req := httptest.NewRequest(http.MethodPost, "/admin/attendance-periods/06-2025/bonuses", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Draft run is re-run with the bonus", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT r.status FROM attendance_periods ap`).
+			WithArgs("06-2025").
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("draft"))
+		mock.ExpectExec(`INSERT INTO bonuses`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "06-2025", "Project bonus", "1000000", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("bonuses", sqlmock.AnyArg(), "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Finalized period", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT r.status FROM attendance_periods ap`).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("finalized"))
+
+		w := post()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown period", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT r.status FROM attendance_periods ap`).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}))
+
+		w := post()
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
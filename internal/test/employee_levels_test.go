@@ -0,0 +1,149 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListEmployeeLevels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT l.id, l.name, s.base_salary, s.effective_from`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "base_salary", "effective_from"}).
+			AddRow("lvl1", "Junior", 5000000.0, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)).
+			AddRow("lvl2", "Intern", nil, nil))
+
+	router := newUserAdminRouter(handlers.ListEmployeeLevels(db), http.MethodGet, "/admin/levels", "hr")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/levels", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"current_salary":5000000`)
+	assert.Contains(t, w.Body.String(), `"current_salary_effective_from":"2025-01-01"`)
+	assert.Contains(t, w.Body.String(), `"current_salary":null`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEmployeeLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.CreateEmployeeLevel(db), http.MethodPost, "/admin/levels", "admin")
+		req := httptest.NewRequest(http.MethodPost, "/admin/levels", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO employee_levels`).
+			WithArgs(sqlmock.AnyArg(), "Lead", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO employee_level_salaries`).
+			WithArgs(sqlmock.AnyArg(), "12000000", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("employee_levels", sqlmock.AnyArg(), "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"name":"Lead","base_salary":12000000,"effective_from":"2025-07-01"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Duplicate name", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO employee_levels`).WillReturnError(&duplicateKeyError{})
+		mock.ExpectRollback()
+
+		w := post(`{"name":"Junior","base_salary":5000000,"effective_from":"2025-07-01"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid date", func(t *testing.T) {
+		w := post(`{"name":"Lead","base_salary":12000000,"effective_from":"01-07-2025"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Non-positive salary", func(t *testing.T) {
+		w := post(`{"name":"Lead","base_salary":-1,"effective_from":"2025-07-01"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAddLevelSalary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	levelID := "33333333-3333-3333-3333-333333333333"
+	post := func(body string) *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.AddLevelSalary(db), http.MethodPost, "/admin/levels/:level_id/salaries", "hr")
+		req := httptest.NewRequest(http.MethodPost, "/admin/levels/"+levelID+"/salaries", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM employee_levels`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`INSERT INTO employee_level_salaries`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "5500000", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("employee_level_salaries", sqlmock.AnyArg(), "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"base_salary":5500000,"effective_from":"2026-01-01"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Same effective date", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM employee_levels`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`INSERT INTO employee_level_salaries`).WillReturnError(&duplicateKeyError{})
+
+		w := post(`{"base_salary":5500000,"effective_from":"2026-01-01"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown level", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM employee_levels`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		w := post(`{"base_salary":5500000,"effective_from":"2026-01-01"}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
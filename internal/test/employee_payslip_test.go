@@ -26,36 +26,50 @@ func TestGetEmployeePayslip(t *testing.T) {
 	})
 
 	// 1. Mock payslip
-	mock.ExpectQuery(`SELECT p\.id, p\.user_id, u\.username, p\.attendance_periods_id, p\.base_salary, p\.attendance_amount, p\.attendance_days, p\.overtime_hours, p\.overtime_amount, p\.reimbursement_amount, p\.total_take_home, p\.created_at FROM payslips p JOIN users u ON p\.user_id = u\.id WHERE p\.user_id = \$1 AND p\.attendance_periods_id = \$2`).
+	mock.ExpectQuery(`SELECT p\.id, p\.user_id, u\.username, p\.attendance_periods_id, p\.base_salary, p\.attendance_amount, p\.attendance_days, p\.working_days, p\.overtime_hours, p\.overtime_amount, p\.reimbursement_amount, p\.tax_amount, p\.tax_status, p\.employee_contributions, p\.employer_contributions, p\.total_earnings, p\.total_deductions, p\.total_take_home, p\.created_at FROM payslips p JOIN users u ON p\.user_id = u\.id JOIN payroll_runs r ON r\.id = p\.payroll_run_id AND r\.status = 'finalized' WHERE p\.user_id = \$1 AND p\.attendance_periods_id = \$2`).
 		WithArgs("11111111-1111-1111-1111-111111111111", "06-2025").
 		WillReturnRows(sqlmock.NewRows([]string{
 			"id", "user_id", "username", "attendance_periods_id", "base_salary",
-			"attendance_amount", "attendance_days", "overtime_hours",
-			"overtime_amount", "reimbursement_amount", "total_take_home", "created_at",
+			"attendance_amount", "attendance_days", "working_days", "overtime_hours",
+			"overtime_amount", "reimbursement_amount", "tax_amount", "tax_status",
+			"employee_contributions", "employer_contributions", "total_earnings", "total_deductions", "total_take_home", "created_at",
 		}).AddRow(
-			"p1", "11111111-1111-1111-1111-111111111111", "employee123", "06-2025", 3000.0,
-			2700.0, 20, 10.0, 300.0, 50.0, 3050.0, time.Now(),
+			"p1", "11111111-1111-1111-1111-111111111111", "employee123", "06-2025", 4200.0,
+			4000.0, 20, 21, 10.0, 500.0, 50.0, 120.0, "TK/0", 84.0, 155.4, 4550.0, 204.0, 4346.0, time.Now(),
 		))
 
-	// 2. Mock level salary (updated to match JOIN with users)
-	mock.ExpectQuery(`SELECT l\.base_salary FROM employee_levels l JOIN users u ON u\.level_id = l\.id WHERE u\.id = \$1`).
-		WithArgs("11111111-1111-1111-1111-111111111111").
-		WillReturnRows(sqlmock.NewRows([]string{"salary"}).AddRow(3000.0))
-
-	// 3. Mock attendance period dates
+	// 2. Mock attendance period dates (21 working days in June 2025)
 	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
 	end := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
 	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods`).
 		WithArgs("06-2025").
 		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
 			AddRow(start, end))
+	expectNoHolidays(mock)
 
-		// 4. Mock reimbursements
-	mock.ExpectQuery(`SELECT id, date, description, amount, created_at FROM reimbursements WHERE user_id = \$1 AND date BETWEEN \$2 AND \$3`).
+	// 3. Mock approved reimbursements
+	mock.ExpectQuery(`SELECT id, category_code, date, description, amount, created_at FROM reimbursements WHERE user_id = \$1 AND status = 'approved' AND date BETWEEN \$2 AND \$3`).
 		WithArgs("11111111-1111-1111-1111-111111111111", start, end).
 		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "date", "description", "amount", "created_at",
-		}).AddRow("r1", start.AddDate(0, 0, 5), "Internet", 50.0, time.Now()))
+			"id", "category_code", "date", "description", "amount", "created_at",
+		}).AddRow("r1", "internet", start.AddDate(0, 0, 5), "Internet", 50.0, time.Now()))
+
+	// 4. Mock payslip items
+	mock.ExpectQuery(`SELECT code, label, kind, quantity, rate, amount, taxable FROM payslip_items WHERE payslip_id = \$1 ORDER BY position`).
+		WithArgs("p1").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "label", "kind", "quantity", "rate", "amount", "taxable"}).
+			AddRow("ATTENDANCE", "Salary for days attended", "earning", 20.0, 200.0, 4000.0, true).
+			AddRow("OVERTIME", "Overtime", "earning", 10.0, 50.0, 500.0, true).
+			AddRow("REIMBURSEMENT", "Reimbursements", "earning", 1.0, 50.0, 50.0, false).
+			AddRow("BPJS_JHT", "Old age savings (JHT)", "deduction", 4200.0, 0.02, 84.0, false).
+			AddRow("PPH21", "Income tax (PPh 21)", "deduction", 1.0, 120.0, 120.0, false))
+
+	// 5. Mock contributions
+	mock.ExpectQuery(`SELECT code, label, base, employee_amount, employer_amount FROM payslip_contributions WHERE payslip_id = \$1`).
+		WithArgs("p1").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "label", "base", "employee_amount", "employer_amount"}).
+			AddRow("BPJS_JHT", "Old age savings (JHT)", 4200.0, 84.0, 155.4).
+			AddRow("BPJS_JKK", "Work accident insurance (JKK)", 4200.0, 0.0, 10.08))
 
 	// Perform request
 	req := httptest.NewRequest("GET", "/payslip/06-2025", nil)
@@ -64,9 +78,16 @@ func TestGetEmployeePayslip(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	assert.Contains(t, w.Body.String(), `"total_take_home":3050`)
+	assert.Contains(t, w.Body.String(), `"total_take_home":4346`)
+	assert.Contains(t, w.Body.String(), `"deductions":[{"code":"BPJS_JHT","label":"Old age savings (JHT)","amount":84},{"code":"PPH21","label":"Income tax (PPh 21)","amount":120}]`)
+	assert.Contains(t, w.Body.String(), `"employer_amount":10.08`)
+	assert.Contains(t, w.Body.String(), `{"code":"REIMBURSEMENT","label":"Reimbursements","kind":"earning","quantity":1,"rate":50,"amount":50,"taxable":false}`)
+	assert.Contains(t, w.Body.String(), `"total_deductions":204`)
+	assert.Contains(t, w.Body.String(), `"hourly_rate":25`)
+	assert.Contains(t, w.Body.String(), `"overtime_rate":50`)
+	assert.Contains(t, w.Body.String(), `"attendance":{"working_days":21,"period_working_days":21,"attendance_days":20,"attendance_amount":4000}`)
 	assert.Contains(t, w.Body.String(), `"overtime_hours":10`)
 	assert.Contains(t, w.Body.String(), `"reimbursements"`)
 	assert.Contains(t, w.Body.String(), `"username":"employee123"`)
-
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
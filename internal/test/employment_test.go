@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmploymentWindow(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	hired := time.Date(2025, 6, 16, 0, 0, 0, 0, time.UTC)
+	terminated := time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC)
+
+	from, to, ok := utils.EmploymentWindow(start, end, nil, nil)
+	assert.True(t, ok)
+	assert.Equal(t, start, from)
+	assert.Equal(t, end, to)
+
+	from, to, ok = utils.EmploymentWindow(start, end, &hired, &terminated)
+	assert.True(t, ok)
+	assert.Equal(t, hired, from)
+	assert.Equal(t, terminated, to)
+	assert.Equal(t, 5, utils.CountWorkingDays(from, to, nil))
+
+	_, _, ok = utils.EmploymentWindow(start, end, nil, &before)
+	assert.False(t, ok)
+}
+
+func TestCalculatorProratesPartialPeriod(t *testing.T) {
+	calc := payroll.NewCalculator()
+
+	//hired on June 16th: 11 of the 21 working days of June
+	res, err := calc.Calculate(payroll.Input{
+		BaseSalary:        money.New(4200),
+		WorkingDays:       11,
+		PeriodWorkingDays: 21,
+		AttendanceDays:    11,
+		OvertimeHours:     money.New(2),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(2200), res.AttendanceAmount)
+	assert.Equal(t, money.MustParse("25"), res.HourlyRate)
+	assert.Equal(t, money.New(100), res.OvertimeAmount)
+	assert.Equal(t, money.New(200), res.Items[0].Rate)
+	assert.NoError(t, payroll.CheckBalanced(res))
+
+	_, err = calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 22, PeriodWorkingDays: 21})
+	assert.ErrorIs(t, err, payroll.ErrInvalidInput)
+}
+
+func TestRunPayrollProratesMidPeriodHire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+		WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+			AddRow("u1", 4200.0, 11, 0.0, 0.0, 0.0, 0.0, false, 0, time.Date(2025, 6, 16, 0, 0, 0, 0, time.UTC), nil).
+			AddRow("u2", 4200.0, 5, 0.0, 0.0, 0.0, 0.0, false, 0, nil, time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC)))
+	expectNoEarnings(mock)
+	expectNoLoans(mock)
+	expectNoOvertimePolicies(mock)
+	mock.ExpectExec(`INSERT INTO payslips`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "06-2025", "4200", "2200", 11, 11, "0", "0", "0", "0", nil, "0", "0", "2200", "0", "2200", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "11", "200", "2200", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	//terminated on Friday June 6th, the last day of their first week
+	mock.ExpectExec(`INSERT INTO payslips`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u2", "06-2025", "4200", "1000", 5, 5, "0", "0", "0", "0", nil, "0", "0", "1000", "0", "1000", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "5", "200", "1000", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUserEmploymentDates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.UpdateUser(db), http.MethodPatch, "/admin/users/:user_id", "hr")
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/admin/users/"+targetID, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	hired := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	expectUser := func() {
+		mock.ExpectQuery(`SELECT u.id, u.username, u.role`).
+			WillReturnRows(sqlmock.NewRows(userListColumns).
+				AddRow(targetID, "employee001", "employee", "lvl1", "Junior", true, hired, nil, time.Now(), time.Now()))
+	}
+
+	t.Run("Termination", func(t *testing.T) {
+		expectUser()
+		mock.ExpectExec(`UPDATE users SET role = \$2, level_id = \$3, hired_on = \$4, terminated_on = \$5`).
+			WithArgs(sqlmock.AnyArg(), "employee", "lvl1", hired, time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", targetID, "UPDATE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`SELECT u.id, u.username, u.role`).
+			WillReturnRows(sqlmock.NewRows(userListColumns).
+				AddRow(targetID, "employee001", "employee", "lvl1", "Junior", true, hired, time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), time.Now(), time.Now()))
+
+		w := patch(`{"terminated_on":"2025-06-20"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"hired_on":"2024-03-01","terminated_on":"2025-06-20"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Terminated before hired", func(t *testing.T) {
+		expectUser()
+
+		w := patch(`{"terminated_on":"2024-02-28"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const holidayCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Holidays//ID\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20250331\r\n" +
+	"DTEND;VALUE=DATE:20250402\r\n" +
+	"SUMMARY:Idul Fitri\\, Hari Raya\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20250606T000000Z\r\n" +
+	"SUMMARY:Idul Adha 14\r\n" +
+	" 46 H\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20250401\r\n" +
+	"SUMMARY:Cuti bersama\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestCountWorkingDaysSkipsHolidays(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 21, utils.CountWorkingDays(start, end, nil))
+	//a holiday on a Saturday doesn't change anything
+	assert.Equal(t, 20, utils.CountWorkingDays(start, end, utils.Holidays{"2025-06-06": "Idul Adha", "2025-06-07": "Saturday holiday"}))
+}
+
+func TestParseHolidayCalendar(t *testing.T) {
+	holidays, err := utils.ParseHolidayCalendar(strings.NewReader(holidayCalendar))
+	assert.NoError(t, err)
+
+	var got []string
+	for _, h := range holidays {
+		got = append(got, h.Date.Format("2006-01-02")+" "+h.Name)
+	}
+	//DTEND is exclusive and the day already listed keeps its first name
+	assert.Equal(t, []string{
+		"2025-03-31 Idul Fitri, Hari Raya",
+		"2025-04-01 Idul Fitri, Hari Raya",
+		"2025-06-06 Idul Adha 1446 H",
+	}, got)
+
+	_, err = utils.ParseHolidayCalendar(strings.NewReader("not a calendar"))
+	assert.ErrorIs(t, err, utils.ErrInvalidCalendar)
+
+	_, err = utils.ParseHolidayCalendar(strings.NewReader("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:2025\nEND:VEVENT\nEND:VCALENDAR\n"))
+	assert.ErrorIs(t, err, utils.ErrInvalidCalendar)
+}
+
+func TestSubmitAttendanceOnHoliday(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT start_date, end_date from attendance_periods WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectHolidays(mock, sqlmock.NewRows([]string{"date", "name"}).AddRow(time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC), "Idul Adha"))
+
+	req := httptest.NewRequest(http.MethodPost, "/attendance", strings.NewReader(`{"period_id":"06-2025","date":"2025-06-06"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+	ctx.Set("user_id", userID.String())
+
+	handlers.SubmitAttendance(db)(ctx)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Idul Adha")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateHoliday(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.CreateHoliday(db), http.MethodPost, "/admin/holidays", "hr")
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/holidays", strings.NewReader(`{"date":"2025-06-06","name":"Idul Adha"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	expectFinalized := func(finalized bool) {
+		mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM attendance_periods ap JOIN payroll_runs r`).
+			WithArgs(time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(finalized))
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		expectFinalized(false)
+		mock.ExpectExec(`INSERT INTO holidays`).
+			WithArgs(time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC), "Idul Adha", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("holidays", "2025-06-06", "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Finalized period", func(t *testing.T) {
+		expectFinalized(true)
+
+		w := post()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestImportHolidays(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.ImportHolidays(db), http.MethodPost, "/admin/holidays/import", "admin")
+
+	finalized := func(v bool) *sqlmock.Rows { return sqlmock.NewRows([]string{"exists"}).AddRow(v) }
+	mock.ExpectBegin()
+	//March is finalized already
+	mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(finalized(true))
+	mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(finalized(false))
+	mock.ExpectExec(`INSERT INTO holidays`).
+		WithArgs(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), "Idul Fitri, Hari Raya", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(finalized(false))
+	mock.ExpectExec(`INSERT INTO holidays`).
+		WithArgs(time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC), "Idul Adha 1446 H", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("holidays", "holidays.ics", "IMPORT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "holidays.ics")
+	assert.NoError(t, err)
+	_, _ = part.Write([]byte(holidayCalendar))
+	assert.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/holidays/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"imported":1`)
+	assert.Contains(t, w.Body.String(), `{"date":"2025-03-31","name":"Idul Fitri, Hari Raya","reason":"Payroll for this period has been finalized"}`)
+	assert.Contains(t, w.Body.String(), `"reason":"A holiday already exists on this date"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRSAKeyFile(t *testing.T, dir, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	config.AccessTokenTTL = time.Minute
+
+	writeRSAKeyFile(t, dir, "2025-06-01")
+	ks, err := utils.LoadKeyStore(dir, "")
+	assert.NoError(t, err)
+	utils.SetKeyStore(ks)
+
+	oldToken, err := utils.GenerateJWT("11111111-1111-1111-1111-111111111111", "", "employee", "")
+	assert.NoError(t, err)
+
+	// Rotate: a newer Ed25519 key becomes active, the RSA key stays for verification
+	assert.NoError(t, utils.WriteEd25519KeyFile(dir, "2025-07-01"))
+	ks, err = utils.LoadKeyStore(dir, "")
+	assert.NoError(t, err)
+	utils.SetKeyStore(ks)
+
+	newToken, err := utils.GenerateJWT("11111111-1111-1111-1111-111111111111", "", "employee", "")
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		token string
+		kid   string
+		alg   string
+	}{
+		{oldToken.Token, "2025-06-01", "RS256"},
+		{newToken.Token, "2025-07-01", "EdDSA"},
+	} {
+		parsed, err := utils.ParseJWT(tc.token, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.True(t, parsed.Valid)
+		assert.Equal(t, tc.kid, parsed.Header["kid"])
+		assert.Equal(t, tc.alg, parsed.Method.Alg())
+	}
+
+	// Once the old key file is removed its tokens are rejected
+	assert.NoError(t, os.Remove(filepath.Join(dir, "2025-06-01.pem")))
+	ks, err = utils.LoadKeyStore(dir, "")
+	assert.NoError(t, err)
+	utils.SetKeyStore(ks)
+	_, err = utils.ParseJWT(oldToken.Token, jwt.MapClaims{})
+	assert.Error(t, err)
+}
+
+func TestJWKSHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	writeRSAKeyFile(t, dir, "rsa-1")
+	assert.NoError(t, utils.WriteEd25519KeyFile(dir, "ed-1"))
+	ks, err := utils.LoadKeyStore(dir, "ed-1")
+	assert.NoError(t, err)
+	utils.SetKeyStore(ks)
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", handlers.JWKSHandler())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Keys, 2)
+	assert.Equal(t, "ed-1", body.Keys[0]["kid"])
+	assert.Equal(t, "OKP", body.Keys[0]["kty"])
+	assert.Equal(t, "rsa-1", body.Keys[1]["kid"])
+	assert.Equal(t, "RSA", body.Keys[1]["kty"])
+	assert.NotEmpty(t, body.Keys[1]["n"])
+	assert.NotContains(t, w.Body.String(), `"d"`)
+}
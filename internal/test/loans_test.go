@@ -0,0 +1,228 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const loanID = "44444444-4444-4444-4444-444444444444"
+
+var loanColumns = []string{"id", "user_id", "description", "principal", "installment_amount", "start_date", "created_at", "repaid"}
+
+func TestCalculatorLoanInstallments(t *testing.T) {
+	calc := payroll.NewCalculator()
+
+	res, err := calc.Calculate(payroll.Input{
+		BaseSalary:     money.New(4200),
+		WorkingDays:    21,
+		AttendanceDays: 21,
+		Loans: []payroll.LoanInstallment{
+			{LoanID: "l1", Label: "Salary advance", Amount: money.New(1000)},
+			{LoanID: "l2", Label: "Laptop", Amount: money.New(5000)}, //more than what is left
+			{LoanID: "l3", Label: "Phone", Amount: money.New(100)},   //nothing left
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []payroll.LoanInstallment{
+		{LoanID: "l1", Label: "Salary advance", Amount: money.New(1000)},
+		{LoanID: "l2", Label: "Laptop", Amount: money.New(3200)},
+	}, res.Loans)
+	assert.Equal(t, money.New(4200), res.LoanAmount)
+	assert.True(t, res.TotalTakeHome.IsZero())
+	assert.NoError(t, payroll.CheckBalanced(res))
+
+	last := res.Items[len(res.Items)-1]
+	assert.Equal(t, payroll.CodeLoan, last.Code)
+	assert.Equal(t, payroll.KindDeduction, last.Kind)
+}
+
+func TestRunPayrollDeductsLoanInstallments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+		WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+			AddRow("u1", 4200.0, 21, 0.0, 0.0, 0.0, 0.0, false, 0, nil, nil))
+	expectNoEarnings(mock)
+	expectLoans(mock, sqlmock.NewRows([]string{"id", "user_id", "description", "installment"}).
+		AddRow(loanID, "u1", "Salary advance", 700.0))
+	expectNoOvertimePolicies(mock)
+	mock.ExpectExec(`INSERT INTO payslips`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "06-2025", "4200", "4200", 21, 21, "0", "0", "0", "0", nil, "0", "0", "4200", "700", "3500", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "21", "200", "4200", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 2, "LOAN", "Salary advance", "deduction", "1", "700", "700", false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO loan_repayments`).
+		WithArgs(loanID, "installment", sqlmock.AnyArg(), "06-2025", "700", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListMyLoans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	employeeID := "11111111-1111-1111-1111-111111111111"
+	router := gin.New()
+	router.GET("/employee/loans", func(c *gin.Context) {
+		c.Set("user_id", employeeID)
+		handlers.ListMyLoans(db)(c)
+	})
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT l.id, l.user_id, l.description, l.principal, l.installment_amount, l.start_date, l.created_at`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(loanColumns).
+			AddRow(loanID, employeeID, "Salary advance", 3000.0, 1000.0, start, time.Now(), 2500.0).
+			AddRow("l2", employeeID, "Laptop", 1000.0, 500.0, start, time.Now(), 1000.0))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/employee/loans", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"balance":500,"next_installment":500,"status":"active"`)
+	assert.Contains(t, w.Body.String(), `"balance":0,"next_installment":0,"status":"paid_off"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPayOffLoan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.PayOffLoan(db), http.MethodPost, "/admin/loans/:loan_id/payoff", "finance")
+	payoff := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/loans/"+loanID+"/payoff", nil))
+		return w
+	}
+
+	t.Run("Remaining balance is settled", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT l.principal, COALESCE`).
+			WillReturnRows(sqlmock.NewRows([]string{"principal", "repaid"}).AddRow(3000.0, 1000.0))
+		mock.ExpectExec(`INSERT INTO loan_repayments`).
+			WithArgs(sqlmock.AnyArg(), "payoff", "2000", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("loans", loanID, "PAYOFF", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := payoff()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"amount":2000`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Already repaid", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT l.principal, COALESCE`).
+			WillReturnRows(sqlmock.NewRows([]string{"principal", "repaid"}).AddRow(3000.0, 3000.0))
+		mock.ExpectRollback()
+
+		w := payoff()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSkipLoanInstallment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.SkipLoanInstallment(db), http.MethodPost, "/admin/loans/:loan_id/skips", "finance")
+	skip := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/loans/"+loanID+"/skips", strings.NewReader(`{"period_id":"06-2025","reason":"Medical leave"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	expectLoan := func() {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM loans WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		expectLoan()
+		mock.ExpectQuery(`SELECT r.status FROM attendance_periods ap`).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(nil))
+		mock.ExpectExec(`INSERT INTO loan_skips`).
+			WithArgs(sqlmock.AnyArg(), "06-2025", "Medical leave", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("loans", loanID, "SKIP", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := skip()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Finalized period", func(t *testing.T) {
+		expectLoan()
+		mock.ExpectQuery(`SELECT r.status FROM attendance_periods ap`).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("finalized"))
+
+		w := skip()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
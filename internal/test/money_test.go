@@ -0,0 +1,103 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecimal(t *testing.T) {
+	d := money.MustParse
+
+	t.Run("Sums do not drift", func(t *testing.T) {
+		total := money.Zero
+		for i := 0; i < 10; i++ {
+			total = total.Add(d("0.1"))
+		}
+		assert.Equal(t, money.New(1), total)
+	})
+
+	t.Run("Parse and format", func(t *testing.T) {
+		assert.Equal(t, "4550", d("4550.00").String())
+		assert.Equal(t, "-12.5", d("-12.50").String())
+		assert.Equal(t, "0.0001", d("0.0001").String())
+
+		_, err := money.Parse("1e3")
+		assert.ErrorIs(t, err, money.ErrInvalidDecimal)
+		_, err = money.Parse("abc")
+		assert.ErrorIs(t, err, money.ErrInvalidDecimal)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var v struct {
+			Amount money.Decimal `json:"amount"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(`{"amount":100.10}`), &v))
+		assert.Equal(t, d("100.1"), v.Amount)
+		assert.NoError(t, json.Unmarshal([]byte(`{"amount":"250000"}`), &v))
+		assert.Equal(t, money.New(250000), v.Amount)
+
+		out, err := json.Marshal(v)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"amount":250000}`, string(out))
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		var v money.Decimal
+		assert.NoError(t, v.Scan([]byte("1234.56")))
+		assert.Equal(t, d("1234.56"), v)
+		assert.NoError(t, v.Scan(nil))
+		assert.True(t, v.IsZero())
+		assert.Error(t, v.Scan(true))
+	})
+}
+
+func TestRounding(t *testing.T) {
+	d := money.MustParse
+	cents := d("0.01")
+
+	cases := []struct {
+		mode  money.Mode
+		value string
+		want  string
+	}{
+		{money.HalfUp, "2.345", "2.35"},
+		{money.HalfUp, "-2.345", "-2.35"},
+		{money.HalfEven, "2.345", "2.34"},
+		{money.HalfEven, "2.355", "2.36"},
+		{money.Down, "2.349", "2.34"},
+		{money.Down, "-2.349", "-2.34"},
+		{money.Up, "2.341", "2.35"},
+	}
+	for _, tc := range cases {
+		r := money.Rounding{Mode: tc.mode, MinorUnit: cents}
+		assert.Equal(t, d(tc.want), r.Round(d(tc.value)), "%s %s", tc.mode, tc.value)
+	}
+
+	t.Run("Minor unit", func(t *testing.T) {
+		r := money.Rounding{Mode: money.HalfUp, MinorUnit: money.New(100)}
+		assert.Equal(t, money.New(1500), r.Round(d("1450")))
+		assert.Equal(t, money.New(1400), r.Round(d("1449.99")))
+	})
+
+	t.Run("MulDiv rounds once", func(t *testing.T) {
+		r := money.Rounding{Mode: money.HalfUp, MinorUnit: cents}
+		assert.Equal(t, d("3333.33"), r.MulDiv(money.New(10000), money.New(1), money.New(3)))
+	})
+
+	t.Run("Zero value uses the default", func(t *testing.T) {
+		assert.Equal(t, d("2.35"), money.Rounding{}.Round(d("2.345")))
+	})
+
+	t.Run("Configuration is validated", func(t *testing.T) {
+		_, err := money.NewRounding("nearest", "0.01")
+		assert.Error(t, err)
+		_, err = money.NewRounding("half_up", "0")
+		assert.Error(t, err)
+		r, err := money.NewRounding("half_even", "100")
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(100), r.MinorUnit)
+	})
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var overtimeListColumns = []string{"id", "user_id", "username", "date", "hours", "status", "reviewed_by", "reviewed_at", "review_comment", "created_at"}
+
+func TestReviewOvertime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	overtimeID := "44444444-4444-4444-4444-444444444444"
+	employeeID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.ReviewOvertime(db), http.MethodPost, "/admin/overtimes/:overtime_id/review", "manager")
+	review := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/overtimes/"+overtimeID+"/review", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	expectOvertime := func(userID, status string) {
+		mock.ExpectQuery(`SELECT user_id, date, status FROM overtimes WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "date", "status"}).
+				AddRow(userID, time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC), status))
+	}
+
+	t.Run("Approve", func(t *testing.T) {
+		expectOvertime(employeeID, "pending")
+		mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM attendance_periods ap JOIN payroll_runs r`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(`UPDATE overtimes SET status = \$2, reviewed_by = \$3, reviewed_at = now\(\), review_comment = \$4`).
+			WithArgs(sqlmock.AnyArg(), "approved", sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("overtimes", overtimeID, "APPROVE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := review(`{"status":"approved"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"approved"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reject requires a comment", func(t *testing.T) {
+		w := review(`{"status":"rejected"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Own request", func(t *testing.T) {
+		expectOvertime(payrollAdminID, "pending")
+
+		w := review(`{"status":"approved"}`)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Already reviewed", func(t *testing.T) {
+		expectOvertime(employeeID, "rejected")
+
+		w := review(`{"status":"approved"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "already been rejected")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListOvertimes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	t.Run("Approvers see pending requests by default", func(t *testing.T) {
+		router := newUserAdminRouter(handlers.ListOvertimes(db), http.MethodGet, "/admin/overtimes", "hr")
+		mock.ExpectQuery(`FROM overtimes o JOIN users u ON u.id = o.user_id WHERE o.status = \$1 ORDER BY o.date`).
+			WithArgs("pending").
+			WillReturnRows(sqlmock.NewRows(overtimeListColumns).
+				AddRow("o1", "u1", "employee001", time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC), 2.0, "pending", nil, nil, nil, time.Now()))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/overtimes", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2025-06-04","hours":2,"status":"pending"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Employees see the review of their own requests", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/overtime", func(c *gin.Context) {
+			c.Set("user_id", "11111111-1111-1111-1111-111111111111")
+			handlers.ListMyOvertime(db)(c)
+		})
+		mock.ExpectQuery(`FROM overtimes o JOIN users u ON u.id = o.user_id WHERE o.user_id = \$1 ORDER BY o.date`).
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(overtimeListColumns).
+				AddRow("o1", "u1", "employee001", time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC), 2.0, "rejected",
+					payrollAdminID, time.Date(2025, 6, 5, 9, 0, 0, 0, time.UTC), "No overtime was planned", time.Now()))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/overtime", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"rejected"`)
+		assert.Contains(t, w.Body.String(), `"review_comment":"No overtime was planned"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRunPayrollCountsApprovedOvertime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	//pending and rejected hours are left out of the overtime aggregate
+	mock.ExpectQuery(`FROM overtimes ot .* WHERE ot.status = 'approved' AND ot.date BETWEEN`).
+		WillReturnError(errors.New("stop after the inputs query"))
+	mock.ExpectRollback()
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
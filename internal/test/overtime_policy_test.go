@@ -0,0 +1,284 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var overtimePolicyColumns = []string{"daily_cap", "weekly_cap", "monthly_cap", "weekday_multiplier", "rest_day_multiplier", "holiday_multiplier", "increment"}
+
+// expectOvertimePolicy expects the lookup of the overtime policy of the submitting employee's level
+func expectOvertimePolicy(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`FROM overtime_policies op JOIN users u ON u.level_id = op.level_id WHERE u.id = \$1`).WillReturnRows(rows)
+}
+
+// expectNoOvertimePolicy expects an employee whose level uses the company overtime policy
+func expectNoOvertimePolicy(mock sqlmock.Sqlmock) {
+	expectOvertimePolicy(mock, sqlmock.NewRows(overtimePolicyColumns))
+}
+
+// expectOvertimeLock expects the transaction locking the overtime of the user while a submission is checked
+func expectOvertimeLock(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).
+		WithArgs("11111111-1111-1111-1111-111111111111").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectRecordedOvertime expects the lock and the hours already recorded in the week and month of a submission
+func expectRecordedOvertime(mock sqlmock.Sqlmock, week, month float64) {
+	expectOvertimeLock(mock)
+	mock.ExpectQuery(`FROM overtimes WHERE user_id = \$1 AND date <> \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"week", "month"}).AddRow(week, month))
+}
+
+func TestOvertimePolicyCheckHours(t *testing.T) {
+	policy := payroll.OvertimePolicy{
+		DailyCap:          money.New(4),
+		WeeklyCap:         money.New(10),
+		MonthlyCap:        money.New(30),
+		WeekdayMultiplier: money.MustParse("1.5"),
+		RestDayMultiplier: money.New(2),
+		HolidayMultiplier: money.New(3),
+		Increment:         money.MustParse("0.5"),
+	}
+	assert.NoError(t, policy.Validate())
+
+	assert.NoError(t, policy.CheckHours(money.MustParse("2.5"), money.New(7), money.New(20)))
+	for _, tc := range []struct {
+		name               string
+		hours, week, month money.Decimal
+		message            string
+	}{
+		{"Not a step", money.MustParse("1.25"), money.Zero, money.Zero, "steps of 0.5"},
+		{"Daily cap", money.MustParse("4.5"), money.Zero, money.Zero, "at most 4 hours a day"},
+		{"Weekly cap", money.New(2), money.MustParse("8.5"), money.Zero, "at most 10 hours a week"},
+		{"Monthly cap", money.New(2), money.Zero, money.MustParse("29"), "at most 30 hours a month"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.CheckHours(tc.hours, tc.week, tc.month)
+			assert.ErrorIs(t, err, payroll.ErrOvertimeLimit)
+			assert.Contains(t, err.Error(), tc.message)
+		})
+	}
+
+	policy.WeeklyCap = money.New(3)
+	assert.ErrorIs(t, policy.Validate(), payroll.ErrInvalidOvertimePolicy)
+	policy.WeeklyCap = money.Zero
+	policy.HolidayMultiplier = money.Zero
+	assert.ErrorIs(t, policy.Validate(), payroll.ErrInvalidOvertimePolicy)
+}
+
+func TestCalculatorOvertimeByDayKind(t *testing.T) {
+	calc := payroll.NewCalculator()
+	policy := payroll.OvertimePolicy{WeekdayMultiplier: money.MustParse("1.5"), RestDayMultiplier: money.New(2), HolidayMultiplier: money.New(3)}
+
+	res, err := calc.Calculate(payroll.Input{
+		BaseSalary:      money.New(4200),
+		WorkingDays:     21,
+		OvertimeHours:   money.New(2),
+		RestDayOvertime: money.New(1),
+		HolidayOvertime: money.New(1),
+		Overtime:        &policy,
+	})
+	assert.NoError(t, err)
+	//25 an hour: 2 x 1.5 + 1 x 2 + 1 x 3 hours
+	assert.Equal(t, money.New(200), res.OvertimeAmount)
+	assert.Equal(t, money.MustParse("37.5"), res.OvertimeRate)
+	assert.Equal(t, money.New(50), payroll.SumByCode(res.Items, payroll.CodeOvertimeRestDay))
+	assert.Equal(t, money.New(75), payroll.SumByCode(res.Items, payroll.CodeOvertimeHoliday))
+	assert.NoError(t, payroll.CheckBalanced(res))
+
+	//without a level policy the company policy pays 2x on every kind of day
+	res, err = calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 21, HolidayOvertime: money.New(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(50), res.OvertimeAmount)
+}
+
+func TestSubmitOvertimeOverPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.POST("/overtime", func(c *gin.Context) {
+		c.Set("user_id", "11111111-1111-1111-1111-111111111111")
+		handlers.SubmitOvertime(db)(c)
+	})
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/overtime", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Weekly cap of the level", func(t *testing.T) {
+		expectPeriodOpen(mock)
+		expectOvertimePolicy(mock, sqlmock.NewRows(overtimePolicyColumns).AddRow(4.0, 10.0, 0.0, 1.5, 2.0, 3.0, 0.5))
+		//Wednesday June 4th: the week runs from Monday 2nd to Sunday 8th
+		expectOvertimeLock(mock)
+		mock.ExpectQuery(`FROM overtimes WHERE user_id = \$1 AND date <> \$2`).
+			WithArgs(sqlmock.AnyArg(), time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"week", "month"}).AddRow(9.0, 9.0))
+		mock.ExpectRollback()
+
+		w := post(`{"date":"2025-06-04","hours":2}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "at most 10 hours a week")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Company daily cap", func(t *testing.T) {
+		expectPeriodOpen(mock)
+		expectNoOvertimePolicy(mock)
+		expectRecordedOvertime(mock, 0, 0)
+		mock.ExpectRollback()
+
+		w := post(`{"date":"2025-06-04","hours":4}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "at most 3 hours a day")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRunPayrollOvertimePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+		WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+			AddRow("u1", 4200.0, 21, 2.0, 1.0, 1.0, 0.0, false, 0, nil, nil))
+	expectNoEarnings(mock)
+	expectNoLoans(mock)
+	expectOvertimePolicies(mock, sqlmock.NewRows(append([]string{"user_id"}, overtimePolicyColumns...)).
+		AddRow("u1", 4.0, 0.0, 0.0, 1.5, 2.0, 3.0, 0.0))
+	mock.ExpectExec(`INSERT INTO payslips`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "06-2025", "4200", "4200", 21, 21, "200", "4", "0", "0", nil, "0", "0", "4400", "0", "4400", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "21", "200", "4200", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 2, "OVERTIME", "Overtime", "earning", "2", "37.5", "75", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 3, "OVERTIME_REST_DAY", "Rest day overtime", "earning", "1", "50", "50", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 4, "OVERTIME_HOLIDAY", "Holiday overtime", "earning", "1", "75", "75", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetOvertimePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	levelID := "33333333-3333-3333-3333-333333333333"
+	router := newUserAdminRouter(handlers.SetOvertimePolicy(db), http.MethodPut, "/admin/levels/:level_id/overtime-policy", "hr")
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/levels/"+levelID+"/overtime-policy", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM employee_levels WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`INSERT INTO overtime_policies`).
+			WithArgs(sqlmock.AnyArg(), "4", "10", "0", "1.5", "2", "3", "0.5", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("overtime_policies", levelID, "UPSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := put(`{"daily_cap":4,"weekly_cap":10,"weekday_multiplier":1.5,"rest_day_multiplier":2,"holiday_multiplier":3,"increment":0.5}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"default":false`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Missing multiplier", func(t *testing.T) {
+		w := put(`{"daily_cap":4,"weekday_multiplier":1.5,"rest_day_multiplier":2}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "multipliers must be greater than 0")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetOvertimePolicyDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	levelID := "33333333-3333-3333-3333-333333333333"
+	router := newUserAdminRouter(handlers.GetOvertimePolicy(db), http.MethodGet, "/admin/levels/:level_id/overtime-policy", "admin")
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM employee_levels WHERE id = \$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM overtime_policies op WHERE op.level_id = \$1`).
+		WillReturnRows(sqlmock.NewRows(overtimePolicyColumns))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/levels/"+levelID+"/overtime-policy", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"daily_cap":3`)
+	assert.Contains(t, w.Body.String(), `"default":true`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
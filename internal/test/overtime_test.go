@@ -10,6 +10,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -31,12 +32,16 @@ func TestSubmitOvertime(t *testing.T) {
 
 	payload := handlers.OvertimeRequest{
 		Date:  time.Now().Format("2006-01-02"),
-		Hours: 2,
+		Hours: money.New(2),
 	}
 	body, _ := json.Marshal(payload)
 
+	expectPeriodOpen(mock)
+	expectNoOvertimePolicy(mock)
+	expectRecordedOvertime(mock, 0, 0)
+
 	// Mock insert or update query
-	mock.ExpectExec(`INSERT INTO overtimes`).
+	mock.ExpectQuery(`INSERT INTO overtimes`).
 		WithArgs(sqlmock.AnyArg(), // overtime ID
 			uuid.MustParse("11111111-1111-1111-1111-111111111111"), // user ID
 			sqlmock.AnyArg(), // date
@@ -44,7 +49,8 @@ func TestSubmitOvertime(t *testing.T) {
 			uuid.MustParse("11111111-1111-1111-1111-111111111111"), // created_by
 			"127.0.0.1", // IP
 		).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("33333333-3333-3333-3333-333333333333"))
+	mock.ExpectCommit()
 
 	// Optional: you can skip LogAudit or mock it if needed
 
@@ -56,4 +62,5 @@ func TestSubmitOvertime(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"pending"`)
 }
@@ -0,0 +1,259 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/middlewares"
+	"github.com/chafid/payroll-project/internal/testutils"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidatePassword(t *testing.T) {
+	config.PasswordMinLength = 10
+
+	assert.Error(t, utils.ValidatePassword("short"))
+	assert.NoError(t, utils.ValidatePassword("long-enough-password"))
+	assert.Error(t, utils.ValidatePassword(strings.Repeat("a", 73)))
+}
+
+func TestChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.PasswordMinLength = 8
+	config.PasswordHistory = 5
+	assert.NoError(t, testutils.UseTestKeyStore())
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := "11111111-1111-1111-1111-111111111111"
+	router := gin.New()
+	router.POST("/auth/change-password", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", "employee")
+		handlers.ChangePassword(db)(c)
+	})
+
+	currentHash, _ := bcrypt.GenerateFromPassword([]byte("temporary1"), bcrypt.MinCost)
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("previous-pass"), bcrypt.MinCost)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/change-password", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	expectHistory := func() {
+		mock.ExpectQuery(`SELECT password FROM users WHERE id = \$1 UNION ALL`).
+			WithArgs(userID, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"password"}).
+				AddRow(string(currentHash)).AddRow(string(oldHash)))
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT password, totp_enabled FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"password", "totp_enabled"}).AddRow(string(currentHash), false))
+		expectHistory()
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE users SET password = \$2, must_change_password = \$3`).
+			WithArgs(userID, sqlmock.AnyArg(), false, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO password_history`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", userID, "PASSWORD_CHANGE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"current_password":"temporary1","new_password":"brand-new-pass"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "refresh_token")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reused password", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT password, totp_enabled FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"password", "totp_enabled"}).AddRow(string(currentHash), false))
+		expectHistory()
+
+		w := post(`{"current_password":"temporary1","new_password":"previous-pass"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "used recently")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Too short", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT password, totp_enabled FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"password", "totp_enabled"}).AddRow(string(currentHash), false))
+
+		w := post(`{"current_password":"temporary1","new_password":"short"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "at least 8")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Wrong current password", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT password, totp_enabled FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"password", "totp_enabled"}).AddRow(string(currentHash), false))
+
+		w := post(`{"current_password":"nope","new_password":"brand-new-pass"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.PasswordMinLength = 8
+	config.PasswordHistory = 5
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := "11111111-1111-1111-1111-111111111111"
+	router := gin.New()
+	router.POST("/auth/reset-password", handlers.ResetPassword(db))
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/reset-password", strings.NewReader(`{"token":"reset-token","new_password":"brand-new-pass"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = \$1`).
+			WithArgs(utils.HashToken("reset-token")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).
+				AddRow("reset-1", userID, time.Now().Add(time.Hour), nil))
+		mock.ExpectQuery(`SELECT password FROM users WHERE id = \$1 UNION ALL`).
+			WillReturnRows(sqlmock.NewRows([]string{"password"}))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE password_reset_tokens SET used_at = now\(\)`).
+			WithArgs("reset-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE users SET password`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO password_history`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Used token", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).
+				AddRow("reset-1", userID, time.Now().Add(time.Hour), time.Now()))
+
+		w := post()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).
+				AddRow("reset-1", userID, time.Now().Add(-time.Minute), nil))
+
+		w := post()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCreatePasswordReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.PasswordResetTTL = time.Hour
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	reset := func(role string) *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.CreatePasswordReset(db), http.MethodPost, "/admin/users/:user_id/reset-password", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+targetID+"/reset-password", nil))
+		return w
+	}
+
+	t.Run("HR cannot reset an admin", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin"))
+
+		w := reset("hr")
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NotContains(t, w.Body.String(), "reset_token")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("employee"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE password_reset_tokens SET used_at = now\(\) WHERE user_id = \$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO password_reset_tokens`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := reset("hr")
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), "reset_token")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireFullAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/employee/payslip", func(c *gin.Context) {
+		c.Set("restriction", utils.RestrictionPasswordChange)
+		c.Next()
+	}, middlewares.RequireFullAccess(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/employee/payslip", nil))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "password_change")
+}
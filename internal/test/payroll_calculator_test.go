@@ -0,0 +1,109 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayrollCalculator(t *testing.T) {
+	calc := payroll.NewCalculator()
+	d := money.MustParse
+
+	t.Run("Itemized payslip", func(t *testing.T) {
+		res, err := calc.Calculate(payroll.Input{
+			BaseSalary:     money.New(4200),
+			WorkingDays:    21,
+			AttendanceDays: 20,
+			OvertimeHours:  money.New(10),
+			Reimbursements: money.New(50),
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, money.New(25), res.HourlyRate)
+		assert.Equal(t, money.New(50), res.OvertimeRate)
+		assert.Equal(t, money.New(4000), res.AttendanceAmount)
+		assert.Equal(t, money.New(500), res.OvertimeAmount)
+		assert.Equal(t, money.New(50), res.ReimbursementAmount)
+		assert.Equal(t, money.New(4550), res.TotalTakeHome)
+
+		assert.Len(t, res.Items, 3)
+		assert.Equal(t, payroll.Item{
+			Code: payroll.CodeAttendance, Label: "Salary for days attended", Kind: payroll.KindEarning,
+			Quantity: money.New(20), Rate: money.New(200), Amount: money.New(4000), Taxable: true,
+		}, res.Items[0])
+		assert.Equal(t, payroll.CodeOvertime, res.Items[1].Code)
+		assert.Equal(t, payroll.CodeReimbursement, res.Items[2].Code)
+		assert.False(t, res.Items[2].Taxable)
+		assert.Equal(t, money.New(4550), res.TotalEarnings)
+		assert.True(t, res.TotalDeductions.IsZero())
+		assert.Equal(t, money.New(4500), payroll.TaxableEarnings(res.Items))
+	})
+
+	t.Run("Full attendance earns the base salary", func(t *testing.T) {
+		res, err := calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 21, AttendanceDays: 21})
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(4200), res.TotalTakeHome)
+		assert.Len(t, res.Items, 1)
+	})
+
+	t.Run("Full attendance is exact when the daily rate is not", func(t *testing.T) {
+		res, err := calc.Calculate(payroll.Input{BaseSalary: money.New(10000000), WorkingDays: 22, AttendanceDays: 22})
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(10000000), res.AttendanceAmount)
+	})
+
+	t.Run("Amounts are rounded once to the minor unit", func(t *testing.T) {
+		res, err := calc.Calculate(payroll.Input{
+			BaseSalary:     money.New(10000000),
+			WorkingDays:    22,
+			AttendanceDays: 7,
+			OvertimeHours:  d("1.5"),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, d("3181818.18"), res.AttendanceAmount)
+		assert.Equal(t, d("170454.55"), res.OvertimeAmount)
+		assert.Equal(t, money.Sum(res.AttendanceAmount, res.OvertimeAmount), res.TotalTakeHome)
+		assert.NoError(t, payroll.CheckBalanced(res))
+	})
+
+	t.Run("Configured rounding", func(t *testing.T) {
+		c := payroll.NewCalculator()
+		c.Rounding = money.Rounding{Mode: money.Down, MinorUnit: money.New(100)}
+		res, err := c.Calculate(payroll.Input{BaseSalary: money.New(10000000), WorkingDays: 22, AttendanceDays: 7})
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(3181800), res.TotalTakeHome)
+	})
+
+	t.Run("Custom overtime multiplier", func(t *testing.T) {
+		c := payroll.NewCalculator()
+		c.Overtime.WeekdayMultiplier = d("1.5")
+		res, err := c.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 21, OvertimeHours: money.New(2)})
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(75), res.OvertimeAmount)
+	})
+
+	t.Run("Unbalanced result is detected", func(t *testing.T) {
+		res, err := calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 21, AttendanceDays: 20})
+		assert.NoError(t, err)
+		res.TotalTakeHome = res.TotalTakeHome.Add(d("0.01"))
+		assert.ErrorIs(t, payroll.CheckBalanced(res), payroll.ErrUnbalanced)
+	})
+
+	t.Run("Period without working days", func(t *testing.T) {
+		_, err := calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 0, AttendanceDays: 1})
+		assert.ErrorIs(t, err, payroll.ErrNoWorkingDays)
+	})
+
+	t.Run("More attendance than working days", func(t *testing.T) {
+		_, err := calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 21, AttendanceDays: 22})
+		assert.ErrorIs(t, err, payroll.ErrInvalidInput)
+	})
+
+	t.Run("Negative input", func(t *testing.T) {
+		_, err := calc.Calculate(payroll.Input{BaseSalary: money.New(4200), WorkingDays: 21, OvertimeHours: money.New(-1)})
+		assert.ErrorIs(t, err, payroll.ErrInvalidInput)
+	})
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculatorContributions(t *testing.T) {
+	d := money.MustParse
+	input := payroll.Input{
+		BaseSalary:     money.New(15000000),
+		WorkingDays:    20,
+		AttendanceDays: 20,
+	}
+
+	t.Run("Shares are capped per program", func(t *testing.T) {
+		calc := payroll.NewCalculator()
+		calc.Contributions = payroll.DefaultContributions()
+
+		res, err := calc.Calculate(input)
+		assert.NoError(t, err)
+		assert.Len(t, res.Contributions, 5)
+
+		health := res.Contributions[0]
+		assert.Equal(t, "BPJS_KES", health.Code)
+		assert.Equal(t, money.New(12000000), health.Base)
+		assert.Equal(t, money.New(120000), health.EmployeeAmount)
+		assert.Equal(t, money.New(480000), health.EmployerAmount)
+
+		pension := res.Contributions[2]
+		assert.Equal(t, d("10042300"), pension.Base)
+		assert.Equal(t, d("100423"), pension.EmployeeAmount)
+
+		assert.Equal(t, d("520423"), res.EmployeeContributions)
+		assert.Equal(t, d("1316846"), res.EmployerContributions)
+		assert.Equal(t, d("14479577"), res.TotalTakeHome)
+		assert.NoError(t, payroll.CheckBalanced(res))
+
+		//employer-only programs are not deducted from the pay
+		var deducted []string
+		for _, item := range res.Items {
+			if item.Kind == payroll.KindDeduction {
+				deducted = append(deducted, item.Code)
+			}
+		}
+		assert.Equal(t, []string{"BPJS_KES", "BPJS_JHT", "BPJS_JP"}, deducted)
+	})
+
+	t.Run("Prorated salary is contributed on", func(t *testing.T) {
+		calc := payroll.NewCalculator()
+		calc.Contributions = payroll.DefaultContributions()
+
+		//one day attended out of twenty earns 750,000, far less than the shares of the full month
+		res, err := calc.Calculate(payroll.Input{BaseSalary: money.New(15000000), WorkingDays: 20, AttendanceDays: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(750000), res.Contributions[0].Base)
+		assert.Equal(t, money.New(30000), res.EmployeeContributions)
+		assert.Equal(t, money.New(720000), res.TotalTakeHome)
+		assert.NoError(t, payroll.CheckBalanced(res))
+	})
+
+	t.Run("Contributions change the tax base", func(t *testing.T) {
+		rules := payroll.DefaultTaxRules()
+		calc := payroll.NewCalculator()
+		calc.Contributions = payroll.DefaultContributions()
+		calc.Tax = &rules
+
+		res, err := calc.Calculate(input)
+		assert.NoError(t, err)
+		//taxable employer shares of health, JKK and JKM are added, JHT and JP employee shares are deducted
+		assert.Equal(t, d("186732000"), res.Tax.AnnualGross)
+		assert.Equal(t, d("4805076"), res.Tax.Contributions)
+		assert.Equal(t, d("121926000"), res.Tax.AnnualTaxable)
+		assert.Equal(t, d("1024075"), res.TaxAmount)
+		assert.Equal(t, d("13455502"), res.TotalTakeHome)
+		assert.NoError(t, payroll.CheckBalanced(res))
+	})
+}
+
+func TestLoadContributions(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	assert.NoError(t, os.WriteFile(valid, []byte(`[
+		{"code": "HEALTH", "label": "Health", "employee_rate": "0.01", "employer_rate": "0.04", "salary_cap": 12000000},
+		{"code": "PENSION", "label": "Pension", "employee_rate": 0.02, "employer_rate": 0.03, "employee_share_deductible": true}
+	]`), 0o600))
+	contributions, err := payroll.LoadContributions(valid)
+	assert.NoError(t, err)
+	assert.Len(t, contributions, 2)
+	assert.True(t, contributions[1].EmployeeShareDeductible)
+
+	duplicate := filepath.Join(dir, "duplicate.json")
+	assert.NoError(t, os.WriteFile(duplicate, []byte(`[{"code": "A", "employee_rate": 0.01}, {"code": "A", "employee_rate": 0.02}]`), 0o600))
+	_, err = payroll.LoadContributions(duplicate)
+	assert.ErrorIs(t, err, payroll.ErrInvalidContributions)
+
+	rate := filepath.Join(dir, "rate.json")
+	assert.NoError(t, os.WriteFile(rate, []byte(`[{"code": "A", "employer_rate": 1.5}]`), 0o600))
+	_, err = payroll.LoadContributions(rate)
+	assert.ErrorIs(t, err, payroll.ErrInvalidContributions)
+}
+
+func TestRunPayrollStoresContributions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	config.Contributions = []payroll.Contribution{{
+		Code: "BPJS_JHT", Label: "Old age savings (JHT)",
+		EmployeeRate: money.MustParse("0.02"), EmployerRate: money.MustParse("0.037"),
+	}}
+	defer func() { config.Contributions = nil }()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WithArgs("06-2025").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+		WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+			AddRow("u1", 4200.0, 21, 0.0, 0.0, 0.0, 0.0, false, 0, nil, nil))
+	expectNoEarnings(mock)
+	expectNoLoans(mock)
+	expectNoOvertimePolicies(mock)
+	mock.ExpectExec(`INSERT INTO payslips`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "06-2025", "4200", "4200", 21, 21, "0", "0", "0", "0", nil, "84", "155.4", "4200", "84", "4116", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "21", "200", "4200", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).
+		WithArgs(sqlmock.AnyArg(), 2, "BPJS_JHT", "Old age savings (JHT)", "deduction", "4200", "0.02", "84", false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_contributions`).
+		WithArgs(sqlmock.AnyArg(), "BPJS_JHT", "Old age savings (JHT)", "4200", "84", "155.4").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaxWithholding(t *testing.T) {
+	rules := payroll.DefaultTaxRules()
+	rounding := money.DefaultRounding
+	d := money.MustParse
+
+	t.Run("Single without dependents", func(t *testing.T) {
+		b := rules.Withholding(money.New(10000000), money.Zero, money.Zero, payroll.TaxProfile{}, rounding)
+		assert.Equal(t, "TK/0", b.Status)
+		assert.Equal(t, money.New(120000000), b.AnnualGross)
+		assert.Equal(t, money.New(6000000), b.OccupationalCost)
+		assert.Equal(t, money.New(54000000), b.Allowance)
+		assert.Equal(t, money.New(60000000), b.AnnualTaxable)
+		assert.Equal(t, money.New(3000000), b.AnnualTax)
+		assert.Equal(t, money.New(250000), b.PeriodTax)
+	})
+
+	t.Run("Married with dependents", func(t *testing.T) {
+		b := rules.Withholding(money.New(10000000), money.Zero, money.Zero, payroll.TaxProfile{Married: true, Dependents: 2}, rounding)
+		assert.Equal(t, "K/2", b.Status)
+		assert.Equal(t, d("67500000"), b.Allowance)
+		assert.Equal(t, d("46500000"), b.AnnualTaxable)
+		assert.Equal(t, d("193750"), b.PeriodTax)
+	})
+
+	t.Run("Dependents are capped", func(t *testing.T) {
+		b := rules.Withholding(money.New(10000000), money.Zero, money.Zero, payroll.TaxProfile{Married: true, Dependents: 5}, rounding)
+		assert.Equal(t, "K/3", b.Status)
+		assert.Equal(t, money.New(72000000), b.Allowance)
+	})
+
+	t.Run("Income below the allowance is not taxed", func(t *testing.T) {
+		b := rules.Withholding(money.New(4000000), money.Zero, money.Zero, payroll.TaxProfile{}, rounding)
+		assert.True(t, b.AnnualTaxable.IsZero())
+		assert.True(t, b.PeriodTax.IsZero())
+	})
+
+	t.Run("Progressive brackets", func(t *testing.T) {
+		b := rules.Withholding(money.New(30000000), money.Zero, money.Zero, payroll.TaxProfile{}, rounding)
+		assert.Equal(t, money.New(300000000), b.AnnualTaxable)
+		assert.Equal(t, money.New(44000000), b.AnnualTax)
+		assert.Equal(t, d("3666666.67"), b.PeriodTax)
+	})
+
+	t.Run("Taxable income is rounded down to a thousand", func(t *testing.T) {
+		b := rules.Withholding(d("10000100"), money.Zero, money.Zero, payroll.TaxProfile{}, rounding)
+		assert.Equal(t, money.New(60001000), b.AnnualTaxable)
+	})
+}
+
+func TestCalculatorWithholdsTax(t *testing.T) {
+	rules := payroll.DefaultTaxRules()
+	calc := payroll.NewCalculator()
+	calc.Tax = &rules
+
+	res, err := calc.Calculate(payroll.Input{
+		BaseSalary:     money.New(10000000),
+		WorkingDays:    20,
+		AttendanceDays: 20,
+		Reimbursements: money.New(500000), //not taxable
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(250000), res.TaxAmount)
+	assert.Equal(t, money.New(10250000), res.TotalTakeHome)
+	assert.NoError(t, payroll.CheckBalanced(res))
+
+	last := res.Items[len(res.Items)-1]
+	assert.Equal(t, payroll.CodeIncomeTax, last.Code)
+	assert.Equal(t, payroll.KindDeduction, last.Kind)
+	assert.Equal(t, money.New(250000), last.Amount)
+}
+
+func TestCalculatorTaxesBonusOnce(t *testing.T) {
+	rules := payroll.DefaultTaxRules()
+	rounding := money.DefaultRounding
+	calc := payroll.NewCalculator()
+	calc.Tax = &rules
+
+	res, err := calc.Calculate(payroll.Input{
+		BaseSalary:     money.New(10000000),
+		WorkingDays:    20,
+		AttendanceDays: 20,
+		Bonuses:        []payroll.Earning{{Label: "Year-end bonus", Amount: money.New(50000000), Taxable: true}},
+	})
+	assert.NoError(t, err)
+
+	//the bonus adds AnnualTax(regular×12 + bonus) − AnnualTax(regular×12) to the period, it is not annualized
+	regular := rules.AnnualTax(money.New(60000000), rounding)    // 120M - 6M occupational cost - 54M PTKP
+	withBonus := rules.AnnualTax(money.New(110000000), rounding) // 170M - 6M - 54M
+	expected := rounding.MulDiv(regular, money.New(1), money.New(12)).Add(withBonus.Sub(regular))
+	assert.Equal(t, expected, res.TaxAmount)
+	assert.Equal(t, money.New(7750000), res.TaxAmount)
+	assert.Equal(t, money.New(50000000), res.Tax.IrregularIncome)
+	assert.Equal(t, money.New(7500000), res.Tax.IrregularTax)
+	assert.NoError(t, payroll.CheckBalanced(res))
+
+	//without the bonus the regular withholding is unchanged
+	res, err = calc.Calculate(payroll.Input{BaseSalary: money.New(10000000), WorkingDays: 20, AttendanceDays: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(250000), res.TaxAmount)
+	assert.True(t, res.Tax.IrregularTax.IsZero())
+}
+
+func TestLoadTaxRules(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	assert.NoError(t, os.WriteFile(valid, []byte(`{
+		"brackets": [{"up_to": "50000000", "rate": "0.05"}, {"rate": "0.1"}],
+		"personal_allowance": 54000000,
+		"married_allowance": 4500000,
+		"dependent_allowance": 4500000,
+		"max_dependents": 3,
+		"occupational_cost_rate": 0.05,
+		"occupational_cost_cap": 6000000,
+		"periods_per_year": 12,
+		"taxable_rounding": 1000
+	}`), 0o600))
+	rules, err := payroll.LoadTaxRules(valid)
+	assert.NoError(t, err)
+	assert.Len(t, rules.Brackets, 2)
+
+	unordered := filepath.Join(dir, "unordered.json")
+	assert.NoError(t, os.WriteFile(unordered, []byte(`{
+		"brackets": [{"up_to": 50000000, "rate": 0.05}, {"up_to": 10000000, "rate": 0.1}, {"rate": 0.2}],
+		"periods_per_year": 12
+	}`), 0o600))
+	_, err = payroll.LoadTaxRules(unordered)
+	assert.ErrorIs(t, err, payroll.ErrInvalidTaxRules)
+
+	_, err = payroll.LoadTaxRules(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
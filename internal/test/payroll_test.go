@@ -14,6 +14,57 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const payrollAdminID = "22222222-2222-2222-2222-222222222222"
+
+// payrollInputColumns are the columns of the per-employee inputs query of a payroll run
+var payrollInputColumns = []string{"id", "base_salary", "attendance_days", "overtime_hours", "rest_day_overtime_hours", "holiday_overtime_hours",
+	"reimbursement_amount", "married", "dependents", "hired_on", "terminated_on"}
+
+// expectEarnings expects the allowances and bonuses lookup of a payroll run
+func expectEarnings(mock sqlmock.Sqlmock, allowances, bonuses *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT DISTINCT ON \(u.id, a.code\) u.id, a.code, a.label, a.amount, a.taxable FROM allowances a`).
+		WillReturnRows(allowances)
+	mock.ExpectQuery(`SELECT user_id, label, amount, taxable FROM bonuses WHERE attendance_periods_id = \$1`).
+		WillReturnRows(bonuses)
+}
+
+// expectLoans expects the loan installments lookup of a payroll run
+func expectLoans(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT l.id, l.user_id, l.description, LEAST\(l.installment_amount`).WillReturnRows(rows)
+}
+
+// expectNoLoans expects a payroll run without loan installments due
+func expectNoLoans(mock sqlmock.Sqlmock) {
+	expectLoans(mock, sqlmock.NewRows([]string{"id", "user_id", "description", "installment"}))
+}
+
+// expectOvertimePolicies expects the lookup of the overtime policies of the employees' levels
+func expectOvertimePolicies(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT u.id, op.daily_cap, .* FROM overtime_policies op JOIN users u ON u.level_id = op.level_id`).WillReturnRows(rows)
+}
+
+// expectNoOvertimePolicies expects a payroll run where every level uses the company overtime policy
+func expectNoOvertimePolicies(mock sqlmock.Sqlmock) {
+	expectOvertimePolicies(mock, sqlmock.NewRows(append([]string{"user_id"}, overtimePolicyColumns...)))
+}
+
+// expectHolidays expects the holidays lookup of a period
+func expectHolidays(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT date, name FROM holidays WHERE date BETWEEN \$1 AND \$2`).WillReturnRows(rows)
+}
+
+// expectNoHolidays expects a period without holidays
+func expectNoHolidays(mock sqlmock.Sqlmock) {
+	expectHolidays(mock, sqlmock.NewRows([]string{"date", "name"}))
+}
+
+// expectNoEarnings expects a payroll run without allowances or bonuses
+func expectNoEarnings(mock sqlmock.Sqlmock) {
+	expectEarnings(mock,
+		sqlmock.NewRows([]string{"user_id", "code", "label", "amount", "taxable"}),
+		sqlmock.NewRows([]string{"user_id", "label", "amount", "taxable"}))
+}
+
 func TestRunPayroll(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -25,33 +76,225 @@ func TestRunPayroll(t *testing.T) {
 
 	// Inject mock user_id middleware
 	router.POST("/run-payroll", func(c *gin.Context) {
-		c.Set("user_id", "admin-user") // simulate admin user
+		c.Set("user_id", payrollAdminID) // simulate admin user
 		handlers.RunPayroll(db)(c)
 	})
 
-	// Step 1: Mock attendance_periods lookup
+	runPayroll := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+		req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	expectPeriod := func() {
+		mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+			WithArgs("06-2025").
+			WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+				AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+		expectNoHolidays(mock)
+	}
+	expectRun := func(rows *sqlmock.Rows) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+			WithArgs("06-2025").
+			WillReturnRows(rows)
+	}
+	// June 2025 has 21 working days, so the calculated amounts come out round
+	expectPayslips := func(runID interface{}) {
+		mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+			WithArgs("06-2025", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+				AddRow("u1", 4200.0, 20, 10.0, 0.0, 0.0, 50.0, false, 0, nil, nil))
+		expectNoEarnings(mock)
+		expectNoLoans(mock)
+		expectNoOvertimePolicies(mock)
+		mock.ExpectExec(`INSERT INTO payslips`).
+			WithArgs(sqlmock.AnyArg(), runID, "u1", "06-2025", "4200", "4000", 20, 21, "500", "10", "50", "0", nil, "0", "0", "4550", "0", "4550", payrollAdminID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO payslip_items`).
+			WithArgs(sqlmock.AnyArg(), 1, "ATTENDANCE", "Salary for days attended", "earning", "20", "200", "4000", true).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO payslip_items`).
+			WithArgs(sqlmock.AnyArg(), 2, "OVERTIME", "Overtime", "earning", "10", "50", "500", true).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO payslip_items`).
+			WithArgs(sqlmock.AnyArg(), 3, "REIMBURSEMENT", "Reimbursements", "earning", "1", "50", "50", false).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("payroll_runs", sqlmock.AnyArg(), "RUN", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	t.Run("First run creates a draft", func(t *testing.T) {
+		expectPeriod()
+		expectRun(sqlmock.NewRows([]string{"id", "status"}))
+		mock.ExpectExec(`INSERT INTO payroll_runs`).
+			WithArgs(sqlmock.AnyArg(), "06-2025", "draft", payrollAdminID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectPayslips(sqlmock.AnyArg())
+
+		w := runPayroll()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Payroll processed successfully")
+		assert.Contains(t, w.Body.String(), `"status":"draft"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Re-running a draft replaces its payslips", func(t *testing.T) {
+		expectPeriod()
+		expectRun(sqlmock.NewRows([]string{"id", "status"}).AddRow("run1", "draft"))
+		mock.ExpectExec(`DELETE FROM payslips WHERE payroll_run_id = \$1`).
+			WithArgs("run1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE payroll_runs SET run_count = run_count \+ 1`).
+			WithArgs("run1", payrollAdminID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectPayslips("run1")
+
+		w := runPayroll()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"run_id":"run1"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid input names the employee", func(t *testing.T) {
+		expectPeriod()
+		expectRun(sqlmock.NewRows([]string{"id", "status"}).AddRow("run1", "draft"))
+		mock.ExpectExec(`DELETE FROM payslips WHERE payroll_run_id = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE payroll_runs SET run_count = run_count \+ 1`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT u.id, s.base_salary`).
+			WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+				AddRow("u1", 4200.0, 22, 0.0, 0.0, 0.0, 0.0, false, 0, nil, nil))
+		expectNoEarnings(mock)
+		expectNoLoans(mock)
+		expectNoOvertimePolicies(mock)
+		mock.ExpectRollback()
+
+		w := runPayroll()
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"user_id":"u1"`)
+		assert.Contains(t, w.Body.String(), "22 attendance days exceed the 21 working days")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Finalized run is immutable", func(t *testing.T) {
+		expectPeriod()
+		expectRun(sqlmock.NewRows([]string{"id", "status"}).AddRow("run1", "finalized"))
+		mock.ExpectRollback()
+
+		w := runPayroll()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "finalized")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRunPayrollSkipsAttendanceOnLaterHolidays(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	//2 June was declared a holiday after the employee had clocked in on every weekday of June,
+	//which leaves 20 working days; the attendance of that day must not be counted
 	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
 		WithArgs("06-2025").
 		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
 			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
-
-	// Step 2: Mock INSERT INTO payslips
+	expectHolidays(mock, sqlmock.NewRows([]string{"date", "name"}).AddRow(time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), "Company holiday"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, s.base_salary.* AND EXTRACT\(ISODOW FROM at.date\) < 6 AND NOT EXISTS \(SELECT 1 FROM holidays h WHERE h.date = at.date\) GROUP BY at.user_id`).
+		WithArgs("06-2025", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(payrollInputColumns).
+			AddRow("u1", 4000.0, 20, 0.0, 0.0, 0.0, 0.0, false, 0, nil, nil))
+	expectNoEarnings(mock)
+	expectNoLoans(mock)
+	expectNoOvertimePolicies(mock)
 	mock.ExpectExec(`INSERT INTO payslips`).
-		WithArgs("06-2025", sqlmock.AnyArg(), "admin-user", sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1)) // pretend one row inserted
-
-	// Step 3: Prepare request
-	payload := map[string]string{
-		"period_id": "06-2025",
-	}
-	body, _ := json.Marshal(payload)
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "06-2025", "4000", "4000", 20, 20, "0", "0", "0", "0", nil, "0", "0", "4000", "0", "4000", payrollAdminID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO payslip_items`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
 
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
 	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Payroll processed successfully")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFinalizePayrollRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	runID := "66666666-6666-6666-6666-666666666666"
+	finalize := func() *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.FinalizePayrollRun(db), http.MethodPost, "/admin/payroll-runs/:run_id/finalize", "finance")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/payroll-runs/"+runID+"/finalize", nil))
+		return w
+	}
+
+	t.Run("Draft is finalized", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE payroll_runs SET status = \$2`).
+			WithArgs(sqlmock.AnyArg(), "finalized", sqlmock.AnyArg(), sqlmock.AnyArg(), "draft").
+			WillReturnRows(sqlmock.NewRows([]string{"attendance_periods_id"}).AddRow("06-2025"))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("payroll_runs", runID, "FINALIZE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := finalize()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Already finalized", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE payroll_runs SET status = \$2`).
+			WillReturnRows(sqlmock.NewRows([]string{"attendance_periods_id"}))
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM payroll_runs WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		w := finalize()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown run", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE payroll_runs SET status = \$2`).
+			WillReturnRows(sqlmock.NewRows([]string{"attendance_periods_id"}))
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM payroll_runs WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		w := finalize()
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var periodLockColumns = []string{"id", "status", "run_status", "overridden"}
+
+const periodLockQuery = `SELECT ap.id, ap.status, r.status,`
+
+// expectPeriodOpen expects the period lock lookup for a date that belongs to no period
+func expectPeriodOpen(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(periodLockQuery).WillReturnRows(sqlmock.NewRows(periodLockColumns))
+}
+
+func TestSubmissionsInLockedPeriods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	employeeID := "11111111-1111-1111-1111-111111111111"
+	router := gin.New()
+	withUser := func(h gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", employeeID)
+			h(c)
+		}
+	}
+	router.POST("/overtime", withUser(handlers.SubmitOvertime(db)))
+	router.POST("/reimbursement", withUser(handlers.SubmitReimbursement(db)))
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Closed period rejects overtime", func(t *testing.T) {
+		mock.ExpectQuery(periodLockQuery).
+			WithArgs(time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(periodLockColumns).AddRow("06-2025", "closed", nil, false))
+
+		w := post("/overtime", `{"date":"2025-06-02","hours":2}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "Period 06-2025 is closed")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Processed period rejects reimbursements", func(t *testing.T) {
+		mock.ExpectQuery(periodLockQuery).
+			WillReturnRows(sqlmock.NewRows(periodLockColumns).AddRow("06-2025", "open", "draft", false))
+
+		w := post("/reimbursement", `{"category":"internet","amount":50,"date":"2025-06-02"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "Payroll has been processed")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Override allows corrections", func(t *testing.T) {
+		mock.ExpectQuery(periodLockQuery).
+			WillReturnRows(sqlmock.NewRows(periodLockColumns).AddRow("06-2025", "closed", "draft", true))
+		expectReimbursementCategory(mock, "internet", nil, nil, "flag")
+		expectClaimedReimbursements(mock, 0)
+		mock.ExpectExec(`INSERT INTO reimbursements`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post("/reimbursement", `{"category":"internet","amount":50,"date":"2025-06-02"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Override does not reopen finalized payroll", func(t *testing.T) {
+		mock.ExpectQuery(periodLockQuery).
+			WillReturnRows(sqlmock.NewRows(periodLockColumns).AddRow("06-2025", "closed", "finalized", true))
+
+		w := post("/overtime", `{"date":"2025-06-02","hours":2}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "finalized")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCloseAttendancePeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.CloseAttendancePeriod(db), http.MethodPost, "/admin/attendance-periods/:period_id/close", "hr")
+
+	mock.ExpectExec(`UPDATE attendance_periods`).
+		WithArgs("06-2025", "closed", sqlmock.AnyArg(), sqlmock.AnyArg(), "open").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("attendance_period", "06-2025", "CLOSE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/attendance-periods/06-2025/close", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mock.ExpectExec(`UPDATE attendance_periods`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/attendance-periods/06-2025/close", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePeriodOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.PeriodOverrideTTL = 24 * time.Hour
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.CreatePeriodOverride(db), http.MethodPost, "/admin/attendance-periods/:period_id/overrides", "admin")
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/attendance-periods/06-2025/overrides", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM attendance_periods WHERE id = \$1\)`).
+			WithArgs("06-2025").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`INSERT INTO period_overrides`).
+			WithArgs(sqlmock.AnyArg(), "06-2025", sqlmock.AnyArg(), "Late sick leave note", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("period_overrides", sqlmock.AnyArg(), "OVERRIDE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"user_id":"11111111-1111-1111-1111-111111111111","reason":"Late sick leave note"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reason is required", func(t *testing.T) {
+		w := post(`{"user_id":"11111111-1111-1111-1111-111111111111"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unknown period", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM attendance_periods WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		w := post(`{"reason":"Fix imports"}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
+	"github.com/chafid/payroll-project/internal/payroll"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReimbursementLimitsApply(t *testing.T) {
+	perClaim, perPeriod := money.New(500), money.New(1000)
+	limits := payroll.ReimbursementLimits{PerClaim: &perClaim, PerPeriod: &perPeriod, OverLimit: payroll.OverLimitCap}
+	assert.NoError(t, limits.Validate())
+
+	for _, tc := range []struct {
+		name            string
+		claimed, used   money.Decimal
+		amount          money.Decimal
+		overLimit       bool
+		limitsExhausted bool
+	}{
+		{"Within the limits", money.New(400), money.New(600), money.New(400), false, false},
+		{"Over the claim limit", money.New(700), money.Zero, money.New(500), true, false},
+		{"Over what is left of the month", money.New(400), money.New(800), money.New(200), true, false},
+		{"Month used up", money.New(100), money.New(1000), money.Zero, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, overLimit, err := limits.Apply(tc.claimed, tc.used)
+			if tc.limitsExhausted {
+				assert.ErrorIs(t, err, payroll.ErrReimbursementLimit)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.amount.Equal(amount), "amount %s", amount)
+			assert.Equal(t, tc.overLimit, overLimit)
+		})
+	}
+
+	//a flagging category keeps the claimed amount
+	limits.OverLimit = payroll.OverLimitFlag
+	amount, overLimit, err := limits.Apply(money.New(700), money.New(800))
+	assert.NoError(t, err)
+	assert.True(t, money.New(700).Equal(amount))
+	assert.True(t, overLimit)
+
+	perPeriod = money.New(300)
+	assert.ErrorIs(t, limits.Validate(), payroll.ErrInvalidReimbursementLimits)
+	limits = payroll.ReimbursementLimits{OverLimit: "ignore"}
+	assert.ErrorIs(t, limits.Validate(), payroll.ErrInvalidReimbursementLimits)
+}
+
+func TestCreateReimbursementCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.CreateReimbursementCategory(db), http.MethodPost, "/admin/reimbursement-categories", "finance")
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reimbursement-categories", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Defaults to flagging", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO reimbursement_categories`).
+			WithArgs("internet", "Internet", "300", nil, "flag", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("reimbursement_categories", "internet", "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"code":"internet","name":"Internet","per_claim_limit":300}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"per_period_limit":null,"over_limit_action":"flag","active":true`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid code", func(t *testing.T) {
+		w := post(`{"code":"Internet Bill","name":"Internet"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid limits", func(t *testing.T) {
+		w := post(`{"code":"medical","name":"Medical","per_claim_limit":500,"per_period_limit":100,"over_limit_action":"cap"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "per_period_limit must not be lower than per_claim_limit")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUpdateReimbursementCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.UpdateReimbursementCategory(db), http.MethodPut, "/admin/reimbursement-categories/:code", "admin")
+	put := func(code, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/reimbursement-categories/"+code, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Deactivate", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE reimbursement_categories SET name = \$2`).
+			WithArgs("gym", "Gym", nil, nil, "flag", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := put("gym", `{"name":"Gym","active":false}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"active":false`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown category", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE reimbursement_categories`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		w := put("unknown", `{"name":"Unknown"}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListActiveReimbursementCategories(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.GET("/reimbursement-categories", handlers.ListActiveReimbursementCategories(db))
+	mock.ExpectQuery(`FROM reimbursement_categories WHERE is_active ORDER BY name`).
+		WillReturnRows(sqlmock.NewRows(reimbursementCategoryColumns).
+			AddRow("medical", "Medical", nil, 5000000.0, "cap", true))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reimbursement-categories", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"per_claim_limit":null,"per_period_limit":5000000,"over_limit_action":"cap"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
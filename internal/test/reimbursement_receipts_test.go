@@ -0,0 +1,270 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	receiptReimbursementID = "55555555-5555-5555-5555-555555555555"
+	receiptID              = "66666666-6666-6666-6666-666666666666"
+	receiptOwnerID         = "11111111-1111-1111-1111-111111111111"
+)
+
+// pngReceipt is enough of a PNG file for content type detection
+var pngReceipt = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+// receiptUpload builds a multipart form with a file per name in the files field
+func receiptUpload(t *testing.T, files map[string][]byte) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := form.CreateFormFile("files", name)
+		assert.NoError(t, err)
+		_, err = part.Write(content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, form.Close())
+	return body, form.FormDataContentType()
+}
+
+// newReceiptRouter routes to h as the given user and role
+func newReceiptRouter(h gin.HandlerFunc, method, path, userID, role string) *gin.Engine {
+	router := gin.New()
+	router.Handle(method, path, func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", role)
+		h(c)
+	})
+	return router
+}
+
+func expectReceiptOwner(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectQuery(`SELECT user_id, status FROM reimbursements WHERE id = \$1`).
+		WithArgs(receiptReimbursementID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(receiptOwnerID, status))
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("receipt-1", bytes.NewReader([]byte("content"))))
+	file, err := store.Open("receipt-1")
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, "content", string(content))
+
+	assert.NoError(t, store.Delete("receipt-1"))
+	_, err = store.Open("receipt-1")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, store.Delete("receipt-1"))
+
+	//keys can't leave the store directory
+	assert.ErrorIs(t, store.Put("../receipt", bytes.NewReader(nil)), storage.ErrInvalidKey)
+	_, err = store.Open("..")
+	assert.ErrorIs(t, err, storage.ErrInvalidKey)
+}
+
+func TestUploadReceipts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir)
+	assert.NoError(t, err)
+
+	path := "/employee/reimbursement/:reimbursement_id/receipts"
+	upload := func(userID string, files map[string][]byte) *httptest.ResponseRecorder {
+		router := newReceiptRouter(handlers.UploadReceipts(db, store), http.MethodPost, path, userID, "employee")
+		body, contentType := receiptUpload(t, files)
+		req := httptest.NewRequest(http.MethodPost, "/employee/reimbursement/"+receiptReimbursementID+"/receipts", body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Stores the file with its checksum", func(t *testing.T) {
+		sum := sha256.Sum256(pngReceipt)
+		expectReceiptOwner(mock, "pending")
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO reimbursement_receipts`).
+			WithArgs(sqlmock.AnyArg(), receiptReimbursementID, "taxi.png", "image/png", int64(len(pngReceipt)), hex.EncodeToString(sum[:]),
+				receiptOwnerID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := upload(receiptOwnerID, map[string][]byte{`C:\Users\me\taxi.png`: pngReceipt})
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"sha256":"`+hex.EncodeToString(sum[:])+`"`)
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unsupported type", func(t *testing.T) {
+		w := upload(receiptOwnerID, map[string][]byte{"notes.txt": []byte("not a receipt")})
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		maxSize := config.ReceiptMaxSize
+		config.ReceiptMaxSize = 16
+		defer func() { config.ReceiptMaxSize = maxSize }()
+
+		w := upload(receiptOwnerID, map[string][]byte{"taxi.png": pngReceipt})
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Someone else's reimbursement", func(t *testing.T) {
+		expectReceiptOwner(mock, "pending")
+
+		w := upload(payrollAdminID, map[string][]byte{"taxi.png": pngReceipt})
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reviewed reimbursement", func(t *testing.T) {
+		expectReceiptOwner(mock, "approved")
+
+		w := upload(receiptOwnerID, map[string][]byte{"taxi.png": pngReceipt})
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Failed insert removes the stored file", func(t *testing.T) {
+		before, _ := os.ReadDir(dir)
+		expectReceiptOwner(mock, "pending")
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO reimbursement_receipts`).WillReturnError(io.ErrUnexpectedEOF)
+		mock.ExpectRollback()
+
+		w := upload(receiptOwnerID, map[string][]byte{"taxi.png": pngReceipt})
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		after, _ := os.ReadDir(dir)
+		assert.Len(t, after, len(before))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDownloadReceipt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, receiptID), pngReceipt, 0o600))
+
+	path := "/reimbursements/:reimbursement_id/receipts/:receipt_id"
+	download := func(userID, role string) *httptest.ResponseRecorder {
+		router := newReceiptRouter(handlers.DownloadReceipt(db, store), http.MethodGet, path, userID, role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reimbursements/"+receiptReimbursementID+"/receipts/"+receiptID, nil))
+		return w
+	}
+	expectReceipt := func() {
+		mock.ExpectQuery(`FROM reimbursement_receipts rr JOIN reimbursements r ON r.id = rr.reimbursement_id WHERE rr.id = \$1 AND rr.reimbursement_id = \$2`).
+			WithArgs(receiptID, receiptReimbursementID).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "file_name", "content_type", "size", "sha256", "storage_key"}).
+				AddRow(receiptOwnerID, "taxi.png", "image/png", len(pngReceipt), "abc123", receiptID))
+	}
+
+	t.Run("Owner", func(t *testing.T) {
+		expectReceipt()
+
+		w := download(receiptOwnerID, "employee")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, pngReceipt, w.Body.Bytes())
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=taxi.png`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "abc123", w.Header().Get("X-Checksum-SHA256"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Approver", func(t *testing.T) {
+		expectReceipt()
+
+		w := download(payrollAdminID, "finance")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Another employee", func(t *testing.T) {
+		expectReceipt()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("authorization", path, "DENY", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := download("33333333-3333-3333-3333-333333333333", "employee")
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Managers are not approvers", func(t *testing.T) {
+		expectReceipt()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := download("33333333-3333-3333-3333-333333333333", "manager")
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListReceipts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newReceiptRouter(handlers.ListReceipts(db), http.MethodGet, "/reimbursements/:reimbursement_id/receipts", payrollAdminID, "admin")
+	expectReceiptOwner(mock, "pending")
+	mock.ExpectQuery(`FROM reimbursement_receipts WHERE reimbursement_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reimbursement_id", "file_name", "content_type", "size", "sha256", "created_at"}).
+			AddRow(receiptID, receiptReimbursementID, "taxi.png", "image/png", 72, "abc123", time.Now()))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reimbursements/"+receiptReimbursementID+"/receipts", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"file_name":"taxi.png","content_type":"image/png","size":72,"sha256":"abc123"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,18 +2,47 @@ package test
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/money"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
+var reimbursementCategoryColumns = []string{"code", "name", "per_claim_limit", "per_period_limit", "over_limit_action", "is_active"}
+
+var reimbursementListColumns = []string{"id", "user_id", "username", "category_code", "date", "description", "claimed_amount", "amount",
+	"over_limit", "receipts", "status", "reviewed_by", "reviewed_at", "review_reason", "created_at"}
+
+// expectReimbursementCategory expects the lookup of an active category, nil limits are no limit
+func expectReimbursementCategory(mock sqlmock.Sqlmock, code string, perClaim, perPeriod interface{}, action string) {
+	mock.ExpectQuery(`FROM reimbursement_categories WHERE code = \$1`).
+		WithArgs(code).
+		WillReturnRows(sqlmock.NewRows(reimbursementCategoryColumns).AddRow(code, code, perClaim, perPeriod, action, true))
+}
+
+// expectClaimedReimbursements expects the transaction locking the claims of the user and the amount already
+// claimed in the category, over the calendar month of the claim as no attendance period contains it
+func expectClaimedReimbursements(mock sqlmock.Sqlmock, used float64) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).
+		WithArgs("11111111-1111-1111-1111-111111111111").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE \$1::date BETWEEN start_date AND end_date`).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(amount\), 0\) FROM reimbursements WHERE user_id = \$1 AND category_code = \$2 AND status <> 'rejected'`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(used))
+}
+
 func TestSubmitReimbursement(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -26,32 +55,256 @@ func TestSubmitReimbursement(t *testing.T) {
 		c.Set("user_id", "11111111-1111-1111-1111-111111111111")
 		handlers.SubmitReimbursement(db)(c)
 	})
+	submit := func(payload handlers.ReimbursementRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/reimbursement", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Within the limits", func(t *testing.T) {
+		payload := handlers.ReimbursementRequest{
+			Category:    "travel",
+			Amount:      money.MustParse("100.50"),
+			Description: "Taxi reimbursement",
+			Date:        time.Now().Format("2006-01-02"),
+		}
+
+		expectPeriodOpen(mock)
+		expectReimbursementCategory(mock, "travel", 500.0, nil, "flag")
+		expectClaimedReimbursements(mock, 0)
+		// Expect INSERT INTO reimbursements with 12 values
+		mock.ExpectExec(`INSERT INTO reimbursements`).
+			WithArgs(
+				sqlmock.AnyArg(), "11111111-1111-1111-1111-111111111111", // id, user_id
+				"travel", payload.Amount, payload.Amount, false, // category, claimed_amount, amount, over_limit
+				payload.Description, sqlmock.AnyArg(), // description, date
+				sqlmock.AnyArg(), sqlmock.AnyArg(), // created_by, updated_by
+				"127.0.0.1", "127.0.0.1", // created_ip, updated_ip
+			).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := submit(payload)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Reimbursement submitted successfully")
+		assert.Contains(t, w.Body.String(), `"status":"pending"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Flagged over the claim limit", func(t *testing.T) {
+		expectPeriodOpen(mock)
+		expectReimbursementCategory(mock, "travel", 500.0, nil, "flag")
+		expectClaimedReimbursements(mock, 0)
+		mock.ExpectExec(`INSERT INTO reimbursements`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "travel", "800", "800", true,
+				sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := submit(handlers.ReimbursementRequest{Category: "travel", Amount: money.New(800), Date: "2025-06-02"})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"over_limit":true`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Capped to what is left of the period", func(t *testing.T) {
+		expectPeriodOpen(mock)
+		expectReimbursementCategory(mock, "medical", nil, 1000.0, "cap")
+		expectClaimedReimbursements(mock, 700)
+		mock.ExpectExec(`INSERT INTO reimbursements`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "medical", "450", "300", true,
+				sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := submit(handlers.ReimbursementRequest{Category: "medical", Amount: money.New(450), Date: "2025-06-02"})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"amount":300,"category":"medical","claimed_amount":450`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 
-	payload := handlers.ReimbursementRequest{
-		Amount:      100.50,
-		Description: "Taxi reimbursement",
-		Date:        time.Now().Format("2006-01-02"),
+	t.Run("Period limit counts the claims of the attendance period", func(t *testing.T) {
+		start := time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+		end := time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+		expectPeriodOpen(mock)
+		expectReimbursementCategory(mock, "medical", nil, 1000.0, "cap")
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE \$1::date BETWEEN start_date AND end_date`).
+			WithArgs(time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).AddRow(start, end))
+		mock.ExpectQuery(`SELECT COALESCE\(SUM\(amount\), 0\) FROM reimbursements`).
+			WithArgs("11111111-1111-1111-1111-111111111111", "medical", start, end).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
+		mock.ExpectRollback()
+
+		w := submit(handlers.ReimbursementRequest{Category: "medical", Amount: money.New(50), Date: "2025-06-02"})
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Capped category with nothing left", func(t *testing.T) {
+		expectPeriodOpen(mock)
+		expectReimbursementCategory(mock, "medical", nil, 1000.0, "cap")
+		expectClaimedReimbursements(mock, 1000)
+		mock.ExpectRollback()
+
+		w := submit(handlers.ReimbursementRequest{Category: "medical", Amount: money.New(50), Date: "2025-06-02"})
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "period limit of 1000 is used up")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Inactive category", func(t *testing.T) {
+		expectPeriodOpen(mock)
+		mock.ExpectQuery(`FROM reimbursement_categories WHERE code = \$1`).
+			WillReturnRows(sqlmock.NewRows(reimbursementCategoryColumns).AddRow("gym", "Gym", nil, nil, "flag", false))
+
+		w := submit(handlers.ReimbursementRequest{Category: "gym", Amount: money.New(50), Date: "2025-06-02"})
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Unknown reimbursement category")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestReviewReimbursement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	reimbursementID := "55555555-5555-5555-5555-555555555555"
+	employeeID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.ReviewReimbursement(db), http.MethodPost, "/admin/reimbursements/:reimbursement_id/review", "finance")
+	review := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reimbursements/"+reimbursementID+"/review", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
 	}
-	body, _ := json.Marshal(payload)
-
-	// Expect INSERT INTO reimbursements with 9 values
-	mock.ExpectExec(`INSERT INTO reimbursements`).
-		WithArgs(
-			sqlmock.AnyArg(), "11111111-1111-1111-1111-111111111111", // id, user_id
-			payload.Amount, payload.Description, // amount, description
-			sqlmock.AnyArg(),                   // date
-			sqlmock.AnyArg(), sqlmock.AnyArg(), // created_by, updated_by
-			"127.0.0.1", "127.0.0.1", // created_ip, updated_ip
-		).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	req := httptest.NewRequest(http.MethodPost, "/reimbursement", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-	req.RemoteAddr = "127.0.0.1:1234"
+	expectReimbursement := func(userID, status string) {
+		mock.ExpectQuery(`SELECT user_id, date, status FROM reimbursements WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "date", "status"}).
+				AddRow(userID, time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC), status))
+	}
+
+	t.Run("Reject with a reason", func(t *testing.T) {
+		expectReimbursement(employeeID, "pending")
+		mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM attendance_periods ap JOIN payroll_runs r`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(`UPDATE reimbursements SET status = \$2, reviewed_by = \$3, reviewed_at = now\(\), review_reason = \$4`).
+			WithArgs(sqlmock.AnyArg(), "rejected", sqlmock.AnyArg(), "No receipt", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("reimbursements", reimbursementID, "REJECT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := review(`{"status":"rejected","reason":" No receipt "}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"rejected"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reject requires a reason", func(t *testing.T) {
+		w := review(`{"status":"rejected"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Own claim", func(t *testing.T) {
+		expectReimbursement(payrollAdminID, "pending")
+
+		w := review(`{"status":"approved"}`)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Finalized period", func(t *testing.T) {
+		expectReimbursement(employeeID, "pending")
+		mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM attendance_periods ap JOIN payroll_runs r`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		w := review(`{"status":"approved"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "finalized")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListReimbursements(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.ListReimbursements(db), http.MethodGet, "/admin/reimbursements", "finance")
+	mock.ExpectQuery(`FROM reimbursements r JOIN users u ON u.id = r.user_id WHERE r.category_code = \$1 AND r.status = \$2 ORDER BY r.date`).
+		WithArgs("travel", "pending").
+		WillReturnRows(sqlmock.NewRows(reimbursementListColumns).
+			AddRow("r1", "u1", "employee001", "travel", time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC), "Flight", 800.0, 800.0,
+				true, 1, "pending", nil, nil, nil, time.Now()))
 
 	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/reimbursements?category=travel", nil))
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Reimbursement submitted successfully")
+	assert.Contains(t, w.Body.String(), `"claimed_amount":800,"amount":800,"over_limit":true,"receipts":1,"status":"pending"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunPayrollPaysApprovedReimbursements(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := gin.Default()
+	router.POST("/run-payroll", func(c *gin.Context) {
+		c.Set("user_id", payrollAdminID)
+		handlers.RunPayroll(db)(c)
+	})
+
+	mock.ExpectQuery(`SELECT start_date, end_date FROM attendance_periods WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date"}).
+			AddRow(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+	expectNoHolidays(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status FROM payroll_runs WHERE attendance_periods_id = \$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectExec(`INSERT INTO payroll_runs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	//pending and rejected claims are left out of the reimbursement aggregate
+	mock.ExpectQuery(`FROM reimbursements WHERE status = 'approved' AND date BETWEEN \$2 AND \$3`).
+		WillReturnError(errors.New("stop after the inputs query"))
+	mock.ExpectRollback()
+
+	body, _ := json.Marshal(map[string]string{"period_id": "06-2025"})
+	req := httptest.NewRequest(http.MethodPost, "/run-payroll", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
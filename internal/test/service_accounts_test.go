@@ -0,0 +1,233 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/middlewares"
+	"github.com/chafid/payroll-project/internal/rbac"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const serviceAccountID = "44444444-4444-4444-4444-444444444444"
+
+func TestCreateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.CreateAPIKey(db), http.MethodPost, "/admin/service-accounts/:account_id/keys", "admin")
+		req := httptest.NewRequest(http.MethodPost, "/admin/service-accounts/"+serviceAccountID+"/keys", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$1 AND role = \$2\)`).
+			WithArgs(sqlmock.AnyArg(), "service").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`INSERT INTO api_keys`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "timeclock", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), true, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("api_keys", sqlmock.AnyArg(), "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"name":"timeclock","scopes":["attendance:import"],"require_signature":true}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"key":"pk_`)
+		assert.Contains(t, w.Body.String(), `"signing_secret":"pks_`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Scope outside the service scopes", func(t *testing.T) {
+		w := post(`{"name":"timeclock","scopes":["payroll:run"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid scope")
+	})
+
+	t.Run("Unknown service account", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$1 AND role = \$2\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		w := post(`{"name":"timeclock","scopes":["attendance:import"]}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.APIKeySignatureWindow = 5 * time.Minute
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	key, _, keyHash, err := utils.GenerateAPIKey()
+	assert.NoError(t, err)
+	signingSecret, err := utils.GenerateSigningSecret()
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(middlewares.AuthMiddleware(db))
+	router.POST("/admin/attendance/import", middlewares.Authorize(db, rbac.PermImportAttendance), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+	})
+	router.POST("/admin/run-payroll", middlewares.Authorize(db, rbac.PermRunPayroll), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	expectKey := func(requireSignature bool) {
+		mock.ExpectQuery(`SELECT k.id, k.service_account_id, k.signing_secret, k.scopes, k.require_signature`).
+			WithArgs(keyHash).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "service_account_id", "signing_secret", "scopes", "require_signature"}).
+				AddRow("key-1", serviceAccountID, signingSecret, "{attendance:import}", requireSignature))
+	}
+	expectSignature := func(sig string, firstUse bool) {
+		var affected int64
+		if firstUse {
+			affected = 1
+		}
+		mock.ExpectExec(`INSERT INTO api_key_signatures`).
+			WithArgs("key-1", sig, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, affected))
+	}
+	expectUsage := func() {
+		mock.ExpectExec(`UPDATE api_keys SET last_used_at = now\(\)`).
+			WithArgs("key-1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	send := func(path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "ApiKey "+key)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Unsigned key within its scopes", func(t *testing.T) {
+		expectKey(false)
+		expectUsage()
+
+		w := send("/admin/attendance/import", `{}`, nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), serviceAccountID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Key outside its scopes is denied", func(t *testing.T) {
+		expectKey(false)
+		expectUsage()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("authorization", "/admin/run-payroll", "DENY", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := send("/admin/run-payroll", `{}`, nil)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Signature required but missing", func(t *testing.T) {
+		expectKey(true)
+
+		w := send("/admin/attendance/import", `{}`, nil)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	body := `{"period_id":"06-2025"}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := utils.SignRequest(signingSecret, ts, http.MethodPost, "/admin/attendance/import", []byte(body))
+
+	t.Run("Valid signature", func(t *testing.T) {
+		expectKey(true)
+		expectSignature(sig, true)
+		expectUsage()
+
+		w := send("/admin/attendance/import", body, map[string]string{"X-Signature-Timestamp": ts, "X-Signature": sig})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Replayed signature within the window", func(t *testing.T) {
+		expectKey(true)
+		expectSignature(sig, false)
+
+		w := send("/admin/attendance/import", body, map[string]string{"X-Signature-Timestamp": ts, "X-Signature": sig})
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "already been used")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Signed with the key hash", func(t *testing.T) {
+		expectKey(true)
+
+		sig := utils.SignRequest(keyHash, ts, http.MethodPost, "/admin/attendance/import", []byte(body))
+		w := send("/admin/attendance/import", body, map[string]string{"X-Signature-Timestamp": ts, "X-Signature": sig})
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request signature")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Tampered body", func(t *testing.T) {
+		expectKey(true)
+
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		sig := utils.SignRequest(signingSecret, ts, http.MethodPost, "/admin/attendance/import", []byte(`{"period_id":"06-2025"}`))
+		w := send("/admin/attendance/import", `{"period_id":"07-2025"}`, map[string]string{"X-Signature-Timestamp": ts, "X-Signature": sig})
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request signature")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Replayed request outside the window", func(t *testing.T) {
+		expectKey(true)
+
+		body := `{}`
+		ts := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+		sig := utils.SignRequest(signingSecret, ts, http.MethodPost, "/admin/attendance/import", []byte(body))
+		w := send("/admin/attendance/import", body, map[string]string{"X-Signature-Timestamp": ts, "X-Signature": sig})
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "window")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Revoked key", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT k.id, k.service_account_id, k.signing_secret, k.scopes, k.require_signature`).
+			WithArgs(keyHash).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "service_account_id", "signing_secret", "scopes", "require_signature"}))
+
+		w := send("/admin/attendance/import", `{}`, nil)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/middlewares"
+	"github.com/chafid/payroll-project/internal/testutils"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var sessionColumns = []string{"id", "user_id", "ip_address", "user_agent", "created_at", "last_seen_at", "last_seen_ip", "expires_at", "revoked_at", "revoked_reason"}
+
+func TestListMySessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := "11111111-1111-1111-1111-111111111111"
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, user_id, ip_address, user_agent, created_at, last_seen_at, last_seen_ip, expires_at, revoked_at, revoked_reason FROM sessions WHERE user_id = \$1 AND revoked_at IS NULL AND expires_at > now\(\) ORDER BY last_seen_at DESC`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("s1", userID, "10.0.0.1", "curl/8.0", now, now, "10.0.0.1", now.Add(time.Hour), nil, nil).
+			AddRow("s2", userID, "10.0.0.2", "Firefox", now, now.Add(-time.Hour), "10.0.0.2", now.Add(time.Hour), nil, nil))
+
+	router := gin.New()
+	router.GET("/auth/sessions", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("session_id", "s2")
+		handlers.ListMySessions(db)(c)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/sessions", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"s2","user_id":"`+userID+`","ip_address":"10.0.0.2","user_agent":"Firefox"`)
+	assert.Contains(t, w.Body.String(), `"current":true`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTerminateUserSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "33333333-3333-3333-3333-333333333333"
+	sessionID := "55555555-5555-5555-5555-555555555555"
+	terminate := func() *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.TerminateUserSession(db), http.MethodDelete, "/admin/users/:user_id/sessions/:session_id", "admin")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/users/"+targetID+"/sessions/"+sessionID, nil))
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM sessions WHERE id = \$1 AND user_id = \$2`).
+			WithArgs(sessionID, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WithArgs(sessionID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WithArgs(sessionID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WithArgs(sessionID, "terminated").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("sessions", sessionID, "TERMINATE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := terminate()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Session of another user or already ended", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM sessions WHERE id = \$1 AND user_id = \$2`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		w := terminate()
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAuthMiddlewareTouchesSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assert.NoError(t, testutils.UseTestKeyStore())
+	config.AccessTokenTTL = time.Minute
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	access, err := utils.GenerateJWT("11111111-1111-1111-1111-111111111111", "s1", "employee", "")
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/api/ping", middlewares.AuthMiddleware(db), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"session_id": c.GetString("session_id")})
+	})
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM revoked_tokens WHERE jti = \$1\)`).
+		WithArgs(access.JTI).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`UPDATE sessions SET last_seen_at = now\(\), last_seen_ip = \$2 WHERE id = \$1 AND last_seen_at < now\(\) - interval '1 minute'`).
+		WithArgs("s1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+access.Token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"session_id":"s1"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
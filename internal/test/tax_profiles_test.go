@@ -0,0 +1,84 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTaxProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.GetTaxProfile(db), http.MethodGet, "/admin/users/:user_id/tax-profile", "hr")
+
+	mock.ExpectQuery(`SELECT u.id, COALESCE\(tp.married, false\), COALESCE\(tp.dependents, 0\), tp.updated_at`).
+		WithArgs(targetID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "married", "dependents", "updated_at"}).AddRow(targetID, true, 1, time.Now()))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users/"+targetID+"/tax-profile", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"K/1"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTaxProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.UpdateTaxProfile(db), http.MethodPut, "/admin/users/:user_id/tax-profile", "hr")
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/users/"+targetID+"/tax-profile", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO tax_profiles`).
+			WithArgs(sqlmock.AnyArg(), true, int64(2), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("tax_profiles", targetID, "UPDATE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := put(`{"married":true,"dependents":2}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"K/2"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO tax_profiles`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		w := put(`{"married":false,"dependents":0}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Negative dependents", func(t *testing.T) {
+		w := put(`{"married":false,"dependents":-1}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
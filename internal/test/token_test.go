@@ -0,0 +1,156 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/middlewares"
+	"github.com/chafid/payroll-project/internal/testutils"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.NoError(t, testutils.UseTestKeyStore())
+
+	router := gin.New()
+	router.POST("/auth/refresh", handlers.RefreshTokenHandler(db))
+
+	userID := "11111111-1111-1111-1111-111111111111"
+	refreshRows := func(revokedAt interface{}) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "session_id", "user_id", "role", "must_change_password", "totp_enabled", "expires_at", "revoked_at"}).
+			AddRow("rt1", "s1", userID, "employee", false, false, time.Now().Add(time.Hour), revokedAt)
+	}
+
+	t.Run("Success rotates token", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT t.id, t.session_id, t.user_id, u.role, u.must_change_password, u.totp_enabled, t.expires_at, t.revoked_at FROM refresh_tokens t`).
+			WithArgs(utils.HashToken("old-token")).
+			WillReturnRows(refreshRows(nil))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\) WHERE id = \$1 AND revoked_at IS NULL`).
+			WithArgs("rt1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).
+			WithArgs(sqlmock.AnyArg(), userID, "s1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`UPDATE sessions SET last_seen_at = now\(\), last_seen_ip = \$2, expires_at = \$3 WHERE id = \$1`).
+			WithArgs("s1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(`{"refresh_token":"old-token"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "refresh_token")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reused token revokes all sessions", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT t.id, t.session_id, t.user_id, u.role, u.must_change_password, u.totp_enabled, t.expires_at, t.revoked_at FROM refresh_tokens t`).
+			WithArgs(utils.HashToken("old-token")).
+			WillReturnRows(refreshRows(time.Now()))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WithArgs(userID, "revoked_all").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(`{"refresh_token":"old-token"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expiresAt := time.Now().Add(time.Minute)
+	router := gin.New()
+	router.POST("/auth/logout", func(c *gin.Context) {
+		c.Set("user_id", "11111111-1111-1111-1111-111111111111")
+		c.Set("jti", "jti-1")
+		c.Set("session_id", "s1")
+		c.Set("token_expires_at", expiresAt)
+		handlers.LogoutHandler(db)(c)
+	})
+
+	mock.ExpectExec(`INSERT INTO revoked_tokens`).
+		WithArgs("jti-1", expiresAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO revoked_tokens .* WHERE session_id = \$1`).WithArgs("s1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\) WHERE session_id = \$1`).WithArgs("s1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WithArgs("s1", "logout").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).
+		WithArgs("11111111-1111-1111-1111-111111111111", "jti-1", utils.HashToken("rt")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(`{"refresh_token":"rt"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthMiddlewareRejectsRevokedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.NoError(t, testutils.UseTestKeyStore())
+	config.AccessTokenTTL = time.Minute
+	access, err := utils.GenerateJWT("11111111-1111-1111-1111-111111111111", "", "employee", "")
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/me", middlewares.AuthMiddleware(db), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+	})
+
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+access.Token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM revoked_tokens WHERE jti = \$1\)`).
+		WithArgs(access.JTI).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	assert.Equal(t, http.StatusOK, call().Code)
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM revoked_tokens WHERE jti = \$1\)`).
+		WithArgs(access.JTI).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	w := call()
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "revoked")
+}
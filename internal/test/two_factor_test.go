@@ -0,0 +1,235 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/chafid/payroll-project/internal/testutils"
+	"github.com/chafid/payroll-project/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B test secret "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Unix(59, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	code, err = utils.TOTPCode(secret, utils.TOTPStep(time.Unix(1111111109, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "081804", code)
+
+	now := time.Unix(1111111109, 0)
+	step, ok := utils.ValidateTOTP(secret, "081804", now, 0)
+	assert.True(t, ok)
+	assert.False(t, func() bool { _, ok := utils.ValidateTOTP(secret, "081804", now, step); return ok }(), "replayed code")
+	_, ok = utils.ValidateTOTP(secret, "000000", now, 0)
+	assert.False(t, ok)
+
+	uri := utils.TOTPProvisioningURI(secret, "Payroll", "admin")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Payroll:admin?"))
+	assert.Contains(t, uri, "secret="+secret)
+
+	codes, err := utils.GenerateRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Len(t, codes[0], 11)
+}
+
+func TestEnrollAndVerifyTwoFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.TOTPIssuer = "Payroll"
+	assert.NoError(t, testutils.UseTestKeyStore())
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := "11111111-1111-1111-1111-111111111111"
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", "admin")
+		c.Next()
+	})
+	router.POST("/auth/2fa/enroll", handlers.EnrollTwoFactor(db))
+	router.POST("/auth/2fa/verify", handlers.VerifyTwoFactor(db))
+
+	t.Run("Enroll", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT username, totp_enabled FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"username", "totp_enabled"}).AddRow("admin", false))
+		mock.ExpectExec(`UPDATE users SET totp_secret = \$2`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/2fa/enroll", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "otpauth://totp/Payroll:admin")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		code, _ := utils.TOTPCode(secret, utils.TOTPStep(time.Now()))
+
+		mock.ExpectQuery(`SELECT totp_secret, totp_enabled, must_change_password FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled", "must_change_password"}).AddRow(secret, false, false))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE users SET totp_enabled = true`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM recovery_codes`).WillReturnResult(sqlmock.NewResult(0, 0))
+		for i := 0; i < 10; i++ {
+			mock.ExpectExec(`INSERT INTO recovery_codes`).WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/2fa/verify", strings.NewReader(`{"code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "recovery_codes")
+		assert.NotContains(t, w.Body.String(), "password_change_required")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Verify keeps a pending password change", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		code, _ := utils.TOTPCode(secret, utils.TOTPStep(time.Now()))
+
+		mock.ExpectQuery(`SELECT totp_secret, totp_enabled, must_change_password FROM users WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled", "must_change_password"}).AddRow(secret, false, true))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE users SET totp_enabled = true`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM recovery_codes`).WillReturnResult(sqlmock.NewResult(0, 0))
+		for i := 0; i < 10; i++ {
+			mock.ExpectExec(`INSERT INTO recovery_codes`).WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/2fa/verify", strings.NewReader(`{"code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "recovery_codes")
+		assert.Contains(t, w.Body.String(), `"password_change_required":true`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setLoginConfig()
+	assert.NoError(t, testutils.UseTestKeyStore())
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := "11111111-1111-1111-1111-111111111111"
+	secret, _ := utils.GenerateTOTPSecret()
+	config.MFATokenTTL = time.Minute
+	mfaToken, err := utils.GenerateMFAToken(userID)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/auth/2fa/login", handlers.TwoFactorLogin(db))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/2fa/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	expectUser := func() {
+		expectIPFailures(mock, 0)
+		mock.ExpectQuery(`SELECT username, role, must_change_password, totp_secret, totp_last_step, failed_login_count, last_failed_login_at, locked_until FROM users WHERE id = \$1 AND totp_enabled AND is_active`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"username", "role", "must_change_password", "totp_secret", "totp_last_step", "failed_login_count", "last_failed_login_at", "locked_until"}).
+				AddRow("admin", "admin", false, secret, nil, 0, nil, nil))
+	}
+
+	t.Run("Valid code", func(t *testing.T) {
+		code, _ := utils.TOTPCode(secret, utils.TOTPStep(time.Now()))
+		expectUser()
+		mock.ExpectExec(`UPDATE users SET totp_last_step = \$2`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectLoginAttempt(mock, true)
+		mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"mfa_token":"` + mfaToken + `","code":"` + code + `"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "refresh_token")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Recovery code", func(t *testing.T) {
+		expectUser()
+		mock.ExpectExec(`UPDATE recovery_codes SET used_at = now\(\)`).
+			WithArgs(userID, utils.HashToken("abcde-fghij")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectLoginAttempt(mock, true)
+		mock.ExpectExec(`INSERT INTO sessions`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"mfa_token":"` + mfaToken + `","recovery_code":"abcde-fghij"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Wrong code counts as failed login", func(t *testing.T) {
+		expectUser()
+		expectLoginAttempt(mock, false)
+		mock.ExpectQuery(`UPDATE users SET failed_login_count = CASE WHEN locked_until <= now\(\) THEN 0 ELSE failed_login_count END \+ 1`).
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login_count", "locked_until"}).AddRow(1, nil))
+		mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := post(`{"mfa_token":"` + mfaToken + `","code":"000000"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Access token is not an MFA token", func(t *testing.T) {
+		config.AccessTokenTTL = time.Minute
+		access, _ := utils.GenerateJWT(userID, "", "admin", "")
+
+		w := post(`{"mfa_token":"` + access.Token + `","code":"123456"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -0,0 +1,240 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chafid/payroll-project/config"
+	"github.com/chafid/payroll-project/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var userListColumns = []string{"id", "username", "role", "level_id", "name", "is_active", "hired_on", "terminated_on", "created_at", "updated_at"}
+
+func newUserAdminRouter(db gin.HandlerFunc, method, path, role string) *gin.Engine {
+	router := gin.New()
+	router.Handle(method, path, func(c *gin.Context) {
+		c.Set("user_id", "22222222-2222-2222-2222-222222222222")
+		c.Set("role", role)
+		c.Next()
+	}, db)
+	return router
+}
+
+func TestCreateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.PasswordMinLength = 8
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	post := func(role, body string) *httptest.ResponseRecorder {
+		router := newUserAdminRouter(handlers.CreateUser(db), http.MethodPost, "/admin/users", role)
+		req := httptest.NewRequest(http.MethodPost, "/admin/users", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO users`).
+			WithArgs(sqlmock.AnyArg(), "employee101", sqlmock.AnyArg(), "employee", sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO password_history`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", sqlmock.AnyArg(), "INSERT", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`SELECT u.id, u.username, u.role`).
+			WillReturnRows(sqlmock.NewRows(userListColumns).
+				AddRow("u1", "employee101", "employee", "lvl1", "Junior", true, nil, nil, time.Now(), time.Now()))
+
+		w := post("hr", `{"username":"employee101","password":"initial-pass","role":"employee","level_id":"lvl1"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"level_name":"Junior"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Duplicate username", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO users`).
+			WillReturnError(&duplicateKeyError{})
+		mock.ExpectRollback()
+
+		w := post("admin", `{"username":"employee001","password":"initial-pass","role":"employee"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid role", func(t *testing.T) {
+		w := post("admin", `{"username":"x","password":"initial-pass","role":"owner"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("HR cannot create admins", func(t *testing.T) {
+		w := post("hr", `{"username":"x","password":"initial-pass","role":"admin"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+type duplicateKeyError struct{}
+
+func (duplicateKeyError) Error() string {
+	return `pq: duplicate key value violates unique constraint "users_username_key"`
+}
+
+func TestListUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	router := newUserAdminRouter(handlers.ListUsers(db), http.MethodGet, "/admin/users", "admin")
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users u WHERE u.username ILIKE '%' \|\| \$1 \|\| '%' AND u.is_active = \$2`).
+		WithArgs("emp", true).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery(`SELECT u.id, u.username, u.role.* ORDER BY u.username LIMIT \$3 OFFSET \$4`).
+		WithArgs("emp", true, int64(10), int64(10)).
+		WillReturnRows(sqlmock.NewRows(userListColumns).
+			AddRow("u1", "employee011", "employee", "lvl1", "Junior", true, nil, nil, time.Now(), time.Now()))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users?q=emp&active=true&page=2&page_size=10", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":42`)
+	assert.Contains(t, w.Body.String(), `"username":"employee011"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	router := newUserAdminRouter(handlers.UpdateUser(db), http.MethodPatch, "/admin/users/:user_id", "admin")
+
+	mock.ExpectQuery(`SELECT u.id, u.username, u.role`).
+		WillReturnRows(sqlmock.NewRows(userListColumns).
+			AddRow(targetID, "employee001", "employee", "lvl1", "Junior", true, nil, nil, time.Now(), time.Now()))
+	mock.ExpectExec(`UPDATE users SET role = \$2, level_id = \$3`).
+		WithArgs(sqlmock.AnyArg(), "manager", "lvl2", nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// role changed, so tokens are revoked
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("users", targetID, "UPDATE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT u.id, u.username, u.role`).
+		WillReturnRows(sqlmock.NewRows(userListColumns).
+			AddRow(targetID, "employee001", "manager", "lvl2", "Mid", true, nil, nil, time.Now(), time.Now()))
+
+	req := httptest.NewRequest(http.MethodPatch, "/admin/users/"+targetID, strings.NewReader(`{"role":"manager","level_id":"lvl2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"manager"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeactivateAndReactivateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	targetID := "11111111-1111-1111-1111-111111111111"
+	expectTargetRole := func(role string) {
+		mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).
+			WithArgs(targetID).
+			WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(role))
+	}
+
+	t.Run("Deactivate", func(t *testing.T) {
+		router := newUserAdminRouter(handlers.DeactivateUser(db), http.MethodPost, "/admin/users/:user_id/deactivate", "admin")
+		expectTargetRole("employee")
+		mock.ExpectExec(`UPDATE users SET is_active = \$2`).
+			WithArgs(sqlmock.AnyArg(), false, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = now\(\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).
+			WithArgs("users", targetID, "DEACTIVATE", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+targetID+"/deactivate", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("HR cannot deactivate an admin", func(t *testing.T) {
+		router := newUserAdminRouter(handlers.DeactivateUser(db), http.MethodPost, "/admin/users/:user_id/deactivate", "hr")
+		expectTargetRole("admin")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+targetID+"/deactivate", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("HR cannot reactivate an admin", func(t *testing.T) {
+		router := newUserAdminRouter(handlers.ReactivateUser(db), http.MethodPost, "/admin/users/:user_id/reactivate", "hr")
+		expectTargetRole("admin")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+targetID+"/reactivate", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reactivate unknown user", func(t *testing.T) {
+		router := newUserAdminRouter(handlers.ReactivateUser(db), http.MethodPost, "/admin/users/:user_id/reactivate", "admin")
+		mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).
+			WithArgs(targetID).
+			WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/"+targetID+"/reactivate", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Cannot deactivate self", func(t *testing.T) {
+		router := newUserAdminRouter(handlers.DeactivateUser(db), http.MethodPost, "/admin/users/:user_id/deactivate", "admin")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/users/22222222-2222-2222-2222-222222222222/deactivate", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
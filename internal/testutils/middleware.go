@@ -1,6 +1,10 @@
 package testutils
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+
+	"github.com/chafid/payroll-project/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,3 +25,21 @@ func InjectMockAdmin() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// UseTestKeyStore installs a freshly generated Ed25519 signing key for tests that issue or verify JWTs
+func UseTestKeyStore() error {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	key, err := utils.NewSigningKey("test", private)
+	if err != nil {
+		return err
+	}
+	ks, err := utils.NewKeyStore("test", key)
+	if err != nil {
+		return err
+	}
+	utils.SetKeyStore(ks)
+	return nil
+}
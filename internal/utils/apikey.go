@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyPrefix makes API keys recognizable, e.g. in secret scanners
+const apiKeyPrefix = "pk_"
+
+// apiKeyDisplayLength is how much of a key is stored in clear to tell keys apart
+const apiKeyDisplayLength = 11
+
+// apiSigningSecretPrefix tells signing secrets apart from the keys they belong to
+const apiSigningSecretPrefix = "pks_"
+
+// GenerateAPIKey returns a new API key, the prefix shown in listings and the hash stored at rest
+func GenerateAPIKey() (key, displayPrefix, hash string, err error) {
+	raw, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + raw
+	return key, key[:apiKeyDisplayLength], HashToken(key), nil
+}
+
+// GenerateSigningSecret returns the secret a client signs requests with. It is issued
+// alongside an API key but never sent with requests, so a captured key can't sign them.
+func GenerateSigningSecret() (string, error) {
+	raw, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return apiSigningSecretPrefix + raw, nil
+}
+
+// SignRequest computes the hex HMAC-SHA256 a client sends in X-Signature,
+// keyed with the signing secret of its API key
+func SignRequest(secret, timestamp, method, requestURI string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + requestURI + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequestSignature compares a signature against the expected one in constant time
+func VerifyRequestSignature(secret, timestamp, method, requestURI string, body []byte, signature string) bool {
+	expected := SignRequest(secret, timestamp, method, requestURI, body)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
@@ -0,0 +1,22 @@
+package utils
+
+import "time"
+
+// LoginBackoff returns how long a user must wait after failures consecutive failed logins.
+// Nothing is required below threshold, then the wait doubles from base on every failure, capped at max.
+func LoginBackoff(failures, threshold int, base, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	wait := base
+	for i := threshold; i < failures; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
@@ -2,13 +2,41 @@ package utils
 
 import "time"
 
-// CountWorkingDays returns the number of weekdays between two dates inclusive.
-func CountWorkingDays(start, end time.Time) int {
+// Holidays are public holidays by date (YYYY-MM-DD) with their name, they are not working days
+type Holidays map[string]string
+
+// Name returns the name of the holiday on d, if it is one
+func (h Holidays) Name(d time.Time) (string, bool) {
+	name, ok := h[d.Format("2006-01-02")]
+	return name, ok
+}
+
+// IsWeekend tells whether d is a Saturday or a Sunday
+func IsWeekend(d time.Time) bool {
+	return d.Weekday() == time.Saturday || d.Weekday() == time.Sunday
+}
+
+// CountWorkingDays returns the number of weekdays between two dates inclusive that are not holidays.
+func CountWorkingDays(start, end time.Time, holidays Holidays) int {
 	count := 0
 	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
-		if d.Weekday() >= time.Monday && d.Weekday() <= time.Friday {
+		if _, holiday := holidays.Name(d); !IsWeekend(d) && !holiday {
 			count++
 		}
 	}
 	return count
 }
+
+// EmploymentWindow narrows a period to the days someone was employed. hiredOn and terminatedOn are
+// optional, terminatedOn is the last day of employment. ok is false when they weren't employed
+// on any day of the period.
+func EmploymentWindow(start, end time.Time, hiredOn, terminatedOn *time.Time) (from, to time.Time, ok bool) {
+	from, to = start, end
+	if hiredOn != nil && hiredOn.After(from) {
+		from = *hiredOn
+	}
+	if terminatedOn != nil && terminatedOn.Before(to) {
+		to = *terminatedOn
+	}
+	return from, to, !from.After(to)
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxHolidaySpan is the longest single event accepted from a calendar, longer ones are likely not holidays
+const maxHolidaySpan = 31
+
+var ErrInvalidCalendar = errors.New("invalid iCalendar file")
+
+// CalendarHoliday is one day of an all-day event read from an iCalendar file
+type CalendarHoliday struct {
+	Date time.Time
+	Name string
+}
+
+// ParseHolidayCalendar reads the events of an iCalendar (.ics) file as holidays, one per day they cover.
+// DTEND is exclusive as in the RFC 5545 all-day events published by holiday calendars.
+// Recurrence rules are not expanded, only the first occurrence is read. A day listed twice keeps
+// the first name.
+func ParseHolidayCalendar(r io.Reader) ([]CalendarHoliday, error) {
+	lines, err := unfoldCalendarLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("%w: missing BEGIN:VCALENDAR", ErrInvalidCalendar)
+	}
+
+	var holidays []CalendarHoliday
+	seen := map[string]bool{}
+	var event map[string]string
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		//parameters such as ;VALUE=DATE don't matter, the value holds the date either way
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = map[string]string{}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("%w: END:VEVENT without BEGIN", ErrInvalidCalendar)
+			}
+			days, err := eventDays(event)
+			if err != nil {
+				return nil, err
+			}
+			for _, day := range days {
+				key := day.Format("2006-01-02")
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				holidays = append(holidays, CalendarHoliday{Date: day, Name: event["SUMMARY"]})
+			}
+			event = nil
+		case event != nil:
+			if _, exists := event[name]; !exists {
+				event[name] = value
+			}
+		}
+	}
+	return holidays, nil
+}
+
+// unfoldCalendarLines joins continuation lines, which start with a space or a tab
+func unfoldCalendarLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+	}
+	return lines, nil
+}
+
+// eventDays lists the days covered by an event
+func eventDays(event map[string]string) ([]time.Time, error) {
+	start, err := parseCalendarDate(event["DTSTART"])
+	if err != nil {
+		return nil, err
+	}
+	event["SUMMARY"] = unescapeCalendarText(event["SUMMARY"])
+	if event["SUMMARY"] == "" {
+		event["SUMMARY"] = "Holiday"
+	}
+
+	//an all-day event without an end, or with a date-time end, is a single day
+	end := start.AddDate(0, 0, 1)
+	if value, ok := event["DTEND"]; ok && len(value) == len("20060102") {
+		if end, err = parseCalendarDate(value); err != nil {
+			return nil, err
+		}
+	}
+	if !end.After(start) || end.Sub(start) > maxHolidaySpan*24*time.Hour {
+		return nil, fmt.Errorf("%w: event %q must end after it starts and last at most %d days", ErrInvalidCalendar, event["SUMMARY"], maxHolidaySpan)
+	}
+
+	var days []time.Time
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// parseCalendarDate reads the date of a DATE (20250331) or DATE-TIME (20250331T000000Z) value
+func parseCalendarDate(value string) (time.Time, error) {
+	if len(value) < len("20060102") {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q", ErrInvalidCalendar, value)
+	}
+	date, err := time.Parse("20060102", value[:len("20060102")])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q", ErrInvalidCalendar, value)
+	}
+	return date, nil
+}
+
+var calendarTextEscapes = strings.NewReplacer(`\\`, `\`, `\,`, `,`, `\;`, `;`, `\n`, " ", `\N`, " ")
+
+func unescapeCalendarText(value string) string {
+	return strings.TrimSpace(calendarTextEscapes.Replace(value))
+}
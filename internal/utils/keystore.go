@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one JWT key identified by its kid. Private is nil for verification-only keys.
+type SigningKey struct {
+	KID     string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeyStore holds the active signing key and every key still accepted for verification
+type KeyStore struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+var (
+	keyStoreMu sync.RWMutex
+	keyStore   *KeyStore
+)
+
+// SetKeyStore installs the key store used by GenerateJWT and ParseJWT
+func SetKeyStore(ks *KeyStore) {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+	keyStore = ks
+}
+
+// CurrentKeyStore returns the installed key store
+func CurrentKeyStore() *KeyStore {
+	keyStoreMu.RLock()
+	defer keyStoreMu.RUnlock()
+	return keyStore
+}
+
+// NewSigningKey builds a SigningKey from an RSA or Ed25519 private key
+func NewSigningKey(kid string, private crypto.Signer) (*SigningKey, error) {
+	key := &SigningKey{KID: kid, Private: private, Public: private.Public()}
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T for kid %q", private, kid)
+	}
+	return key, nil
+}
+
+// NewKeyStore builds a key store from keys, signing with the key whose kid is activeKID
+func NewKeyStore(activeKID string, keys ...*SigningKey) (*KeyStore, error) {
+	ks := &KeyStore{keys: make(map[string]*SigningKey)}
+	for _, k := range keys {
+		ks.keys[k.KID] = k
+	}
+
+	active, ok := ks.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeKID)
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", activeKID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// LoadKeyStore reads every <kid>.pem file in dir. Private keys (PKCS#8 or PKCS#1) can sign,
+// public keys (PKIX) are kept for verification only so retired keys can be shipped without their secret.
+// When activeKID is empty the lexically greatest kid with a private key is used, so date-named
+// files (e.g. 2025-07-01.pem) rotate automatically when a newer file is added.
+func LoadKeyStore(dir, activeKID string) (*KeyStore, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := loadKeyFile(path, kid)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if activeKID == "" {
+		//paths are sorted, so the last private key has the greatest kid
+		for _, key := range keys {
+			if key.Private != nil {
+				activeKID = key.KID
+			}
+		}
+	}
+
+	return NewKeyStore(activeKID, keys...)
+}
+
+func loadKeyFile(path, kid string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported private key", path)
+		}
+		return NewSigningKey(kid, signer)
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		return NewSigningKey(kid, parsed)
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		switch pub := parsed.(type) {
+		case *rsa.PublicKey:
+			return &SigningKey{KID: kid, Method: jwt.SigningMethodRS256, Public: pub}, nil
+		case ed25519.PublicKey:
+			return &SigningKey{KID: kid, Method: jwt.SigningMethodEdDSA, Public: pub}, nil
+		}
+		return nil, fmt.Errorf("%s: unsupported public key type %T", path, parsed)
+	}
+	return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+}
+
+// WriteEd25519KeyFile generates a new Ed25519 key and writes it to dir/<kid>.pem
+func WriteEd25519KeyFile(dir, kid string) error {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600)
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (ks *KeyStore) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.KID
+	return token.SignedString(ks.active.Private)
+}
+
+// Keyfunc resolves the verification key from the token kid header
+func (ks *KeyStore) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set
+func (ks *KeyStore) JWKS() map[string]interface{} {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		k := ks.keys[kid]
+		jwk := map[string]string{"kid": kid, "use": "sig", "alg": k.Method.Alg()}
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// ParseJWT verifies tokenStr against the installed key store
+func ParseJWT(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	ks := CurrentKeyStore()
+	if ks == nil {
+		return nil, errors.New("signing keys are not loaded")
+	}
+	return jwt.ParseWithClaims(tokenStr, claims, ks.Keyfunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+}
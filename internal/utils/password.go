@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/chafid/payroll-project/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt ignores everything after the 72nd byte
+const maxPasswordBytes = 72
+
+// ValidatePassword checks plain against the configured password policy
+func ValidatePassword(plain string) error {
+	if utf8.RuneCountInString(plain) < config.PasswordMinLength {
+		return fmt.Errorf("Password must be at least %d characters long", config.PasswordMinLength)
+	}
+	if len(plain) > maxPasswordBytes {
+		return fmt.Errorf("Password must be at most %d bytes long", maxPasswordBytes)
+	}
+	return nil
+}
+
+// HashPassword returns the bcrypt hash of plain
+func HashPassword(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -1,23 +1,110 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/chafid/payroll-project/config"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-//var jwtKey = []byte(config.JwtSecret)
+// Restrictions limit an access token to the account endpoints that resolve them
+const (
+	RestrictionPasswordChange = "password_change"
+	RestrictionMFAEnrollment  = "mfa_enrollment"
+)
+
+// AccessToken is a signed JWT together with the claims needed to revoke it
+type AccessToken struct {
+	Token     string
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// GenerateJWT issues a short-lived access token carrying a unique jti and the id of the login session
+// (sid), signed with the active key. A non-empty restriction limits what the token may be used for
+// until the user resolves it.
+func GenerateJWT(userID, sessionID, role, restriction string) (AccessToken, error) {
+	ks := CurrentKeyStore()
+	if ks == nil {
+		return AccessToken{}, errors.New("signing keys are not loaded")
+	}
+
+	now := time.Now()
+	jti := uuid.New().String()
+	expiresAt := now.Add(config.AccessTokenTTL)
 
-func GenerateJWT(userID, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(72 * time.Hour).Unix(), //token expired in 3 days
+		"jti":     jti,
+		"sid":     sessionID,
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	}
+	if restriction != "" {
+		claims["restriction"] = restriction
+	}
+
+	signed, err := ks.Sign(claims)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	return AccessToken{Token: signed, JTI: jti, ExpiresAt: expiresAt}, nil
+}
+
+// GenerateOpaqueToken returns a random opaque token (refresh or reset) and the hash to store server-side
+func GenerateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
 	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	return raw, HashToken(raw), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of an opaque token
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// mfaPurpose marks the short-lived token handed out between the password and the TOTP step
+const mfaPurpose = "mfa"
 
-	return token.SignedString([]byte(config.JwtSecret))
+// GenerateMFAToken issues a token proving the password step succeeded for userID
+func GenerateMFAToken(userID string) (string, error) {
+	ks := CurrentKeyStore()
+	if ks == nil {
+		return "", errors.New("signing keys are not loaded")
+	}
+	now := time.Now()
+	return ks.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"purpose": mfaPurpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(config.MFATokenTTL).Unix(),
+	})
+}
+
+// ParseMFAToken verifies a token from GenerateMFAToken and returns its user id
+func ParseMFAToken(tokenStr string) (string, error) {
+	claims := jwt.MapClaims{}
+	token, err := ParseJWT(tokenStr, claims)
+	if err != nil || !token.Valid {
+		return "", errors.New("invalid or expired token")
+	}
+	if purpose, _ := claims["purpose"].(string); purpose != mfaPurpose {
+		return "", errors.New("invalid token purpose")
+	}
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		return "", errors.New("invalid token subject")
+	}
+	return userID, nil
 }
@@ -4,13 +4,26 @@
 CREATE EXTENSION IF NOT EXISTS "pgcrypto";
 
 -- Drop existing tables if they exist (for dev reset)
-DROP TABLE IF EXISTS reimbursements, overtimes, attendances, payslips, attendance_periods, audit_logs,  users, employee_levels CASCADE;
+DROP TABLE IF EXISTS overtime_policies, holidays, loan_skips, loan_repayments, loans, bonuses, allowances, payslip_items, payslip_contributions, tax_profiles, period_overrides, api_key_signatures, api_keys, recovery_codes, password_reset_tokens, password_history, login_attempts, revoked_tokens, refresh_tokens, sessions, reimbursement_receipts, reimbursements, reimbursement_categories, overtimes, attendances, payslips, payroll_runs, attendance_periods, audit_logs,  users, employee_level_salaries, employee_levels CASCADE;
 
 -- Employee level table
 CREATE TABLE employee_levels (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     name TEXT UNIQUE NOT NULL,
-    base_salary NUMERIC NOT NULL
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID
+);
+
+-- Effective-dated base salary per level - payroll uses the row in force at the start of the period
+CREATE TABLE employee_level_salaries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    level_id UUID NOT NULL REFERENCES employee_levels(id) ON DELETE CASCADE,
+    base_salary NUMERIC(12, 2) NOT NULL CHECK (base_salary > 0),
+    effective_from DATE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID,
+    created_ip INET,
+    UNIQUE(level_id, effective_from)
 );
 
 -- Users table - employees and admin use the same table
@@ -18,12 +31,24 @@ CREATE TABLE users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     username TEXT UNIQUE NOT NULL,
     password TEXT NOT NULL,
-    role TEXT NOT NULL CHECK (role IN ('admin', 'employee')),
+    role TEXT NOT NULL CHECK (role IN ('admin', 'hr', 'finance', 'manager', 'employee', 'service')),
     level_id UUID REFERENCES employee_levels(id),
+    failed_login_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_login_at TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    must_change_password BOOLEAN NOT NULL DEFAULT false,
+    password_changed_at TIMESTAMPTZ,
+    totp_secret TEXT,
+    totp_enabled BOOLEAN NOT NULL DEFAULT false,
+    totp_last_step BIGINT, -- last accepted TOTP time step, prevents code replay
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    hired_on DATE, -- first day of employment, payroll prorates the period it falls in
+    terminated_on DATE, -- last day of employment, payroll skips the periods after it
     created_at TIMESTAMPTZ DEFAULT now(),
     updated_at TIMESTAMPTZ DEFAULT now(),
     created_by UUID,
-    updated_by UUID
+    updated_by UUID,
+    CHECK (terminated_on >= hired_on)
 );
 
 -- Attendances periods - only updated/created by admin
@@ -31,6 +56,10 @@ CREATE TABLE attendance_periods (
     id TEXT PRIMARY KEY,
     start_date DATE NOT NULL,
     end_date DATE NOT NULL,
+    -- closed periods reject submissions, as do periods with a payroll run
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    closed_at TIMESTAMPTZ,
+    closed_by UUID REFERENCES users(id),
     created_at TIMESTAMPTZ DEFAULT now(),
     updated_at TIMESTAMPTZ DEFAULT now(),
     created_by UUID REFERENCES users(id),
@@ -59,7 +88,11 @@ CREATE TABLE overtimes (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     date DATE NOT NULL,
-    hours NUMERIC(4, 2) CHECK (hours > 0 AND hours <= 3),
+    hours NUMERIC(4, 2) CHECK (hours > 0 AND hours <= 24), -- caps come from the overtime policy
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')), -- only approved hours are paid
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMPTZ,
+    review_comment TEXT,
     created_at TIMESTAMPTZ DEFAULT now(),
     updated_at TIMESTAMPTZ DEFAULT now(),
     created_by UUID REFERENCES users(id),
@@ -69,13 +102,39 @@ CREATE TABLE overtimes (
     UNIQUE(user_id, date)
 );
 
--- Reimbursement submissions
+CREATE INDEX idx_overtimes_status ON overtimes(status, date);
+
+-- Reimbursement categories, e.g. medical or travel. A NULL limit means no limit, the period limit is per calendar month.
+-- Claims over a limit are flagged for the approver or capped to what the limits leave.
+CREATE TABLE reimbursement_categories (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    per_claim_limit NUMERIC(12, 2) CHECK (per_claim_limit > 0),
+    per_period_limit NUMERIC(12, 2) CHECK (per_period_limit > 0),
+    over_limit_action TEXT NOT NULL DEFAULT 'flag' CHECK (over_limit_action IN ('flag', 'cap')),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    updated_by UUID REFERENCES users(id),
+    created_ip INET,
+    updated_ip INET
+);
+
+-- Reimbursement submissions. amount is what is paid once approved, lower than claimed_amount when the category capped it.
 CREATE TABLE reimbursements (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    category_code TEXT NOT NULL REFERENCES reimbursement_categories(code),
+    claimed_amount NUMERIC(12, 2) NOT NULL CHECK (claimed_amount > 0),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0 AND amount <= claimed_amount),
+    over_limit BOOLEAN NOT NULL DEFAULT FALSE,
     description TEXT,
     date DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')), -- only approved claims are paid
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMPTZ,
+    review_reason TEXT,
     created_at TIMESTAMPTZ DEFAULT now(),
     updated_at TIMESTAMPTZ DEFAULT now(),
     created_by UUID REFERENCES users(id),
@@ -84,22 +143,95 @@ CREATE TABLE reimbursements (
     updated_ip INET
 );
 
--- Payslip table - created once payroll is processed
+CREATE INDEX idx_reimbursements_status ON reimbursements(status, date);
+CREATE INDEX idx_reimbursements_user_category ON reimbursements(user_id, category_code, date);
+
+-- Receipt files of reimbursement claims. The files are kept in receipt storage under storage_key.
+CREATE TABLE reimbursement_receipts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reimbursement_id UUID NOT NULL REFERENCES reimbursements(id) ON DELETE CASCADE,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL CHECK (size > 0),
+    sha256 TEXT NOT NULL CHECK (sha256 ~ '^[0-9a-f]{64}$'),
+    storage_key TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET
+);
+
+CREATE INDEX idx_reimbursement_receipts_reimbursement ON reimbursement_receipts(reimbursement_id);
+
+-- Payroll runs - one per period. A draft run can be re-run, which replaces its payslips; a finalized run is immutable
+CREATE TABLE payroll_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    attendance_periods_id TEXT UNIQUE NOT NULL REFERENCES attendance_periods(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'finalized')),
+    run_count INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    finalized_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id),
+    updated_by UUID REFERENCES users(id),
+    finalized_by UUID REFERENCES users(id),
+    created_ip INET,
+    updated_ip INET,
+    finalized_ip INET
+);
+
+-- Payslip table - created once payroll is processed. The amount columns are totals of payslip_items,
+-- kept on the payslip for reporting.
 CREATE TABLE payslips (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payroll_run_id UUID NOT NULL REFERENCES payroll_runs(id) ON DELETE CASCADE,
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     attendance_periods_id TEXT NOT NULL REFERENCES attendance_periods(id) ON DELETE CASCADE,
     base_salary NUMERIC(12, 2) NOT NULL,
     attendance_days INTEGER NOT NULL,
+    working_days INTEGER NOT NULL, -- working days of the period the employee was employed
     attendance_amount NUMERIC(12, 2) NOT NULL,
     overtime_hours NUMERIC(8, 2) NULL,
     overtime_amount NUMERIC(12, 2) NULL,
     reimbursement_amount NUMERIC(12, 2) NULL,
+    tax_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    tax_status TEXT, -- PPh 21 status used for the withholding, e.g. K/1
+    employee_contributions NUMERIC(12, 2) NOT NULL DEFAULT 0, -- withheld, detailed in payslip_contributions
+    employer_contributions NUMERIC(12, 2) NOT NULL DEFAULT 0, -- paid by the company on top of the pay
+    total_earnings NUMERIC(12, 2) NOT NULL,
+    total_deductions NUMERIC(12, 2) NOT NULL,
     total_take_home NUMERIC(12, 2) NOT NULL,
     created_at TIMESTAMPTZ DEFAULT now(),
     created_by UUID REFERENCES users(id),
     created_ip INET,
-    UNIQUE(user_id, attendance_periods_id)
+    UNIQUE(user_id, attendance_periods_id),
+    -- the calculator guarantees this, the constraint keeps the table honest
+    CHECK (total_take_home = total_earnings - total_deductions)
+);
+
+-- Line items of a payslip, in the order they are shown. A new pay component is a new code, not a new column.
+CREATE TABLE payslip_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payslip_id UUID NOT NULL REFERENCES payslips(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    code TEXT NOT NULL,
+    label TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('earning', 'deduction')),
+    quantity NUMERIC(16, 4) NOT NULL,
+    rate NUMERIC(16, 4) NOT NULL,
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount >= 0),
+    taxable BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE (payslip_id, position)
+);
+
+-- Social security contributions of a payslip, one row per program
+CREATE TABLE payslip_contributions (
+    payslip_id UUID NOT NULL REFERENCES payslips(id) ON DELETE CASCADE,
+    code TEXT NOT NULL,
+    label TEXT NOT NULL,
+    base NUMERIC(12, 2) NOT NULL,
+    employee_amount NUMERIC(12, 2) NOT NULL CHECK (employee_amount >= 0),
+    employer_amount NUMERIC(12, 2) NOT NULL CHECK (employer_amount >= 0),
+    PRIMARY KEY (payslip_id, code)
 );
 
 -- Audit log table
@@ -113,3 +245,251 @@ CREATE TABLE audit_logs (
     change_data JSONB,
     created_at TIMESTAMPTZ DEFAULT now()
 );
+
+
+-- Login sessions - one per login on a device, kept alive by refresh token rotation
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip_address INET,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ DEFAULT now(), -- issued at
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_ip INET,
+    expires_at TIMESTAMPTZ NOT NULL, -- expiry of the newest refresh token
+    revoked_at TIMESTAMPTZ,
+    revoked_reason TEXT -- 'logout', 'terminated' or 'revoked_all'
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+
+-- Refresh tokens - only the hash is stored, rotated on every use
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    access_jti TEXT NOT NULL, -- jti of the access token issued alongside, used to revoke it
+    access_expires_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_ip INET
+);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+
+-- Access token denylist - rows can be purged once expires_at has passed
+CREATE TABLE revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT now()
+);
+
+-- Login attempts - used for per-address throttling and as a trail of guesses for unknown usernames
+CREATE TABLE login_attempts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username TEXT NOT NULL,
+    ip_address INET,
+    succeeded BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_login_attempts_ip_created_at ON login_attempts(ip_address, created_at);
+
+-- Previous password hashes, checked to prevent reuse
+CREATE TABLE password_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_password_history_user_id ON password_history(user_id, created_at);
+
+-- Admin-initiated password reset tokens - single use, only the hash is stored
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET
+);
+
+-- 2FA recovery codes - single use, only the hash is stored
+CREATE TABLE recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE(user_id, code_hash)
+);
+
+-- API keys of service accounts (users with role 'service') - only the hash is stored
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    service_account_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL, -- first characters of the key, shown to tell keys apart
+    key_hash TEXT UNIQUE NOT NULL,
+    signing_secret TEXT NOT NULL, -- HMAC key for request signatures, kept in clear to verify them
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    require_signature BOOLEAN NOT NULL DEFAULT false,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip INET,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET
+);
+
+CREATE INDEX idx_api_keys_service_account_id ON api_keys(service_account_id);
+
+-- Request signatures already accepted per API key, kept until their timestamp leaves the signature window
+CREATE TABLE api_key_signatures (
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    signature TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (api_key_id, signature)
+);
+
+-- Time-bound admin overrides that reopen a locked period for corrections, for one employee or everyone
+CREATE TABLE period_overrides (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    attendance_periods_id TEXT NOT NULL REFERENCES attendance_periods(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET,
+    revoked_by UUID REFERENCES users(id)
+);
+
+CREATE INDEX idx_period_overrides_period ON period_overrides(attendance_periods_id);
+
+-- Marital status and dependents of an employee, they set the non-taxable allowance (PTKP).
+-- Employees without a row are withheld as single without dependents (TK/0).
+CREATE TABLE tax_profiles (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    married BOOLEAN NOT NULL DEFAULT false,
+    dependents INTEGER NOT NULL DEFAULT 0 CHECK (dependents >= 0),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    updated_by UUID REFERENCES users(id),
+    updated_ip INET
+);
+
+-- Recurring monthly allowances, for every employee of a level or for one employee.
+-- An employee allowance replaces the level allowance with the same code.
+CREATE TABLE allowances (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code TEXT NOT NULL CHECK (code ~ '^[A-Z][A-Z0-9_]*$'),
+    label TEXT NOT NULL,
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    taxable BOOLEAN NOT NULL DEFAULT true,
+    level_id UUID REFERENCES employee_levels(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    end_date DATE,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET,
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    updated_by UUID REFERENCES users(id),
+    updated_ip INET,
+    CHECK (num_nonnulls(level_id, user_id) = 1),
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE INDEX idx_allowances_level ON allowances(level_id);
+CREATE INDEX idx_allowances_user ON allowances(user_id);
+
+-- One-off bonuses, paid with the payslip of a period
+CREATE TABLE bonuses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attendance_periods_id TEXT NOT NULL REFERENCES attendance_periods(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    taxable BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET
+);
+
+CREATE INDEX idx_bonuses_period ON bonuses(attendance_periods_id);
+
+-- Loans and salary advances, repaid by installments deducted in payroll runs.
+-- The balance is the principal minus the repayments.
+CREATE TABLE loans (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    description TEXT NOT NULL,
+    principal NUMERIC(12, 2) NOT NULL CHECK (principal > 0),
+    installment_amount NUMERIC(12, 2) NOT NULL CHECK (installment_amount > 0 AND installment_amount <= principal),
+    start_date DATE NOT NULL, -- first period the installment is deducted in is the one containing this date
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET
+);
+
+CREATE INDEX idx_loans_user ON loans(user_id);
+
+-- Repayments of a loan: installments deducted on a payslip, or an early payoff made outside payroll.
+-- Installments go away with the payslip when a draft run is re-run.
+CREATE TABLE loan_repayments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    loan_id UUID NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('installment', 'payoff')),
+    payslip_id UUID REFERENCES payslips(id) ON DELETE CASCADE,
+    attendance_periods_id TEXT REFERENCES attendance_periods(id),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET,
+    CHECK ((kind = 'installment') = (payslip_id IS NOT NULL))
+);
+
+CREATE INDEX idx_loan_repayments_loan ON loan_repayments(loan_id);
+
+-- Periods in which the installment of a loan is not deducted
+CREATE TABLE loan_skips (
+    loan_id UUID NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    attendance_periods_id TEXT NOT NULL REFERENCES attendance_periods(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET,
+    PRIMARY KEY (loan_id, attendance_periods_id)
+);
+
+-- Public holidays, not working days: they don't count towards the salary denominator and take no attendance
+CREATE TABLE holidays (
+    date DATE PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    created_by UUID REFERENCES users(id),
+    created_ip INET
+);
+
+-- Overtime policy of a level, levels without one use the company policy. A zero cap or increment means no limit.
+CREATE TABLE overtime_policies (
+    level_id UUID PRIMARY KEY REFERENCES employee_levels(id) ON DELETE CASCADE,
+    daily_cap NUMERIC(4, 2) NOT NULL DEFAULT 0 CHECK (daily_cap >= 0 AND daily_cap <= 24),
+    weekly_cap NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (weekly_cap >= 0),
+    monthly_cap NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (monthly_cap >= 0),
+    weekday_multiplier NUMERIC(5, 2) NOT NULL CHECK (weekday_multiplier > 0),
+    rest_day_multiplier NUMERIC(5, 2) NOT NULL CHECK (rest_day_multiplier > 0),
+    holiday_multiplier NUMERIC(5, 2) NOT NULL CHECK (holiday_multiplier > 0),
+    increment NUMERIC(4, 2) NOT NULL DEFAULT 0 CHECK (increment >= 0),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    updated_by UUID REFERENCES users(id),
+    updated_ip INET
+);
@@ -1,19 +1,32 @@
--- Example insert for admin
-INSERT INTO users (id, username, password, role, level_id, created_at, created_by)
+-- Example insert for admin. The password is well known, so it must be changed on first login
+INSERT INTO users (id, username, password, role, level_id, must_change_password, created_at, created_by)
 VALUES (
   gen_random_uuid(),
   'admin',
   '$2a$10$MWTyPjrQV.TopF4.oU/y7./yVoY45gz4ZDRdu85HhaRHcRdTkbdeu[', -- hashed 'admin123'
   'admin',
   NULL,
+  true,
   NOW(),
   NULL
 );
 
-INSERT INTO employee_levels (id, name, base_salary) VALUES
-  (gen_random_uuid(), 'Junior', 5000000),
-  (gen_random_uuid(), 'Mid', 8000000),
-  (gen_random_uuid(), 'Senior', 12000000);
+INSERT INTO employee_levels (id, name) VALUES
+  (gen_random_uuid(), 'Junior'),
+  (gen_random_uuid(), 'Mid'),
+  (gen_random_uuid(), 'Senior');
+
+INSERT INTO employee_level_salaries (level_id, base_salary, effective_from)
+SELECT id,
+  CASE name WHEN 'Junior' THEN 5000000 WHEN 'Mid' THEN 8000000 ELSE 12000000 END,
+  DATE '2000-01-01'
+FROM employee_levels;
+
+INSERT INTO reimbursement_categories (code, name, per_claim_limit, per_period_limit, over_limit_action) VALUES
+  ('medical', 'Medical', NULL, 5000000, 'cap'),
+  ('travel', 'Travel', 2000000, NULL, 'flag'),
+  ('internet', 'Internet', 300000, 300000, 'cap'),
+  ('other', 'Other', NULL, NULL, 'flag');
 
 -- Seed 100 employees with random level_id
 DO $$
@@ -28,13 +41,15 @@ BEGIN
 
   FOR i IN 1..100 LOOP
     rand_index := trunc(random() * level_count + 1);
-    INSERT INTO users (id, username, password, role, level_id, created_at, updated_at)
+    -- the password is the username, it must be changed on first login
+    INSERT INTO users (id, username, password, role, level_id, must_change_password, created_at, updated_at)
     VALUES (
       gen_random_uuid(),
       'employee' || lpad(i::text, 3, '0'),
       crypt('employee' || lpad(i::text, 3, '0'), gen_salt('bf')),
       'employee',
       level_ids[rand_index],
+      true,
       NOW(),
       NOW()
     );